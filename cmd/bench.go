@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure conversion throughput, latency and memory use",
+	Long: `Converts the same page many times at each concurrency level and reports pages per
+second, latency percentiles and memory use, to help tune --concurrency. The page is
+fetched, converted and written exactly as by convert, into a temporary directory
+that is removed afterwards.
+
+Without --url, a built-in page is served from a local port, so the benchmark needs
+no network access and measures the converter rather than a remote site.
+
+Example usage:
+  doc-converter bench
+  doc-converter bench --concurrency 1,8,32 --requests 500 --format json
+  doc-converter bench --url https://alain.apigban.com/ --selector "#theme"`,
+	Args: cobra.NoArgs,
+	Run:  runBench,
+}
+
+var (
+	benchURL         string
+	benchSelector    string
+	benchRequests    int
+	benchConcurrency []int
+	benchFormat      string
+)
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().StringVar(&benchURL, "url", "", "Page to convert (default: a built-in local page)")
+	benchCmd.Flags().StringVarP(&benchSelector, "selector", "s", "main", "CSS selector for the main content")
+	benchCmd.Flags().IntVar(&benchRequests, "requests", 200, "Conversions per concurrency level")
+	benchCmd.Flags().IntSliceVar(&benchConcurrency, "concurrency", []int{1, 4, 8}, "Concurrency levels to measure (comma-separated)")
+	benchCmd.Flags().StringVar(&benchFormat, "format", "text", "Output format: text or json")
+}
+
+func runBench(cmd *cobra.Command, args []string) {
+	if benchFormat != "text" && benchFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported format '%s' (expected text or json)\n", benchFormat)
+		exitFunc(1)
+		return
+	}
+	if benchRequests < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --requests must be at least 1")
+		exitFunc(1)
+		return
+	}
+	for _, level := range benchConcurrency {
+		if level < 1 {
+			fmt.Fprintln(os.Stderr, "Error: --concurrency levels must be at least 1")
+			exitFunc(1)
+			return
+		}
+	}
+
+	results, err := converter.Benchmark(converter.BenchOptions{
+		URL:         benchURL,
+		Selector:    benchSelector,
+		Requests:    benchRequests,
+		Concurrency: benchConcurrency,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exitFunc(1)
+		return
+	}
+
+	out := cmd.OutOrStdout()
+	if benchFormat == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to encode results: %v\n", err)
+			exitFunc(1)
+		}
+		return
+	}
+	printBenchResults(out, results)
+}
+
+// printBenchResults writes one table row per concurrency level.
+func printBenchResults(out io.Writer, results []converter.BenchResult) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CONCURRENCY\tPAGES/S\tP50\tP90\tP99\tMAX\tALLOC/PAGE\tPEAK HEAP\tFAILED\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%d\t%.1f\t%s\t%s\t%s\t%s\t%.1f KB\t%.1f MB\t%d\t\n",
+			r.Concurrency, r.PagesPerSecond,
+			r.P50.Round(time.Microsecond), r.P90.Round(time.Microsecond), r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond),
+			float64(r.AllocPerPage)/(1<<10), float64(r.PeakHeap)/(1<<20), r.Failed)
+	}
+	tw.Flush()
+}
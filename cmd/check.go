@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate the configuration and inputs of a conversion without running it",
+	Long: `Takes the same flags and config file as convert and validates everything a run
+depends on, without fetching any page or writing any output: the config file parses,
+the flags are valid, every URL list (local or remote) loads, every URL is a well-formed
+http(s) URL, the CSS selectors compile and the output directory is writable.
+
+All problems are reported together, and the command exits with status 1 when there
+are any, so it can guard a large run in CI.
+
+Example usage:
+  doc-converter check --file urls.txt --selector "#main-content"
+  doc-converter check --config production.yaml`,
+	Args: cobra.NoArgs,
+	Run:  runCheck,
+}
+
+func init() {
+	// The convert flags are added by convert's init, which runs after this one
+	rootCmd.AddCommand(checkCmd)
+}
+
+// checkResult is the outcome of one validation.
+type checkResult struct {
+	name   string
+	detail string
+	errs   []error
+}
+
+func runCheck(cmd *cobra.Command, args []string) {
+	settings, flagErrs := validateConvertFlags()
+	results := []checkResult{checkConfig(), {name: "flags", detail: "valid", errs: flagErrs}}
+	results = append(results, checkInputs(settings)...)
+	results = append(results, checkSelectors(), checkOutputDir(viper.GetString("output")))
+
+	failed := printCheckResults(cmd.OutOrStdout(), results)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d of %d checks failed\n", failed, len(results))
+		exitFunc(1)
+	}
+}
+
+// checkConfig reports whether the config file, if any, parses. initConfig
+// ignores an unreadable config, which convert would then run without.
+func checkConfig() checkResult {
+	result := checkResult{name: "config"}
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) && cfgFile == "" {
+			result.detail = "no config file found; using flags only"
+			return result
+		}
+		result.errs = append(result.errs, fmt.Errorf("failed to read config: %w", err))
+		return result
+	}
+	// Reading the config again dropped the profile merged over it
+	if err := applyProfile(); err != nil {
+		result.errs = append(result.errs, err)
+	}
+	result.detail = viper.ConfigFileUsed()
+	if profile != "" {
+		result.detail += " (profile " + profile + ")"
+	}
+	return result
+}
+
+// checkInputs loads the URL lists as convert would and checks every URL.
+func checkInputs(settings *convertSettings) []checkResult {
+	files := viper.GetStringSlice("file")
+	inputs := checkResult{name: "inputs"}
+	if harFile := viper.GetString("har"); harFile != "" && len(files) == 0 {
+		har, skipped, err := converter.LoadHAR(harFile)
+		if err != nil {
+			inputs.errs = append(inputs.errs, err)
+		} else {
+			inputs.detail = fmt.Sprintf("%d recorded pages from %s (%d entries skipped)", len(har.URLs()), harFile, skipped)
+		}
+		return []checkResult{inputs}
+	}
+	if len(files) == 0 {
+		inputs.errs = append(inputs.errs, errors.New("--file or --har must be provided (via flag or config)"))
+		return []checkResult{inputs}
+	}
+
+	limit := settings.bodyLimit
+	if limit <= 0 {
+		limit = converter.DefaultMaxBodySize
+	}
+	list, err := openURLList(files, limit, viper.GetBool("expand-env"), viper.GetBool("strict-env"), "")
+	if err != nil {
+		inputs.errs = append(inputs.errs, err)
+		return []checkResult{inputs}
+	}
+	inputs.detail = fmt.Sprintf("%d URLs from %d files", list.count, len(files))
+
+	wellFormed := checkResult{name: "urls", detail: "all well-formed"}
+	err = list.scan(false, func(u, _ string, first bool) {
+		if !first {
+			return
+		}
+		parsed, err := url.Parse(u)
+		switch {
+		case err != nil:
+			wellFormed.errs = append(wellFormed.errs, err)
+		case parsed.Scheme != "http" && parsed.Scheme != "https":
+			wellFormed.errs = append(wellFormed.errs, fmt.Errorf("%s: not an http(s) URL", u))
+		case parsed.Host == "":
+			wellFormed.errs = append(wellFormed.errs, fmt.Errorf("%s: no host", u))
+		}
+	})
+	if err != nil {
+		wellFormed.errs = append(wellFormed.errs, err)
+	}
+	if list.count == 0 {
+		wellFormed.errs = append(wellFormed.errs, errors.New("the URL files list no URLs"))
+	}
+	return []checkResult{inputs, wellFormed}
+}
+
+// checkSelectors compiles the CSS selectors given in the flags.
+func checkSelectors() checkResult {
+	result := checkResult{name: "selectors", detail: "all compile"}
+	for _, name := range []string{"selector", "breadcrumb-selector", "title-selector", "skip-selector", "wait-for"} {
+		sel := viper.GetString(name)
+		if name == "selector" && (converter.IsWholePageSelector(sel) || viper.GetString("input-format") == converter.InputXML) {
+			continue // An XML path is checked with the other flags
+		}
+		if sel == "" {
+			continue
+		}
+		if err := converter.ValidateSelector(sel); err != nil {
+			result.errs = append(result.errs, fmt.Errorf("--%s: %w", name, err))
+		}
+	}
+	return result
+}
+
+// checkOutputDir checks that run directories can be created in parent. It
+// creates nothing that outlives the check: a missing parent is checked
+// through its nearest existing ancestor.
+func checkOutputDir(parent string) checkResult {
+	result := checkResult{name: "output", detail: parent + " is writable"}
+	dir := parent
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				result.errs = append(result.errs, fmt.Errorf("%s is not a directory", dir))
+				return result
+			}
+			break
+		}
+		if next := filepath.Dir(dir); next != dir {
+			dir = next
+			continue
+		}
+		result.errs = append(result.errs, fmt.Errorf("no existing ancestor of %s: %w", parent, err))
+		return result
+	}
+
+	probe, err := os.CreateTemp(dir, ".doc-converter-check-*")
+	if err != nil {
+		result.errs = append(result.errs, fmt.Errorf("%s is not writable: %w", dir, err))
+		return result
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	if viper.GetBool("require-empty-output") {
+		if err := requireEmptyDir(parent); err != nil {
+			result.errs = append(result.errs, err)
+		}
+	}
+	return result
+}
+
+// printCheckResults writes one line per check, and one per problem, and
+// returns the number of failed checks.
+func printCheckResults(out io.Writer, results []checkResult) int {
+	failed := 0
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, r := range results {
+		if len(r.errs) == 0 {
+			fmt.Fprintf(tw, "ok\t%s\t%s\n", r.name, r.detail)
+			continue
+		}
+		failed++
+		for _, err := range r.errs {
+			fmt.Fprintf(tw, "FAIL\t%s\t%v\n", r.name, err)
+		}
+	}
+	tw.Flush()
+	return failed
+}
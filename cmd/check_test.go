@@ -0,0 +1,65 @@
+//go:build integration
+// +build integration
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executeCheck runs the check command with args and returns its report and
+// whether it failed.
+func executeCheck(t *testing.T, args ...string) (string, bool) {
+	t.Helper()
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = append([]string{"doc-converter", "check"}, args...)
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+
+	originalExitFunc := exitFunc
+	failed := false
+	exitFunc = func(code int) { failed = true }
+	defer func() { exitFunc = originalExitFunc }()
+	t.Cleanup(func() {
+		// Don't leak flags or a config file into later tests
+		resetConvertFlags()
+		rootCmd.PersistentFlags().Set("config", "")
+		cfgFile = ""
+		viper.SetConfigFile("")
+	})
+
+	resetConvertFlags()
+	Execute()
+	return out.String(), failed
+}
+
+func TestCLI_Check_Passes(t *testing.T) {
+	urlFile := writeURLFile(t, "testurls_check.txt", "https://example.com/a\nhttps://example.com/b\tb.md\n")
+
+	report, failed := executeCheck(t, "--file", urlFile, "--selector", "main", "--output", "test_output_check")
+	assert.False(t, failed, report)
+	assert.Regexp(t, `ok\s+inputs\s+2 URLs from 1 files`, report)
+	assert.NoDirExists(t, "test_output_check", "check must not create output")
+}
+
+func TestCLI_Check_ReportsEveryProblem(t *testing.T) {
+	urlFile := writeURLFile(t, "testurls_check_bad.txt", "https://example.com/a\nftp://example.com/file\n")
+	config := writeURLFile(t, "check_config.yaml", "selector: [unterminated\n")
+
+	report, failed := executeCheck(t, "--config", config, "--file", urlFile, "--selector", "div[", "--concurrency", "0")
+	require.True(t, failed)
+	assert.Regexp(t, `FAIL\s+config\s+failed to read config`, report)
+	assert.Regexp(t, `FAIL\s+flags\s+--concurrency must be at least 1`, report)
+	assert.Regexp(t, `FAIL\s+urls\s+ftp://example.com/file: not an http\(s\) URL`, report)
+	assert.Regexp(t, `FAIL\s+selectors\s+--selector: invalid CSS selector 'div\['`, report)
+	assert.Regexp(t, `ok\s+output`, report)
+}
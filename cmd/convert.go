@@ -1,13 +1,26 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"doc-converter/pkg/converter"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -34,105 +47,1399 @@ Example usage:
 
 // Wire up flags for --file and --selector, bind to viper
 var (
-	filePath string
-	selector string
-	output   string
+	filePaths      []string
+	harPath        string
+	resumeURL      string
+	expandEnv      bool
+	strictEnv      bool
+	selector       string
+	output         string
+	emojiStyle     string
+	timestampFmt   string
+	useUTC         bool
+	contentHash    string
+	linkBase       string
+	format         string
+	inputFormat    string
+	xmlElements    []string
+	headingStyle   string
+	richMarkdown   bool
+	anchorStyle    string
+	skipSelector   string
+	skipNoindex    bool
+	splitTokens    int
+	headingDepth   int
+	headingDemote  string
+	validateMD     bool
+	strictMD       bool
+	concurrency    int
+	maxSize        string
+	maxTypeSizes   []string
+	acceptStatus   []string
+	breakerLimit   int
+	breakerCool    time.Duration
+	selectorIndex  int
+	selectorAttr   string
+	selectorRules  []string
+	regions        []string
+	sectionText    string
+	sectionRegex   bool
+	dropQuery      bool
+	queryParams    []string
+	sliceStart     string
+	sliceEnd       string
+	emitIndex      bool
+	emitSitemap    bool
+	writeManifest  bool
+	checkLinks     bool
+	failOnBroken   bool
+	preflight      bool
+	cookies        bool
+	userAgents     []string
+	userAgentFile  string
+	userAgentOrder string
+	dnsServer      string
+	resolveHosts   []string
+	traceRequests  bool
+	traceFile      string
+	singleJSON     string
+	preserveOrder  bool
+	zimPath        string
+	zimTitle       string
+	addMeta        []string
+	addMetaWins    bool
+	modifiedSince  string
+	dirMode        string
+	renderMode     string
+	browserPath    string
+	waitFor        string
+	waitTimeout    time.Duration
+	fileMode       string
+	fetchOnly      bool
+	combineByHost  bool
+	shard          string
+	layout         string
+	noProgress     bool
+	breadcrumbs    bool
+	followIframes  bool
+	breadcrumbSel  string
+	titleSelector  string
+	titleStrip     string
+	digestUser     string
+	digestPassword string
+	tokenCommand   string
+	tokenURL       string
+	bearerHosts    []string
+	digestHosts    []string
+	noHostDirs     bool
+	requireEmpty   bool
+	resultsBuffer  int
 )
 
 func init() {
 	rootCmd.AddCommand(convertCmd)
 
-	convertCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to the text file containing URLs")
-	convertCmd.Flags().StringVarP(&selector, "selector", "s", "", "CSS selector for the main content")
+	convertCmd.Flags().StringSliceVarP(&filePaths, "file", "f", nil, "Path or http(s) URL of a text file containing URLs (repeatable; files are merged)")
+	convertCmd.Flags().StringVar(&harPath, "har", "", "Convert the HTML responses recorded in a HAR capture instead of fetching a URL list")
+	convertCmd.Flags().StringVar(&resumeURL, "resume-from", "", "Start at this URL of the list, skipping the URLs before it")
+	convertCmd.Flags().BoolVar(&expandEnv, "expand-env", false, "Expand ${VAR} references to environment variables in the URL files")
+	convertCmd.Flags().BoolVar(&strictEnv, "strict-env", false, "With --expand-env, fail on undefined variables instead of expanding them to empty")
+	convertCmd.Flags().StringVarP(&selector, "selector", "s", "", "CSS selector for the main content (empty, body or * converts the whole page)")
 	convertCmd.Flags().StringVarP(&output, "output", "o", "output", "Custom parent directory for output files")
+	convertCmd.Flags().BoolVar(&requireEmpty, "require-empty-output", false, "Abort before creating the run directory unless the --output directory is empty or missing")
+	convertCmd.Flags().StringArrayVar(&selectorRules, "selector-rule", nil, "Use another selector on pages of one type, as 'condition => selector' (e.g. 'body.article => article'); the first matching rule wins (repeatable)")
+	convertCmd.Flags().StringArrayVar(&regions, "region", nil, "Write this part of each page to a file of its own, as name=selector (e.g. tutorial=.tutorial gives page-tutorial.md); replaces --selector (repeatable)")
+	convertCmd.Flags().IntVar(&selectorIndex, "selector-index", 0, "Convert the Nth match of the selector (1 is the first, -1 the last)")
+	convertCmd.Flags().StringVar(&selectorAttr, "selector-attr", "", "Write the value of this attribute of the selector's matches, one per line, instead of their rendered content")
+	convertCmd.Flags().StringVar(&sectionText, "contains-heading", "", "Convert only the section whose heading contains this text (case-insensitive), up to the next heading of its level")
+	convertCmd.Flags().BoolVar(&sectionRegex, "heading-regex", false, "Treat --contains-heading as a regular expression")
+	convertCmd.Flags().BoolVar(&dropQuery, "drop-query", false, "Leave query parameters out of filenames derived from the URL of untitled pages")
+	convertCmd.Flags().StringSliceVar(&queryParams, "query-params", nil, "Only these query parameters (comma-separated) go into filenames derived from a URL")
+	convertCmd.Flags().StringVar(&sliceStart, "slice-start", "", "Experimental: regex; keep only the rendered text after its first match")
+	convertCmd.Flags().StringVar(&sliceEnd, "slice-end", "", "Experimental: regex; keep only the rendered text before its first match after --slice-start")
+	convertCmd.Flags().IntVar(&concurrency, "concurrency", converter.DefaultConcurrency, "Number of pages fetched and converted in parallel")
+	convertCmd.Flags().IntVar(&resultsBuffer, "results-buffer", 0, "Completed pages that may wait to be logged before workers pause (0: none)")
+	convertCmd.Flags().StringVar(&maxSize, "max-size", "5MB", "Largest response body accepted per page (e.g. 512KB, 5MB)")
+	convertCmd.Flags().StringSliceVar(&maxTypeSizes, "max-size-type", nil, "Body limit for one content type, overriding --max-size, as type=size (e.g. text/html=2MB, image/*=20MB; repeatable)")
+	convertCmd.Flags().StringSliceVar(&acceptStatus, "accept-status", nil, "Also convert pages served with these HTTP status codes (comma-separated), e.g. 203,404")
+	convertCmd.Flags().IntVar(&breakerLimit, "breaker-threshold", 0, "Skip a host's remaining URLs after this many consecutive timeouts or 5xx responses (0 disables)")
+	convertCmd.Flags().DurationVar(&breakerCool, "breaker-cooldown", converter.DefaultBreakerCooldown, "How long a host is skipped by --breaker-threshold before it is probed again")
+	convertCmd.Flags().StringArrayVar(&addMeta, "add-meta", nil, "Add a fixed field to every page's frontmatter, as key=value or key=[a, b] for a list (repeatable)")
+	convertCmd.Flags().BoolVar(&addMetaWins, "add-meta-override", false, "Let --add-meta fields replace the same fields extracted from a page")
+	convertCmd.Flags().StringVar(&modifiedSince, "modified-since", "", "Only convert pages changed since this date (2006-01-02, RFC 3339 or HTTP date); unchanged pages are skipped")
+	convertCmd.Flags().BoolVar(&emitIndex, "emit-index", false, "Write an index.html linking all converted pages into the run directory")
+	convertCmd.Flags().BoolVar(&emitSitemap, "emit-sitemap", false, "Write a sitemap.xml of the converted pages' source URLs into the run directory")
+	convertCmd.Flags().StringVar(&renderMode, "render", converter.RenderStatic, "How pages are loaded: static (HTML as served) or js (run in headless Chrome first)")
+	convertCmd.Flags().StringVar(&browserPath, "browser", "", "Chrome or Chromium executable for --render js (default: searched in PATH)")
+	convertCmd.Flags().StringVar(&waitFor, "wait-for", "", "With --render js, wait until this selector matches before extracting")
+	convertCmd.Flags().DurationVar(&waitTimeout, "wait-timeout", converter.DefaultWaitTimeout, "How long --wait-for waits before converting the page as it is")
+	convertCmd.Flags().BoolVar(&preflight, "preflight", false, "Check each URL with a HEAD request first and skip error and non-HTML responses")
+	convertCmd.Flags().StringVar(&dnsServer, "resolver", "", "DNS server (host:port) to resolve host names with, instead of the system resolver")
+	convertCmd.Flags().StringSliceVar(&resolveHosts, "resolve", nil, "Resolve a host to a fixed IP address, as host=ip (repeatable)")
+	convertCmd.Flags().StringArrayVar(&userAgents, "user-agent", nil, "User-Agent header to send; give it more than once to rotate through a pool (repeatable)")
+	convertCmd.Flags().StringVar(&userAgentFile, "user-agent-file", "", "File listing user agents to rotate through, one per line, added to --user-agent")
+	convertCmd.Flags().StringVar(&userAgentOrder, "user-agent-rotation", converter.RotateRoundRobin, "How requests take user agents from the pool: round-robin or random")
+	convertCmd.Flags().BoolVar(&cookies, "cookies", false, "Keep cookies set by a site during the run and send them with later requests to it")
+	convertCmd.Flags().BoolVar(&traceRequests, "trace-requests", false, "Log the headers of every HTTP request and response, with credentials and cookies redacted")
+	convertCmd.Flags().StringVar(&singleJSON, "output-single-json", "", "Also write every converted page (source, metadata and body) into this file as one JSON array")
+	convertCmd.Flags().BoolVar(&preserveOrder, "preserve-order", false, "Write --output-single-json pages in input order rather than as they complete")
+	convertCmd.Flags().StringVar(&zimPath, "zim", "", "Also write the converted pages into this ZIM archive, with a main page listing them, for offline readers such as Kiwix")
+	convertCmd.Flags().StringVar(&zimTitle, "zim-title", "", "Title of the --zim archive (default: the host of the pages)")
+	convertCmd.Flags().StringVar(&traceFile, "trace-file", "", "Write the --trace-requests output to this file instead of the log (implies --trace-requests)")
+	convertCmd.Flags().BoolVar(&writeManifest, "manifest", false, "Write a manifest.json with the run summary and per-URL results (needed by retry)")
+	convertCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Log a line per page instead of showing a progress bar when stdout is a terminal")
+	convertCmd.Flags().BoolVar(&checkLinks, "check-links", false, "After converting, check the absolute links in the output files and write a link-report.json")
+	convertCmd.Flags().BoolVar(&failOnBroken, "fail-on-broken-links", false, "Exit with an error when links are broken (implies --check-links)")
+	convertCmd.Flags().BoolVar(&fetchOnly, "fetch-only", false, "Save the raw HTML of each page with a YAML metadata sidecar, skipping conversion")
+	convertCmd.Flags().BoolVar(&combineByHost, "combine-by-host", false, "Write one <host> file per host holding its pages as sections, instead of one file per page")
+	convertCmd.Flags().BoolVar(&followIframes, "follow-iframes", false, "Fetch same-origin iframes and convert their content in place (cross-origin frames are skipped)")
+	convertCmd.Flags().StringVar(&shard, "shard", "", "Distribute files into subdirectories: hash (256 directories by URL hash) or host")
+	convertCmd.Flags().BoolVar(&noHostDirs, "no-host-dirs", false, "Write the files of a run with URLs from several hosts flat, rather than into one directory per host")
+	convertCmd.Flags().StringVar(&layout, "layout", "", "Shape the output for a static site: hugo (page bundles, <name>/index.md) or jekyll (_posts/YYYY-MM-DD-<name>.md)")
+	convertCmd.Flags().IntVar(&splitTokens, "split-tokens", 0, "Split Markdown files estimated at more than this many LLM tokens into name-part1.md, name-part2.md, ... at paragraph boundaries")
+	convertCmd.Flags().BoolVar(&breadcrumbs, "breadcrumbs", false, "Add the page's breadcrumb trail to the frontmatter when one is found")
+	convertCmd.Flags().StringVar(&breadcrumbSel, "breadcrumb-selector", "", "CSS selector matching each breadcrumb item (default: read a JSON-LD BreadcrumbList)")
+	convertCmd.Flags().StringVar(&titleSelector, "title-selector", "", "CSS selector of the element holding the page title, e.g. .article-title (default: <title>, also used when it matches nothing)")
+	convertCmd.Flags().StringVar(&skipSelector, "skip-selector", "", "Skip pages with an element matching this CSS selector, e.g. .noindex")
+	convertCmd.Flags().BoolVar(&skipNoindex, "skip-noindex", false, "Skip pages whose robots meta tag says noindex")
+	convertCmd.Flags().StringVar(&titleStrip, "title-strip", "", "Regular expression removed from the <title>, such as a site name suffix: ' \\| MySite$'")
+	convertCmd.Flags().StringVar(&digestUser, "digest-user", "", "Username for HTTP Digest authentication")
+	convertCmd.Flags().StringVar(&digestPassword, "digest-password", "", "Password for HTTP Digest authentication")
+	convertCmd.Flags().StringSliceVar(&digestHosts, "digest-host", nil, "Also answer Digest challenges from this host or host:port; only the hosts of the input URLs are answered otherwise (repeatable)")
+	convertCmd.Flags().StringVar(&tokenCommand, "token-command", "", "Shell command printing a bearer token; it is run again when a request gets a 401")
+	convertCmd.Flags().StringVar(&tokenURL, "token-url", "", "Endpoint to POST to for a bearer token; it is asked again when a request gets a 401")
+	convertCmd.Flags().StringSliceVar(&bearerHosts, "bearer-host", nil, "Also send the bearer token to this host or host:port; it only goes to the hosts of the input URLs otherwise (repeatable)")
+	convertCmd.Flags().StringVar(&dirMode, "dir-mode", "0755", "Permissions (octal) of created output directories")
+	convertCmd.Flags().StringVar(&fileMode, "file-mode", "0644", "Permissions (octal) of written output files")
+	convertCmd.Flags().StringVar(&format, "format", converter.FormatMarkdown, "Output format: markdown, adoc or rst")
+	convertCmd.Flags().StringVar(&inputFormat, "input-format", converter.InputHTML, "Format of the pages: html, or xml (such as DocBook) with --selector as an XML path like //chapter[@id='intro']")
+	convertCmd.Flags().StringArrayVar(&xmlElements, "xml-element", nil, "With --input-format xml, render an element as p, pre, code, a, heading or drop, as element=target (e.g. note=p); overrides the DocBook rules (repeatable)")
+	convertCmd.Flags().BoolVar(&richMarkdown, "rich-markdown", false, "Render code blocks, lists and tables in markdown, and keep links inline in their paragraphs, instead of the classic conversion")
+	convertCmd.Flags().StringVar(&headingStyle, "heading-style", converter.HeadingATX, "Markdown heading style: atx (# Title) or setext (underlined h1 and h2)")
+	convertCmd.Flags().StringVar(&anchorStyle, "anchors", converter.AnchorNone, "Keep the ids of headings for deep links: html (<a id> anchors) or attribute ({#id} after the heading)")
+	convertCmd.Flags().IntVar(&headingDepth, "max-depth-for-headings", 0, "Deepest heading level written, 1 to 6; deeper headings are demoted (0 keeps all levels)")
+	convertCmd.Flags().StringVar(&headingDemote, "demote-headings", converter.HeadingDemoteBold, "How headings below --max-depth-for-headings are written: bold (a bold paragraph) or clamp (a heading at the cap)")
+	convertCmd.Flags().BoolVar(&validateMD, "validate-markdown", false, "Lint each page's markdown for constructs that are likely not to parse back as written, such as unclosed emphasis, and warn about them (a heuristic check, not a CommonMark parser)")
+	convertCmd.Flags().BoolVar(&strictMD, "strict-markdown", false, "Like --validate-markdown, but fail the pages whose markdown has problems")
+	convertCmd.Flags().StringVar(&timestampFmt, "timestamp-format", "rfc3339", "Format of retrieved_at: rfc3339, rfc3339nano, iso8601, rfc1123, date or a Go time layout")
+	convertCmd.Flags().BoolVar(&useUTC, "utc", false, "Write retrieved_at in UTC instead of local time")
+	convertCmd.Flags().StringVar(&contentHash, "content-hash", converter.HashNone, "Add a content_hash field to the frontmatter, the digest of the page body: sha256 (the default with no value), sha512, sha1 or md5")
+	convertCmd.Flags().Lookup("content-hash").NoOptDefVal = converter.HashSHA256
+	convertCmd.Flags().StringVar(&linkBase, "link-base", converter.LinkBaseNone, "Resolve relative links against the request URL (request), the canonical URL (canonical), the <base href> (base), or the first of <base href>, canonical and request URL (auto, the default with no value)")
+	convertCmd.Flags().Lookup("link-base").NoOptDefVal = converter.LinkBaseAuto
+	convertCmd.Flags().StringVar(&emojiStyle, "emoji", converter.EmojiKeep, "How to write emoji: keep (as-is) or shortcode (:smile:)")
 
 	viper.BindPFlag("file", convertCmd.Flags().Lookup("file"))
+	viper.BindPFlag("har", convertCmd.Flags().Lookup("har"))
+	viper.BindPFlag("resume-from", convertCmd.Flags().Lookup("resume-from"))
+	viper.BindPFlag("expand-env", convertCmd.Flags().Lookup("expand-env"))
+	viper.BindPFlag("strict-env", convertCmd.Flags().Lookup("strict-env"))
 	viper.BindPFlag("selector", convertCmd.Flags().Lookup("selector"))
 	viper.BindPFlag("output", convertCmd.Flags().Lookup("output"))
+	viper.BindPFlag("require-empty-output", convertCmd.Flags().Lookup("require-empty-output"))
+	viper.BindPFlag("selector-rule", convertCmd.Flags().Lookup("selector-rule"))
+	viper.BindPFlag("region", convertCmd.Flags().Lookup("region"))
+	viper.BindPFlag("selector-index", convertCmd.Flags().Lookup("selector-index"))
+	viper.BindPFlag("selector-attr", convertCmd.Flags().Lookup("selector-attr"))
+	viper.BindPFlag("contains-heading", convertCmd.Flags().Lookup("contains-heading"))
+	viper.BindPFlag("heading-regex", convertCmd.Flags().Lookup("heading-regex"))
+	viper.BindPFlag("drop-query", convertCmd.Flags().Lookup("drop-query"))
+	viper.BindPFlag("query-params", convertCmd.Flags().Lookup("query-params"))
+	viper.BindPFlag("slice-start", convertCmd.Flags().Lookup("slice-start"))
+	viper.BindPFlag("slice-end", convertCmd.Flags().Lookup("slice-end"))
+	viper.BindPFlag("concurrency", convertCmd.Flags().Lookup("concurrency"))
+	viper.BindPFlag("results-buffer", convertCmd.Flags().Lookup("results-buffer"))
+	viper.BindPFlag("max-size", convertCmd.Flags().Lookup("max-size"))
+	viper.BindPFlag("max-size-type", convertCmd.Flags().Lookup("max-size-type"))
+	viper.BindPFlag("accept-status", convertCmd.Flags().Lookup("accept-status"))
+	viper.BindPFlag("breaker-threshold", convertCmd.Flags().Lookup("breaker-threshold"))
+	viper.BindPFlag("breaker-cooldown", convertCmd.Flags().Lookup("breaker-cooldown"))
+	viper.BindPFlag("add-meta", convertCmd.Flags().Lookup("add-meta"))
+	viper.BindPFlag("add-meta-override", convertCmd.Flags().Lookup("add-meta-override"))
+	viper.BindPFlag("modified-since", convertCmd.Flags().Lookup("modified-since"))
+	viper.BindPFlag("emit-index", convertCmd.Flags().Lookup("emit-index"))
+	viper.BindPFlag("emit-sitemap", convertCmd.Flags().Lookup("emit-sitemap"))
+	viper.BindPFlag("render", convertCmd.Flags().Lookup("render"))
+	viper.BindPFlag("browser", convertCmd.Flags().Lookup("browser"))
+	viper.BindPFlag("wait-for", convertCmd.Flags().Lookup("wait-for"))
+	viper.BindPFlag("wait-timeout", convertCmd.Flags().Lookup("wait-timeout"))
+	viper.BindPFlag("preflight", convertCmd.Flags().Lookup("preflight"))
+	viper.BindPFlag("resolver", convertCmd.Flags().Lookup("resolver"))
+	viper.BindPFlag("resolve", convertCmd.Flags().Lookup("resolve"))
+	viper.BindPFlag("cookies", convertCmd.Flags().Lookup("cookies"))
+	viper.BindPFlag("user-agent", convertCmd.Flags().Lookup("user-agent"))
+	viper.BindPFlag("user-agent-file", convertCmd.Flags().Lookup("user-agent-file"))
+	viper.BindPFlag("user-agent-rotation", convertCmd.Flags().Lookup("user-agent-rotation"))
+	viper.BindPFlag("trace-requests", convertCmd.Flags().Lookup("trace-requests"))
+	viper.BindPFlag("trace-file", convertCmd.Flags().Lookup("trace-file"))
+	viper.BindPFlag("output-single-json", convertCmd.Flags().Lookup("output-single-json"))
+	viper.BindPFlag("preserve-order", convertCmd.Flags().Lookup("preserve-order"))
+	viper.BindPFlag("zim", convertCmd.Flags().Lookup("zim"))
+	viper.BindPFlag("zim-title", convertCmd.Flags().Lookup("zim-title"))
+	viper.BindPFlag("manifest", convertCmd.Flags().Lookup("manifest"))
+	viper.BindPFlag("no-progress", convertCmd.Flags().Lookup("no-progress"))
+	viper.BindPFlag("check-links", convertCmd.Flags().Lookup("check-links"))
+	viper.BindPFlag("fail-on-broken-links", convertCmd.Flags().Lookup("fail-on-broken-links"))
+	viper.BindPFlag("fetch-only", convertCmd.Flags().Lookup("fetch-only"))
+	viper.BindPFlag("combine-by-host", convertCmd.Flags().Lookup("combine-by-host"))
+	viper.BindPFlag("follow-iframes", convertCmd.Flags().Lookup("follow-iframes"))
+	viper.BindPFlag("shard", convertCmd.Flags().Lookup("shard"))
+	viper.BindPFlag("no-host-dirs", convertCmd.Flags().Lookup("no-host-dirs"))
+	viper.BindPFlag("layout", convertCmd.Flags().Lookup("layout"))
+	viper.BindPFlag("split-tokens", convertCmd.Flags().Lookup("split-tokens"))
+	viper.BindPFlag("breadcrumbs", convertCmd.Flags().Lookup("breadcrumbs"))
+	viper.BindPFlag("breadcrumb-selector", convertCmd.Flags().Lookup("breadcrumb-selector"))
+	viper.BindPFlag("title-selector", convertCmd.Flags().Lookup("title-selector"))
+	viper.BindPFlag("title-strip", convertCmd.Flags().Lookup("title-strip"))
+	viper.BindPFlag("skip-selector", convertCmd.Flags().Lookup("skip-selector"))
+	viper.BindPFlag("skip-noindex", convertCmd.Flags().Lookup("skip-noindex"))
+	viper.BindPFlag("digest-user", convertCmd.Flags().Lookup("digest-user"))
+	viper.BindPFlag("digest-password", convertCmd.Flags().Lookup("digest-password"))
+	viper.BindPFlag("digest-host", convertCmd.Flags().Lookup("digest-host"))
+	viper.BindPFlag("token-command", convertCmd.Flags().Lookup("token-command"))
+	viper.BindPFlag("token-url", convertCmd.Flags().Lookup("token-url"))
+	viper.BindPFlag("bearer-host", convertCmd.Flags().Lookup("bearer-host"))
+	viper.BindPFlag("dir-mode", convertCmd.Flags().Lookup("dir-mode"))
+	viper.BindPFlag("file-mode", convertCmd.Flags().Lookup("file-mode"))
+	viper.BindPFlag("format", convertCmd.Flags().Lookup("format"))
+	viper.BindPFlag("input-format", convertCmd.Flags().Lookup("input-format"))
+	viper.BindPFlag("xml-element", convertCmd.Flags().Lookup("xml-element"))
+	viper.BindPFlag("rich-markdown", convertCmd.Flags().Lookup("rich-markdown"))
+	viper.BindPFlag("heading-style", convertCmd.Flags().Lookup("heading-style"))
+	viper.BindPFlag("anchors", convertCmd.Flags().Lookup("anchors"))
+	viper.BindPFlag("max-depth-for-headings", convertCmd.Flags().Lookup("max-depth-for-headings"))
+	viper.BindPFlag("demote-headings", convertCmd.Flags().Lookup("demote-headings"))
+	viper.BindPFlag("validate-markdown", convertCmd.Flags().Lookup("validate-markdown"))
+	viper.BindPFlag("strict-markdown", convertCmd.Flags().Lookup("strict-markdown"))
+	viper.BindPFlag("timestamp-format", convertCmd.Flags().Lookup("timestamp-format"))
+	viper.BindPFlag("utc", convertCmd.Flags().Lookup("utc"))
+	viper.BindPFlag("content-hash", convertCmd.Flags().Lookup("content-hash"))
+	viper.BindPFlag("link-base", convertCmd.Flags().Lookup("link-base"))
+	viper.BindPFlag("emoji", convertCmd.Flags().Lookup("emoji"))
+
+	// check validates the same flags, bound to the same config keys
+	checkCmd.Flags().AddFlagSet(convertCmd.Flags())
 }
 
 func runConvert(cmd *cobra.Command, args []string) {
 	// Validate required inputs
-	file := viper.GetString("file")
+	files := viper.GetStringSlice("file")
 	sel := viper.GetString("selector")
+	rawOnly := viper.GetBool("fetch-only")
+
+	harFile := viper.GetString("har")
 
-	if file == "" || sel == "" {
+	if len(files) == 0 && harFile == "" {
 		cmd.Help()
-		fmt.Fprintln(os.Stderr, "Error: Both --file and --selector must be provided (via flag or config)")
+		fmt.Fprintln(os.Stderr, "Error: --file or --har must be provided (via flag or config)")
 		exitFunc(1)
 		return // return after exitFunc for testability, though exitFunc will terminate
 	}
+	if converter.IsWholePageSelector(sel) && !rawOnly && len(viper.GetStringSlice("region")) == 0 {
+		log.Printf("INFO: No content selector given; converting the whole page body")
+	}
 
-	// File existence and readability check
-	if stat, err := os.Stat(file); err != nil || stat.IsDir() {
-		fmt.Fprintf(os.Stderr, "Error: Input file not found at '%s'\n", file)
+	settings, errs := validateConvertFlags()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		exitFunc(1)
-		return // return after exitFunc for testability, though exitFunc will terminate
+		return
+	}
+	if settings.browser != "" {
+		log.Printf("INFO: Rendering pages with %s", settings.browser)
+	}
+
+	// The URLs of a HAR file are in memory with it; those of URL files are
+	// read as the workers take them, so the list is never held whole
+	var urls []string
+	var list *urlList
+	var total, hosts int
+	var fileNames map[string]string
+	var har *converter.HAR
+	var err error
+	from := viper.GetString("resume-from")
+	if harFile != "" {
+		var skipped int
+		if har, skipped, err = converter.LoadHAR(harFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitFunc(1)
+			return
+		}
+		urls = har.URLs()
+		log.Printf("INFO: Loaded %d recorded pages for processing from %s (skipped %d entries that are not HTML pages)", len(urls), harFile, skipped)
+		if from != "" {
+			skipped := len(urls)
+			if urls, err = resumeFrom(urls, from); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Invalid --resume-from: %v\n", err)
+				exitFunc(1)
+				return
+			}
+			log.Printf("INFO: Resuming from %s, skipping the %d URLs before it", from, skipped-len(urls))
+		}
+		total, hosts = len(urls), converter.DistinctHosts(urls)
+	} else {
+		if list, err = openURLList(files, settings.bodyLimit, viper.GetBool("expand-env"), viper.GetBool("strict-env"), from); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitFunc(1)
+			return
+		}
+		log.Printf("INFO: Loaded %d URLs for processing from %s", list.skipped+list.count, strings.Join(files, ", "))
+		if from != "" {
+			log.Printf("INFO: Resuming from %s, skipping the %d URLs before it", from, list.skipped)
+		}
+		total, hosts, fileNames = list.count, len(list.hosts), list.fileNames
 	}
 
 	// Create unique, timestamped directory for this execution run
 	parentOutput := viper.GetString("output")
-	outputDir, err := createRunOutputDir(parentOutput)
+	if viper.GetBool("require-empty-output") {
+		if err := requireEmptyDir(parentOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --require-empty-output: %v\n", err)
+			exitFunc(1)
+			return
+		}
+	}
+	outputDir, err := createRunOutputDir(parentOutput, settings.dirPerm)
 	if err != nil {
 		log.Fatalf("Error creating output directory: %v", err)
 	}
 	log.Printf("INFO: Created output directory: %s", outputDir)
 
-	data, err := os.ReadFile(file)
+	c, err := converter.NewConverter(outputDir)
 	if err != nil {
-		log.Fatalf("Error reading file: %v", err)
+		log.Fatalf("Error creating converter: %v", err)
 	}
-
-	lines := bytes.Split(data, []byte{'\n'})
-
-	var urls []string
-	for _, line := range lines {
-		url := string(bytes.TrimSpace(line))
-		if url != "" {
-			urls = append(urls, url)
+	c.Format = settings.format
+	c.HeadingStyle = settings.headings
+	c.RichMarkdown = viper.GetBool("rich-markdown")
+	c.AnchorStyle = viper.GetString("anchors")
+	c.InputFormat = settings.inputFormat
+	c.XMLElements = settings.xmlElements
+	c.MaxHeadingDepth = viper.GetInt("max-depth-for-headings")
+	c.ExtraMetadata = settings.extraMeta
+	c.ModifiedSince = settings.modifiedSince
+	c.ExtraMetadataWins = viper.GetBool("add-meta-override")
+	c.HeadingDemotion = viper.GetString("demote-headings")
+	c.StrictMarkdown = viper.GetBool("strict-markdown")
+	c.ValidateMarkdown = viper.GetBool("validate-markdown") || c.StrictMarkdown
+	c.Render = settings.render
+	c.BrowserPath = viper.GetString("browser")
+	c.WaitFor = viper.GetString("wait-for")
+	c.WaitTimeout = viper.GetDuration("wait-timeout")
+	c.FileMode = settings.filePerm
+	c.DirMode = settings.dirPerm
+	c.Shard = viper.GetString("shard")
+	if useHostDirs(hosts) {
+		// Files from different sites then never collide, and their origin shows in the path
+		c.Shard = converter.ShardHost
+		log.Printf("INFO: The URLs are from %d hosts; writing each host's files into its own directory (disable with --no-host-dirs)", hosts)
+	}
+	c.Layout = viper.GetString("layout")
+	c.SplitTokens = viper.GetInt("split-tokens")
+	c.EmojiStyle = settings.emoji
+	c.TimestampFormat = settings.timestampLayout
+	c.UTC = viper.GetBool("utc")
+	c.ContentHash = viper.GetString("content-hash")
+	c.LinkBase = viper.GetString("link-base")
+	c.FileNames = fileNames
+	c.SelectorIndex = viper.GetInt("selector-index")
+	c.SelectorAttr = viper.GetString("selector-attr")
+	c.SelectorRules = settings.selectorRules
+	c.Regions = settings.regions
+	c.DropQuery = viper.GetBool("drop-query")
+	c.QueryParams = viper.GetStringSlice("query-params")
+	c.SliceStart, c.SliceEnd = settings.slices[0], settings.slices[1]
+	c.SectionHeading = settings.sectionHeading
+	c.EmitIndex = viper.GetBool("emit-index")
+	c.EmitSitemap = viper.GetBool("emit-sitemap")
+	c.FetchOnly = rawOnly
+	c.CombineByHost = viper.GetBool("combine-by-host")
+	c.Manifest = viper.GetBool("manifest")
+	c.Preflight = viper.GetBool("preflight")
+	c.FollowIframes = viper.GetBool("follow-iframes")
+	c.Breadcrumbs = viper.GetBool("breadcrumbs")
+	c.BreadcrumbSelector = viper.GetString("breadcrumb-selector")
+	c.TitleSelector = viper.GetString("title-selector")
+	c.TitleStrip = settings.titleStrip
+	c.SkipSelector = viper.GetString("skip-selector")
+	c.SkipNoindex = viper.GetBool("skip-noindex")
+	c.Concurrency = settings.workers
+	c.ResultsBuffer = viper.GetInt("results-buffer")
+	c.MaxBodySize = settings.bodyLimit
+	c.MaxBodySizes = settings.typeLimits
+	c.AcceptStatus = settings.acceptStatus
+	c.BreakerThreshold = viper.GetInt("breaker-threshold")
+	c.BreakerCooldown = viper.GetDuration("breaker-cooldown")
+	if har != nil {
+		// First, as it replaces the transport that tracing and Digest authentication wrap
+		c.UseHAR(har)
+	}
+	if server := viper.GetString("resolver"); server != "" || len(settings.resolveHosts) > 0 {
+		// First, as tracing and Digest authentication wrap the transport it sets up
+		if err := c.UseResolver(server, settings.resolveHosts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid --resolver: %v\n", err)
+			exitFunc(1)
+			return
 		}
 	}
-	log.Printf("INFO: Loaded %d URLs for processing from %s", len(urls), file)
-
-	c, err := converter.NewConverter(outputDir)
-	if err != nil {
-		log.Fatalf("Error creating converter: %v", err)
+	if viper.GetBool("cookies") {
+		c.UseCookieJar()
+	}
+	if len(settings.userAgents) > 0 {
+		c.UseUserAgents(settings.userAgents, viper.GetString("user-agent-rotation"))
+	}
+	// Tracing goes below Digest authentication so that its retries are traced too
+	if path := viper.GetString("trace-file"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create trace file: %v\n", err)
+			exitFunc(1)
+			return
+		}
+		defer f.Close()
+		c.TraceRequests(log.New(f, "", log.LstdFlags))
+	} else if viper.GetBool("trace-requests") {
+		c.TraceRequests(log.Default())
+	}
+	if user := viper.GetString("digest-user"); user != "" {
+		// Only the username is logged; the password never is
+		c.UseDigestAuth(user, viper.GetString("digest-password"), viper.GetStringSlice("digest-host")...)
+		log.Printf("INFO: Using HTTP Digest authentication as user '%s'", user)
+	}
+	// Tokens are never logged, only where they come from
+	if command := viper.GetString("token-command"); command != "" {
+		c.UseBearerToken(converter.TokenCommand(command), viper.GetStringSlice("bearer-host")...)
+		log.Printf("INFO: Using bearer tokens printed by --token-command")
+	} else if endpoint := viper.GetString("token-url"); endpoint != "" {
+		c.UseBearerToken(converter.TokenEndpoint(endpoint), viper.GetStringSlice("bearer-host")...)
+		log.Printf("INFO: Using bearer tokens from --token-url")
+	}
+	if path := viper.GetString("output-single-json"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create JSON output file: %v\n", err)
+			exitFunc(1)
+			return
+		}
+		defer f.Close()
+		c.SingleJSON = f
+		c.PreserveOrder = viper.GetBool("preserve-order")
+	}
+	if path := viper.GetString("zim"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create ZIM archive: %v\n", err)
+			exitFunc(1)
+			return
+		}
+		defer f.Close()
+		c.ZIM = f
+		c.ZIMTitle = viper.GetString("zim-title")
+	}
+	log.Printf("INFO: Processing up to %d pages at a time (at most %.1f MB of page bodies in memory)",
+		c.Concurrency, float64(c.MemoryCeiling(total))/(1<<20))
+	// Ctrl+C stops starting pages; a second one quits at once, as stop restores
+	// the default handling
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			log.Printf("WARNING: Interrupted; finishing the pages in progress (press Ctrl+C again to quit now)")
+		case <-finished:
+		}
+	}()
+	// On a terminal, a progress bar takes the place of a line per converted
+	// page; failures are still logged, above the bar
+	var bar *progressBar
+	if !viper.GetBool("no-progress") && isTerminal(os.Stdout) {
+		logs := log.Writer()
+		bar = newProgressBar(os.Stdout, logs, total)
+		log.SetOutput(bar)
+		defer log.SetOutput(logs)
+	}
+	var resultsChan <-chan converter.Result
+	var summaryChan <-chan converter.Summary
+	if list != nil {
+		input := make(chan string)
+		go list.send(input)
+		resultsChan, summaryChan = c.ConvertFrom(ctx, input, total, sel)
+	} else {
+		resultsChan, summaryChan = c.ConvertContext(ctx, urls, sel)
 	}
-	resultsChan, summaryChan := c.Convert(urls, sel)
 
 	// Process results as they come in
+	var written []string
+	seenFiles := make(map[string]bool) // Combined pages share a file
 	for result := range resultsChan {
+		if bar != nil {
+			bar.record(result)
+		}
 		if result.IsSuccess {
+			for _, name := range resultFiles(result) {
+				if !seenFiles[name] {
+					seenFiles[name] = true
+					written = append(written, name)
+				}
+			}
 			// The file is already written by the converter. We just log it.
-			log.Printf("INFO: Successfully converted: %s -> %s", result.URL, filepath.Join(c.OutputDir, result.FileName))
+			if bar == nil {
+				log.Printf("INFO: Successfully converted: %s -> %s", result.URL, filepath.Join(c.OutputDir, result.FileName))
+			}
+		} else if result.Skipped {
+			if bar == nil {
+				log.Printf("INFO: Skipped %s: %s", result.URL, result.Error)
+			}
 		} else {
 			log.Printf("ERROR: Failed to process %s: %s", result.URL, result.Error)
 		}
 	}
+	if bar != nil {
+		bar.finish()
+		log.SetOutput(bar.logs)
+	}
 
 	// Wait for and print the final summary
 	summary := <-summaryChan
-	log.Printf("INFO: Conversion complete.")
+	if summary.Interrupted {
+		log.Printf("INFO: Conversion interrupted; the files written so far are kept.")
+	} else {
+		log.Printf("INFO: Conversion complete.")
+	}
 	log.Printf("INFO: Total URLs: %d", summary.TotalURLs)
 	log.Printf("INFO: Successful: %d", summary.Successful)
 	log.Printf("INFO: Failed: %d", summary.Failed)
+	if summary.Skipped > 0 {
+		log.Printf("INFO: Skipped: %d", summary.Skipped)
+	}
+	if summary.DNSFailures > 0 {
+		log.Printf("INFO: Host not found: %d", summary.DNSFailures)
+	}
 	if summary.Failed > 0 {
 		log.Printf("INFO: Failed URLs: %s", strings.Join(summary.FailedURLs, ", "))
 	}
+	if summary.Interrupted {
+		log.Printf("INFO: Not started: %d", summary.NotStarted)
+	}
 	log.Printf("INFO: Total processing time: %s", summary.ProcessingTime)
+	if summary.Interrupted {
+		exitFunc(130)
+		return
+	}
+
+	failOnBrokenLinks := viper.GetBool("fail-on-broken-links")
+	if viper.GetBool("check-links") || failOnBrokenLinks {
+		if broken := reportLinks(c, written); broken > 0 && failOnBrokenLinks {
+			exitFunc(1)
+			return
+		}
+	}
+}
+
+// useHostDirs reports whether a run of URLs from hosts distinct hosts is
+// sharded by host by default: they are more than one, and no other arrangement
+// of the files was asked for.
+func useHostDirs(hosts int) bool {
+	if viper.GetBool("no-host-dirs") || viper.GetString("shard") != converter.ShardNone || viper.GetString("layout") != converter.LayoutFlat || viper.GetBool("combine-by-host") {
+		return false
+	}
+	return hosts > 1
+}
+
+// resumeFrom returns the URLs from the first occurrence of from onward.
+func resumeFrom(urls []string, from string) ([]string, error) {
+	for i, u := range urls {
+		if u == from {
+			return urls[i:], nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in the URL list", from)
+}
+
+// reportLinks checks the links in the written files, logs and records the
+// broken ones in the run directory, and returns how many were broken.
+func reportLinks(c *converter.Converter, written []string) int {
+	report, err := c.CheckLinks(written)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return 0
+	}
+	for _, link := range report.Broken {
+		log.Printf("ERROR: Broken link %s in %s: %s", link.URL, strings.Join(link.Files, ", "), link.Error)
+	}
+	log.Printf("INFO: Links checked: %d, broken: %d, skipped: %d", report.Checked, len(report.Broken), report.Skipped)
+	if err := c.WriteLinkReport(report); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	return len(report.Broken)
+}
+
+// convertSettings are the convert flags that validateConvertFlags has parsed.
+type convertSettings struct {
+	workers         int
+	bodyLimit       int64
+	typeLimits      map[string]int64
+	acceptStatus    []int
+	extraMeta       map[string]interface{}
+	modifiedSince   time.Time
+	format          string
+	headings        string
+	emoji           string
+	timestampLayout string
+	render          string
+	browser         string // The Chrome executable with --render js
+	slices          [2]*regexp.Regexp
+	sectionHeading  *regexp.Regexp
+	titleStrip      *regexp.Regexp
+	selectorRules   []converter.SelectorRule
+	regions         []converter.Region
+	inputFormat     string
+	xmlElements     map[string]string
+	resolveHosts    map[string]string
+	userAgents      []string
+	dirPerm         os.FileMode
+	filePerm        os.FileMode
+}
+
+// validateConvertFlags parses and checks the convert flags other than the URL
+// lists' contents, and reports every problem found rather than only the first.
+// It is shared by convert and check.
+func validateConvertFlags() (*convertSettings, []error) {
+	var errs []error
+	settings := &convertSettings{}
+	var err error
+
+	if viper.GetBool("fetch-only") && viper.GetBool("combine-by-host") {
+		errs = append(errs, errors.New("--combine-by-host cannot be used with --fetch-only"))
+	}
+	if shard := viper.GetString("shard"); !converter.IsValidShard(shard) {
+		errs = append(errs, fmt.Errorf("Invalid --shard value '%s' (expected hash or host)", shard))
+	} else if shard != converter.ShardNone && viper.GetBool("combine-by-host") {
+		errs = append(errs, errors.New("--shard cannot be used with --combine-by-host, which already writes one file per host"))
+	} else if shard == converter.ShardHost && viper.GetBool("no-host-dirs") {
+		errs = append(errs, errors.New("--no-host-dirs cannot be used with --shard host"))
+	}
+
+	settings.workers = viper.GetInt("concurrency")
+	if settings.workers < 1 {
+		errs = append(errs, errors.New("--concurrency must be at least 1"))
+	}
+	if viper.GetInt("results-buffer") < 0 {
+		errs = append(errs, errors.New("--results-buffer cannot be negative"))
+	}
+	if viper.GetInt("breaker-threshold") < 0 {
+		errs = append(errs, errors.New("--breaker-threshold cannot be negative"))
+	}
+
+	if settings.bodyLimit, err = converter.ParseByteSize(viper.GetString("max-size")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --max-size: %w", err))
+	}
+	if date := viper.GetString("modified-since"); date != "" {
+		if settings.modifiedSince, err = parseDate(date); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --modified-since: %w", err))
+		} else if viper.GetString("render") == converter.RenderJS {
+			errs = append(errs, errors.New("--modified-since cannot be used with --render js"))
+		}
+	}
+	if settings.extraMeta, err = parseExtraMeta(viper.GetStringSlice("add-meta")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --add-meta: %w", err))
+	}
+	if settings.typeLimits, err = parseTypeSizes(viper.GetStringSlice("max-size-type")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --max-size-type: %w", err))
+	}
+	if settings.acceptStatus, err = parseStatusCodes(viper.GetStringSlice("accept-status")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --accept-status: %w", err))
+	}
+
+	settings.format = viper.GetString("format")
+	if !converter.IsValidFormat(settings.format) {
+		errs = append(errs, fmt.Errorf("Unsupported --format '%s'", settings.format))
+	}
+	errs = append(errs, validateInputFormat(settings)...)
+	if (viper.GetBool("validate-markdown") || viper.GetBool("strict-markdown")) && settings.format != "" && settings.format != converter.FormatMarkdown {
+		errs = append(errs, errors.New("--validate-markdown and --strict-markdown only apply with --format markdown"))
+	}
+	if viper.GetBool("rich-markdown") && settings.format != "" && settings.format != converter.FormatMarkdown {
+		errs = append(errs, errors.New("--rich-markdown only applies with --format markdown"))
+	}
+	errs = append(errs, validateLayout(settings)...)
+	errs = append(errs, validateSplitTokens(settings)...)
+	errs = append(errs, validateZIM()...)
+
+	settings.headings = viper.GetString("heading-style")
+	if settings.headings != converter.HeadingATX && settings.headings != converter.HeadingSetext {
+		errs = append(errs, fmt.Errorf("Invalid --heading-style value '%s' (expected atx or setext)", settings.headings))
+	}
+	if anchors := viper.GetString("anchors"); !converter.IsValidAnchorStyle(anchors) {
+		errs = append(errs, fmt.Errorf("Invalid --anchors value '%s' (expected html or attribute)", anchors))
+	}
+	if depth := viper.GetInt("max-depth-for-headings"); depth < 0 || depth > 6 {
+		errs = append(errs, fmt.Errorf("Invalid --max-depth-for-headings value %d (expected 1 to 6, or 0 for no cap)", depth))
+	}
+	if demote := viper.GetString("demote-headings"); demote != converter.HeadingDemoteBold && demote != converter.HeadingDemoteClamp {
+		errs = append(errs, fmt.Errorf("Invalid --demote-headings value '%s' (expected bold or clamp)", demote))
+	}
+
+	settings.emoji = viper.GetString("emoji")
+	if settings.emoji != converter.EmojiKeep && settings.emoji != converter.EmojiShortcode {
+		errs = append(errs, fmt.Errorf("Invalid --emoji value '%s' (expected keep or shortcode)", settings.emoji))
+	}
+
+	if settings.timestampLayout, err = converter.TimestampLayout(viper.GetString("timestamp-format")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --timestamp-format: %w", err))
+	}
+	if algorithm := viper.GetString("content-hash"); !converter.IsValidHashAlgorithm(algorithm) {
+		errs = append(errs, fmt.Errorf("Invalid --content-hash value '%s' (expected sha256, sha512, sha1 or md5)", algorithm))
+	}
+	if base := viper.GetString("link-base"); !converter.IsValidLinkBase(base) {
+		errs = append(errs, fmt.Errorf("Invalid --link-base value '%s' (expected auto, request, canonical or base)", base))
+	} else if base != converter.LinkBaseNone && viper.GetBool("fetch-only") {
+		errs = append(errs, errors.New("--link-base cannot be used with --fetch-only, which saves pages as they are"))
+	}
+
+	settings.render = viper.GetString("render")
+	switch settings.render {
+	case converter.RenderStatic:
+	case converter.RenderJS:
+		// Fail before creating any output rather than once per page
+		if settings.browser, err = converter.FindBrowser(viper.GetString("browser")); err != nil {
+			errs = append(errs, fmt.Errorf("%w (install it or set --browser)", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("Invalid --render value '%s' (expected static or js)", settings.render))
+	}
+	if viper.GetString("wait-for") != "" && settings.render != converter.RenderJS {
+		errs = append(errs, errors.New("--wait-for only applies with --render js"))
+	}
+	if viper.GetString("har") != "" {
+		// The recorded responses replace the network
+		if len(viper.GetStringSlice("file")) > 0 {
+			errs = append(errs, errors.New("--file cannot be used with --har"))
+		}
+		if settings.render == converter.RenderJS {
+			errs = append(errs, errors.New("--render js cannot be used with --har"))
+		}
+		if viper.GetString("resolver") != "" || len(viper.GetStringSlice("resolve")) > 0 {
+			errs = append(errs, errors.New("--resolver and --resolve cannot be used with --har"))
+		}
+	}
+
+	if viper.GetString("token-command") != "" || viper.GetString("token-url") != "" {
+		if viper.GetString("token-command") != "" && viper.GetString("token-url") != "" {
+			errs = append(errs, errors.New("--token-command cannot be used with --token-url"))
+		}
+		if viper.GetString("digest-user") != "" {
+			errs = append(errs, errors.New("--token-command and --token-url cannot be used with --digest-user"))
+		}
+		if settings.render == converter.RenderJS {
+			errs = append(errs, errors.New("--token-command and --token-url cannot be used with --render js"))
+		}
+	} else if len(viper.GetStringSlice("bearer-host")) > 0 {
+		errs = append(errs, errors.New("--bearer-host only applies with --token-command or --token-url"))
+	}
+	if viper.GetString("digest-user") == "" && len(viper.GetStringSlice("digest-host")) > 0 {
+		errs = append(errs, errors.New("--digest-host only applies with --digest-user"))
+	}
+	if endpoint := viper.GetString("token-url"); endpoint != "" {
+		if !isRemoteFile(endpoint) {
+			errs = append(errs, fmt.Errorf("Invalid --token-url: %q is not an http(s) URL", endpoint))
+		}
+	}
+
+	for i, name := range []string{"slice-start", "slice-end"} {
+		if pattern := viper.GetString(name); pattern != "" {
+			if settings.slices[i], err = regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("Invalid --%s: %w", name, err))
+			}
+		}
+	}
+
+	if text := viper.GetString("contains-heading"); text != "" {
+		pattern := regexp.QuoteMeta(text)
+		if viper.GetBool("heading-regex") {
+			pattern = text
+		}
+		if settings.sectionHeading, err = regexp.Compile("(?i)" + pattern); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --contains-heading: %w", err))
+		}
+	} else if viper.GetBool("heading-regex") {
+		errs = append(errs, errors.New("--heading-regex requires --contains-heading"))
+	}
+	if sel := viper.GetString("title-selector"); sel != "" {
+		if err := converter.ValidateSelector(sel); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --title-selector: %w", err))
+		}
+	}
+	if sel := viper.GetString("skip-selector"); sel != "" {
+		if err := converter.ValidateSelector(sel); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --skip-selector: %w", err))
+		}
+	}
+	if pattern := viper.GetString("title-strip"); pattern != "" {
+		if settings.titleStrip, err = regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --title-strip: %w", err))
+		}
+	}
+	for _, entry := range viper.GetStringSlice("selector-rule") {
+		rule, err := converter.ParseSelectorRule(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --selector-rule: %w", err))
+			continue
+		}
+		settings.selectorRules = append(settings.selectorRules, rule)
+	}
+	if len(settings.selectorRules) > 0 && viper.GetBool("fetch-only") {
+		errs = append(errs, errors.New("--selector-rule cannot be used with --fetch-only"))
+	}
+
+	names := make(map[string]bool)
+	for _, entry := range viper.GetStringSlice("region") {
+		region, err := converter.ParseRegion(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --region: %w", err))
+			continue
+		}
+		if names[region.Name] {
+			errs = append(errs, fmt.Errorf("Invalid --region: '%s' is given twice", region.Name))
+		}
+		names[region.Name] = true
+		settings.regions = append(settings.regions, region)
+	}
+	if len(viper.GetStringSlice("region")) > 0 {
+		switch {
+		case viper.GetString("selector") != "":
+			errs = append(errs, errors.New("--region cannot be used with --selector; each region has its own selector"))
+		case len(settings.selectorRules) > 0:
+			errs = append(errs, errors.New("--region cannot be used with --selector-rule"))
+		case viper.GetBool("fetch-only"), viper.GetBool("combine-by-host"):
+			errs = append(errs, errors.New("--region cannot be used with --fetch-only or --combine-by-host"))
+		}
+	}
+
+	if viper.GetString("selector-attr") != "" {
+		if viper.GetString("contains-heading") != "" {
+			errs = append(errs, errors.New("--selector-attr cannot be used with --contains-heading"))
+		}
+		if viper.GetBool("fetch-only") {
+			errs = append(errs, errors.New("--selector-attr cannot be used with --fetch-only"))
+		}
+	}
+
+	if settings.userAgents, err = loadUserAgents(viper.GetStringSlice("user-agent"), viper.GetString("user-agent-file")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --user-agent-file: %w", err))
+	}
+	switch rotation := viper.GetString("user-agent-rotation"); rotation {
+	case converter.RotateRoundRobin, converter.RotateRandom:
+	default:
+		errs = append(errs, fmt.Errorf("Invalid --user-agent-rotation '%s' (expected round-robin or random)", rotation))
+	}
+
+	if server := viper.GetString("resolver"); server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --resolver: %w", err))
+		}
+	}
+	if settings.resolveHosts, err = parseResolveHosts(viper.GetStringSlice("resolve")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --resolve: %w", err))
+	}
+
+	if settings.dirPerm, err = parseFileMode(viper.GetString("dir-mode")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --dir-mode: %w", err))
+	}
+	if settings.filePerm, err = parseFileMode(viper.GetString("file-mode")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --file-mode: %w", err))
+	}
+
+	// File existence and readability check
+	for _, file := range viper.GetStringSlice("file") {
+		if isRemoteFile(file) {
+			continue // Fetched while loading
+		}
+		if stat, err := os.Stat(file); err != nil || stat.IsDir() {
+			errs = append(errs, fmt.Errorf("Input file not found at '%s'", file))
+		}
+	}
+	return settings, errs
+}
+
+// maxURLLine is the longest line read from a URL file.
+const maxURLLine = 1 << 20
+
+// urlList is the URLs of the --file lists of a run, read twice rather than
+// held whole: openURLList scans them to count the URLs, note their explicit
+// filenames and hosts and find the --resume-from URL, and send scans them again
+// to hand each URL to the converter as a worker frees up. Lists given as http(s)
+// URLs are fetched once and kept, as they are limited to the --max-size limit.
+//
+// A URL listed more than once is only converted once; its first explicit
+// filename wins. What a run still holds in proportion to its list is:
+//   - the set of every distinct URL that tells repeats apart, of 16-byte
+//     digests rather than the URLs: about 40 bytes a URL, so a list of ten
+//     million URLs takes some 400 MB while it is read;
+//   - fileNames, the URLs that have an explicit filename, with it;
+//   - the URLs that fail, listed in the summary; and
+//   - with --manifest, --index, --sitemap or --combine-by-host, a result for
+//     every page, and with --zim every URL.
+type urlList struct {
+	files          []string
+	remote         map[string][]byte // The fetched lists, by URL
+	expand, strict bool
+	from           string // The URL to start from, empty for the first
+
+	count     int               // The URLs from the start on
+	skipped   int               // The URLs before the start
+	fileNames map[string]string // Explicit filenames, for the URLs that have one
+	hosts     map[string]bool   // The hosts of the URLs from the start on
+}
+
+// openURLList reads the URL files in order, starting from the first
+// occurrence of from when it is set. Files given as http(s) URLs are fetched,
+// limited to maxSize bytes. With expand, environment variables are expanded
+// first; see expandURLLine.
+func openURLList(files []string, maxSize int64, expand, strict bool, from string) (*urlList, error) {
+	l := &urlList{files: files, remote: make(map[string][]byte), expand: expand, strict: strict, from: from, fileNames: make(map[string]string), hosts: make(map[string]bool)}
+	for _, file := range files {
+		if !isRemoteFile(file) {
+			continue
+		}
+		data, err := converter.FetchURLList(file, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", file, err)
+		}
+		l.remote[file] = data
+	}
+	started := from == ""
+	err := l.scan(true, func(u, name string, first bool) {
+		if name != "" && l.fileNames[u] == "" {
+			l.fileNames[u] = name
+		}
+		if !first {
+			return
+		}
+		if !started && u == from {
+			started = true
+		}
+		if !started {
+			l.skipped++
+			return
+		}
+		l.count++
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			l.hosts[strings.ToLower(parsed.Host)] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		return nil, fmt.Errorf("Invalid --resume-from: %s is not in the URL list", from)
+	}
+	return l, nil
+}
+
+// send sends the URLs from the start on to urls, each once, and closes it.
+// The files are read again; one that can no longer be read ends the list early.
+func (l *urlList) send(urls chan<- string) {
+	defer close(urls)
+	started := l.from == ""
+	err := l.scan(false, func(u, _ string, first bool) {
+		if started = started || u == l.from; started && first {
+			urls <- u
+		}
+	})
+	if err != nil {
+		log.Printf("ERROR: Stopped reading the URL files: %v", err)
+	}
+}
+
+// scan calls fn with each URL in the files, in order, its explicit filename,
+// if any, and whether it is the first occurrence of the URL. Warnings about
+// the lines are logged when warn is set.
+func (l *urlList) scan(warn bool, fn func(u, name string, first bool)) error {
+	seen := make(map[[16]byte]bool)
+	each := func(u, name string) {
+		sum := sha256.Sum256([]byte(u))
+		key := [16]byte(sum[:16])
+		fn(u, name, !seen[key])
+		seen[key] = true
+	}
+	for _, file := range l.files {
+		if err := l.scanFile(file, warn, each); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFile calls fn with each URL listed in file and its explicit filename.
+func (l *urlList) scanFile(file string, warn bool, fn func(u, name string)) error {
+	if data, ok := l.remote[file]; ok {
+		return scanURLList(bytes.NewReader(data), file, l.expand, l.strict, warn, fn)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	defer f.Close()
+	return scanURLList(f, file, l.expand, l.strict, warn, fn)
+}
+
+// scanURLList reads a URL file from r. Each non-empty line holds a URL,
+// optionally followed by a TAB and the output filename to use for that URL;
+// fn is called with each in input order. file names the list in errors, and
+// in the warnings about undefined variables logged when warn is set.
+func scanURLList(r io.Reader, file string, expand, strict, warn bool, fn func(u, name string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxURLLine)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if expand {
+			var err error
+			if line, err = expandURLLine(line, file, lineNo, strict, warn); err != nil {
+				return err
+			}
+		}
+		url, name, _ := strings.Cut(line, "\t")
+		if url = strings.TrimSpace(url); url != "" {
+			fn(url, strings.TrimSpace(name))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("failed to read '%s': a line is longer than %d bytes", file, maxURLLine)
+		}
+		return fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	return nil
+}
+
+// isRemoteFile reports whether a --file value is an http(s) URL rather than a path.
+func isRemoteFile(file string) bool {
+	lower := strings.ToLower(file)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// expandURLLine expands $VAR and ${VAR} references in a line of a URL file
+// from the environment. Undefined variables expand to empty, with a warning if
+// warn is set, or are an error naming the file and line when strict is set.
+func expandURLLine(line, file string, lineNo int, strict, warn bool) (string, error) {
+	var undefined []string
+	expanded := os.Expand(line, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		if strict {
+			return "", fmt.Errorf("%s:%d: undefined environment variable %s", file, lineNo, strings.Join(undefined, ", "))
+		}
+		if warn {
+			log.Printf("WARNING: %s:%d: undefined environment variable %s expanded to empty", file, lineNo, strings.Join(undefined, ", "))
+		}
+	}
+	return expanded, nil
+}
+
+// loadUserAgents returns the user agents given as flags followed by those in
+// file, one per non-empty line.
+func loadUserAgents(agents []string, file string) ([]string, error) {
+	var pool []string
+	for _, agent := range agents {
+		if agent = strings.TrimSpace(agent); agent != "" {
+			pool = append(pool, agent)
+		}
+	}
+	if file == "" {
+		return pool, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			pool = append(pool, line)
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("%s lists no user agents", file)
+	}
+	return pool, nil
+}
+
+// parseResolveHosts parses host=ip overrides into a map from host to IP.
+func parseResolveHosts(entries []string) (map[string]string, error) {
+	hosts := make(map[string]string)
+	for _, entry := range entries {
+		host, ip, ok := strings.Cut(entry, "=")
+		host, ip = strings.TrimSpace(host), strings.TrimSpace(ip)
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("'%s' is not host=ip", entry)
+		}
+		hosts[strings.ToLower(host)] = ip
+	}
+	return hosts, nil
+}
 
+// dateLayouts are the layouts parseDate accepts, tried in order.
+var dateLayouts = []string{"2006-01-02", time.RFC3339, http.TimeFormat}
+
+// parseDate parses a date given on the command line. A date without a time is
+// midnight UTC.
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not a date such as 2025-08-10, 2025-08-10T18:00:00Z or an HTTP date", s)
+}
+
+// parseExtraMeta parses key=value pairs into frontmatter fields. A value in
+// brackets, such as [imported, docs], is a list. The fields every run sets
+// itself cannot be given.
+func parseExtraMeta(entries []string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("'%s' is not key=value", entry)
+		}
+		if key == "source" || key == "retrieved_at" {
+			return nil, fmt.Errorf("'%s' is always set by the converter", key)
+		}
+		if inner, isList := strings.CutPrefix(value, "["); isList && strings.HasSuffix(inner, "]") {
+			list := []string{}
+			for _, item := range strings.Split(strings.TrimSuffix(inner, "]"), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			fields[key] = list
+			continue
+		}
+		fields[key] = value
+	}
+	return fields, nil
+}
+
+// parseTypeSizes parses type=size pairs into body limits keyed by lowercased
+// media type.
+func parseTypeSizes(entries []string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, entry := range entries {
+		mediaType, size, ok := strings.Cut(entry, "=")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if !ok || !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("'%s' is not type=size", entry)
+		}
+		limit, err := converter.ParseByteSize(strings.TrimSpace(size))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mediaType, err)
+		}
+		limits[mediaType] = limit
+	}
+	return limits, nil
+}
+
+// validateLayout checks --layout and the flags it cannot be combined with:
+// the layouts place each page's file themselves, in Markdown.
+func validateLayout(settings *convertSettings) []error {
+	layout := viper.GetString("layout")
+	if layout == converter.LayoutFlat {
+		return nil
+	}
+	if !converter.IsValidLayout(layout) {
+		return []error{fmt.Errorf("Invalid --layout value '%s' (expected hugo or jekyll)", layout)}
+	}
+	var errs []error
+	if settings.format != "" && settings.format != converter.FormatMarkdown {
+		errs = append(errs, errors.New("--layout only applies with --format markdown"))
+	}
+	if viper.GetString("shard") != converter.ShardNone {
+		errs = append(errs, errors.New("--layout cannot be used with --shard"))
+	}
+	for _, name := range []string{"combine-by-host", "fetch-only"} {
+		if viper.GetBool(name) {
+			errs = append(errs, fmt.Errorf("--layout cannot be used with --%s", name))
+		}
+	}
+	if len(viper.GetStringSlice("region")) > 0 {
+		errs = append(errs, errors.New("--layout cannot be used with --region"))
+	}
+	return errs
+}
+
+// validateSplitTokens checks --split-tokens and the flags it cannot be
+// combined with: parts are split from the Markdown written for one page.
+func validateSplitTokens(settings *convertSettings) []error {
+	limit := viper.GetInt("split-tokens")
+	if limit == 0 {
+		return nil
+	}
+	if limit < 0 {
+		return []error{errors.New("--split-tokens cannot be negative")}
+	}
+	var errs []error
+	if settings.format != "" && settings.format != converter.FormatMarkdown {
+		errs = append(errs, errors.New("--split-tokens only applies with --format markdown"))
+	}
+	for _, name := range []string{"combine-by-host", "fetch-only"} {
+		if viper.GetBool(name) {
+			errs = append(errs, fmt.Errorf("--split-tokens cannot be used with --%s", name))
+		}
+	}
+	if viper.GetString("layout") != converter.LayoutFlat {
+		errs = append(errs, errors.New("--split-tokens cannot be used with --layout"))
+	}
+	if len(viper.GetStringSlice("region")) > 0 {
+		errs = append(errs, errors.New("--split-tokens cannot be used with --region"))
+	}
+	return errs
+}
+
+// validateZIM checks --zim and the flags it cannot be combined with: the
+// archive holds the extracted HTML of one page per file written.
+func validateZIM() []error {
+	if viper.GetString("zim") == "" {
+		if viper.GetString("zim-title") != "" {
+			return []error{errors.New("--zim-title only applies with --zim")}
+		}
+		return nil
+	}
+	var errs []error
+	for _, name := range []string{"combine-by-host", "fetch-only"} {
+		if viper.GetBool(name) {
+			errs = append(errs, fmt.Errorf("--zim cannot be used with --%s", name))
+		}
+	}
+	if len(viper.GetStringSlice("region")) > 0 {
+		errs = append(errs, errors.New("--zim cannot be used with --region"))
+	}
+	if viper.GetString("selector-attr") != "" {
+		errs = append(errs, errors.New("--zim cannot be used with --selector-attr"))
+	}
+	return errs
+}
+
+// parseStatusCodes parses HTTP status codes that may be accepted in place of
+// a 200. Informational and redirect codes are refused, as those responses
+// have no page of their own.
+func parseStatusCodes(entries []string) ([]int, error) {
+	var codes []int
+	for _, entry := range entries {
+		code, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("'%s' is not an HTTP status code", entry)
+		}
+		if code >= 300 && code < 400 {
+			return nil, fmt.Errorf("%d is a redirect; redirects are followed", code)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// validateInputFormat checks --input-format and the flags that depend on it.
+// An XML run selects with an XML path instead of CSS selectors, so the flags
+// built on those are refused.
+func validateInputFormat(settings *convertSettings) []error {
+	var errs []error
+	settings.inputFormat = viper.GetString("input-format")
+	if !converter.IsValidInputFormat(settings.inputFormat) {
+		return append(errs, fmt.Errorf("Unsupported --input-format '%s' (expected html or xml)", settings.inputFormat))
+	}
+	if settings.inputFormat != converter.InputXML {
+		if len(viper.GetStringSlice("xml-element")) > 0 {
+			errs = append(errs, errors.New("--xml-element only applies with --input-format xml"))
+		}
+		return errs
+	}
+
+	if _, err := converter.ParseXMLPath(viper.GetString("selector")); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid --selector: %w", err))
+	}
+	for _, entry := range viper.GetStringSlice("xml-element") {
+		name, target, err := converter.ParseXMLElement(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid --xml-element: %w", err))
+			continue
+		}
+		if settings.xmlElements == nil {
+			settings.xmlElements = make(map[string]string)
+		}
+		settings.xmlElements[name] = target
+	}
+	for _, name := range []string{"selector-rule", "region"} {
+		if len(viper.GetStringSlice(name)) > 0 {
+			errs = append(errs, fmt.Errorf("--%s cannot be used with --input-format xml", name))
+		}
+	}
+	for _, name := range []string{"selector-attr", "breadcrumb-selector", "title-selector", "skip-selector"} {
+		if viper.GetString(name) != "" {
+			errs = append(errs, fmt.Errorf("--%s cannot be used with --input-format xml", name))
+		}
+	}
+	if viper.GetBool("follow-iframes") {
+		errs = append(errs, errors.New("--follow-iframes cannot be used with --input-format xml"))
+	}
+	if viper.GetString("render") == converter.RenderJS {
+		errs = append(errs, errors.New("--render js cannot be used with --input-format xml"))
+	}
+	return errs
+}
+
+// parseFileMode parses permission bits written in octal, such as 0775 or 700.
+func parseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty mode")
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("'%s' is not an octal permission between 000 and 777", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// requireEmptyDir returns an error unless dir is an empty directory or does
+// not exist yet.
+func requireEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read output directory: %w", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("output directory %s is not empty: it holds %s", dir, entries[0].Name())
+	default:
+		return fmt.Errorf("output directory %s is not empty: it holds %s and %d more", dir, entries[0].Name(), len(entries)-1)
+	}
 }
 
 // createRunOutputDir creates a unique, timestamped directory for each execution run
-// with format YYYYMMDDHHMMSS. If directory exists, it removes and recreates it.
-func createRunOutputDir(parentDir string) (string, error) {
+// with format YYYYMMDDHHMMSS and the given permissions. If directory exists, it
+// removes and recreates it.
+func createRunOutputDir(parentDir string, perm os.FileMode) (string, error) {
 	// Generate timestamp in format: 20060102150405
 	timestamp := time.Now().Format("20060102150405")
 	dirName := timestamp
 	fullPath := filepath.Join(parentDir, dirName)
 
 	// Ensure parent directory exists
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
+	if err := os.MkdirAll(parentDir, perm); err != nil {
 		return "", fmt.Errorf("failed to create parent directory: %w", err)
 	}
 
@@ -144,9 +1451,13 @@ func createRunOutputDir(parentDir string) (string, error) {
 	}
 
 	// Create the directory
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
+	if err := os.MkdirAll(fullPath, perm); err != nil {
 		return "", fmt.Errorf("failed to create run directory: %w", err)
 	}
+	// Unlike MkdirAll, Chmod is not limited by the umask
+	if err := os.Chmod(fullPath, perm); err != nil {
+		return "", fmt.Errorf("failed to set run directory permissions: %w", err)
+	}
 
 	return fullPath, nil
 }
@@ -5,17 +5,94 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"doc-converter/pkg/converter"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
 )
 
+// resetConvertFlags restores every convert flag to its default so that tests
+// don't leak settings into each other through Cobra's global state.
+func resetConvertFlags() {
+	convertCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
+// executeConvert runs the convert command with args and returns the run directory it created.
+func executeConvert(t *testing.T, outputDir string, args ...string) string {
+	t.Helper()
+	t.Cleanup(func() { os.RemoveAll(outputDir) })
+
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = append([]string{"doc-converter", "convert", "--output", outputDir}, args...)
+
+	resetConvertFlags()
+	Execute()
+
+	dirs, err := os.ReadDir(outputDir)
+	require.NoError(t, err, "failed to read output directory after conversion")
+	require.Len(t, dirs, 1, "expected exactly one run directory in output")
+	return filepath.Join(outputDir, dirs[0].Name())
+}
+
+// writeURLFile writes a temporary URL list for a test.
+func writeURLFile(t *testing.T, name, content string) string {
+	t.Helper()
+	require.NoError(t, os.WriteFile(name, []byte(content), 0644), "could not create temp urls file")
+	t.Cleanup(func() { os.Remove(name) })
+	return name
+}
+
+// titledPageServer serves a page titled "Page <path>" for every request path.
+func titledPageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Content of %s</p></main></body></html>", name, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// listFiles returns the names of the files in dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
 //--- CLI behavior tests (Cobra) ---//
 
 // Must be run single-threaded: Cobra uses global state!
@@ -58,7 +135,7 @@ func TestCLI_Convert_Successful(t *testing.T) {
 	}
 
 	// Reset package-global flags before CLI use
-	filePath = ""
+	filePaths = nil
 	selector = ""
 	output = ""
 
@@ -118,10 +195,6 @@ func TestCLI_Convert_MissingFlag_Error(t *testing.T) {
 			name: "missing file flag",
 			args: []string{"doc-converter", "convert", "--selector", "main"},
 		},
-		{
-			name: "missing selector flag",
-			args: []string{"doc-converter", "convert", "--file", "urls.txt"},
-		},
 		{
 			name: "missing both flags",
 			args: []string{"doc-converter", "convert"},
@@ -131,7 +204,7 @@ func TestCLI_Convert_MissingFlag_Error(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			os.Args = tc.args
-			filePath = ""
+			filePaths = nil
 			selector = ""
 			output = "" // Reset output flag
 
@@ -161,7 +234,7 @@ func TestCLI_Convert_InvalidFilePath_Error(t *testing.T) {
 		"--selector", "main",
 	}
 
-	filePath = ""
+	filePaths = nil
 	selector = ""
 	output = "" // Reset output flag
 
@@ -238,7 +311,7 @@ func TestCLI_Convert_MarkdownOutput_Successful(t *testing.T) {
 	}
 
 	// Reset package-global flags before CLI use
-	filePath = ""
+	filePaths = nil
 	selector = ""
 	output = ""
 
@@ -302,3 +375,796 @@ This is some test content.
 [A link](https://example.com/link)`
 	assert.Equal(t, expectedBody, body, "markdown body content mismatch")
 }
+
+func TestCLI_Convert_NamedAndUnnamedLines(t *testing.T) {
+	server := titledPageServer(t)
+	urlsPath := writeURLFile(t, "testurls_named.txt",
+		server.URL+"/one\tcustom_name.md\n"+server.URL+"/two\n")
+
+	runDir := executeConvert(t, "test_output_named", "--file", urlsPath, "--selector", "main")
+
+	assert.ElementsMatch(t, []string{"custom_name.md", "page_two.md"}, listFiles(t, runDir))
+}
+
+func TestCLI_Convert_MultipleInputFiles(t *testing.T) {
+	server := titledPageServer(t)
+	first := writeURLFile(t, "testurls_first.txt", server.URL+"/one\n"+server.URL+"/two\n")
+	second := writeURLFile(t, "testurls_second.txt", server.URL+"/two\n"+server.URL+"/three\n")
+
+	runDir := executeConvert(t, "test_output_multi", "--file", first, "--file", second, "--selector", "main")
+
+	assert.ElementsMatch(t, []string{"page_one.md", "page_two.md", "page_three.md"}, listFiles(t, runDir))
+}
+
+func TestOpenURLList_MissingFileNamed(t *testing.T) {
+	existing := writeURLFile(t, "testurls_present.txt", "https://example.com\n")
+
+	_, err := openURLList([]string{existing, "testurls_missing.txt"}, converter.DefaultMaxBodySize, false, false, "")
+	assert.ErrorContains(t, err, "testurls_missing.txt")
+}
+
+func TestCLI_Convert_FetchOnly(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_fetch_only.txt", server.URL+"/raw\n")
+
+	// No --selector: it is optional when nothing is extracted
+	runDir := executeConvert(t, "test_output_fetch_only", "--file", urlFile, "--fetch-only")
+	assert.ElementsMatch(t, []string{"page_raw.html", "page_raw.yaml"}, listFiles(t, runDir))
+
+	body, err := os.ReadFile(filepath.Join(runDir, "page_raw.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "<html><head><title>Page raw</title></head><body><main><p>Content of raw</p></main></body></html>", string(body))
+
+	sidecar, err := os.ReadFile(filepath.Join(runDir, "page_raw.yaml"))
+	require.NoError(t, err)
+	var metadata map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(sidecar, &metadata))
+	assert.Equal(t, server.URL+"/raw", metadata["source"])
+	assert.Equal(t, "Page raw", metadata["title"])
+	assert.Contains(t, metadata, "retrieved_at")
+}
+
+func TestCLI_Convert_WithoutSelector_ConvertsWholePage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>Whole</title></head><body><nav><a href="/">Home</a></nav><h1>Hello</h1><p>All of it.</p><script>x()</script></body></html>`)
+	}))
+	defer server.Close()
+	urlFile := writeURLFile(t, "testurls_whole.txt", server.URL+"\n")
+
+	runDir := executeConvert(t, "test_output_whole", "--file", urlFile)
+
+	content, err := os.ReadFile(filepath.Join(runDir, "whole.md"))
+	require.NoError(t, err)
+	parts := strings.SplitN(string(content), "---\n", 3)
+	require.Len(t, parts, 3)
+	assert.Equal(t, "\n# Hello\n\nAll of it.", parts[2])
+}
+
+func TestCLI_Convert_Cookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123", Path: "/"})
+		} else if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc123" {
+			http.Error(w, "no session", http.StatusForbidden)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Content</p></main></body></html>", name)
+	}))
+	defer server.Close()
+	// One worker fetches the pages in input order, so /login comes first
+	urlFile := writeURLFile(t, "testurls_cookies.txt", server.URL+"/login\n"+server.URL+"/private\n")
+
+	runDir := executeConvert(t, "test_output_no_cookies", "--file", urlFile, "--selector", "main", "--concurrency", "1")
+	assert.ElementsMatch(t, []string{"page_login.md"}, listFiles(t, runDir), "without a jar the session is lost")
+
+	runDir = executeConvert(t, "test_output_cookies", "--file", urlFile, "--selector", "main", "--concurrency", "1", "--cookies")
+	assert.ElementsMatch(t, []string{"page_login.md", "page_private.md"}, listFiles(t, runDir))
+}
+
+func TestCLI_Convert_PermissionModes(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_modes.txt", server.URL+"/shared\n")
+
+	// Group write is normally stripped by the umask, so this checks the modes are forced
+	runDir := executeConvert(t, "test_output_modes", "--file", urlFile, "--selector", "main",
+		"--dir-mode", "0770", "--file-mode", "0660", "--manifest")
+
+	info, err := os.Stat(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0770), info.Mode().Perm())
+
+	for _, name := range []string{"page_shared.md", "manifest.json"} {
+		info, err = os.Stat(filepath.Join(runDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0660), info.Mode().Perm(), name)
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	for input, expected := range map[string]os.FileMode{"0755": 0755, "700": 0700, "0664": 0664} {
+		mode, err := parseFileMode(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, mode, input)
+	}
+	for _, input := range []string{"", "0789", "rwxr-xr-x", "1777", "-1"} {
+		_, err := parseFileMode(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseStatusCodes(t *testing.T) {
+	codes, err := parseStatusCodes([]string{"203", " 226", "404"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{203, 226, 404}, codes)
+	for _, input := range []string{"ok", "99", "301", "600"} {
+		_, err := parseStatusCodes([]string{input})
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCLI_Convert_CombineByHost(t *testing.T) {
+	server := titledPageServer(t)
+	// The same server under two host names stands in for two sites
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	hostA := fmt.Sprintf("http://127.0.0.1:%d", port)
+	hostB := fmt.Sprintf("http://localhost:%d", port)
+	urlFile := writeURLFile(t, "testurls_combine.txt", hostA+"/one\n"+hostB+"/two\n"+hostA+"/three\n")
+
+	runDir := executeConvert(t, "test_output_combine", "--file", urlFile, "--selector", "main", "--combine-by-host", "--manifest")
+
+	fileA := fmt.Sprintf("127.0.0.1_%d.md", port)
+	fileB := fmt.Sprintf("localhost_%d.md", port)
+	assert.ElementsMatch(t, []string{fileA, fileB, "manifest.json"}, listFiles(t, runDir))
+
+	content, err := os.ReadFile(filepath.Join(runDir, fileA))
+	require.NoError(t, err)
+	parts := strings.SplitN(string(content), "---\n", 3)
+	require.Len(t, parts, 3)
+
+	var metadata map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(parts[1]), &metadata))
+	assert.Equal(t, []interface{}{hostA + "/one", hostA + "/three"}, metadata["sources"])
+	assert.Equal(t, fmt.Sprintf("\n# Page one\n\n[%[1]s/one](%[1]s/one)\n\nContent of one\n\n# Page three\n\n[%[1]s/three](%[1]s/three)\n\nContent of three", hostA), parts[2],
+		"pages are sections in input order")
+
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	require.Len(t, m.Results, 3)
+	assert.Equal(t, fileB, m.Results[1].FileName)
+	assert.Equal(t, "Page two", m.Results[1].Section)
+}
+
+func TestCLI_Convert_ExpandEnv(t *testing.T) {
+	server := titledPageServer(t)
+	t.Setenv("DC_TEST_BASE", server.URL)
+	urlFile := writeURLFile(t, "testurls_env.txt", "${DC_TEST_BASE}/intro\n${DC_TEST_UNDEFINED}/missing\n")
+
+	// The undefined variable expands to empty, leaving a URL that fails on its own
+	runDir := executeConvert(t, "test_output_env", "--file", urlFile, "--selector", "main", "--expand-env", "--manifest")
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Summary.Successful)
+	assert.Equal(t, []string{"/missing"}, m.Summary.FailedURLs)
+	assert.Contains(t, listFiles(t, runDir), "page_intro.md")
+}
+
+func TestScanURLList_Expand(t *testing.T) {
+	t.Setenv("DC_TEST_BASE", "https://staging.example.com")
+	data := "${DC_TEST_BASE}/docs/intro\thome.md\n$DC_TEST_BASE/about\n${DC_TEST_UNDEFINED}/docs\n"
+
+	var listed []string
+	err := scanURLList(strings.NewReader(data), "urls.txt", true, false, true, func(u, name string) {
+		listed = append(listed, u+"|"+name)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://staging.example.com/docs/intro|home.md", "https://staging.example.com/about|", "/docs|"}, listed)
+
+	err = scanURLList(strings.NewReader(data), "urls.txt", true, true, true, func(u, name string) {})
+	assert.EqualError(t, err, "urls.txt:3: undefined environment variable DC_TEST_UNDEFINED")
+}
+
+func TestOpenURLList_LargeFile(t *testing.T) {
+	const n = 200000
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "  https://example.com/page/%d \r\n", i)
+		if i%1000 == 0 {
+			fmt.Fprintf(&b, "\n\t\nhttps://example.com/page/0\n") // Blank lines and a repeat
+		}
+	}
+	fmt.Fprintf(&b, "https://example.com/%s\tlong.md", strings.Repeat("x", 100000)) // Longer than bufio's default token
+	file := writeURLFile(t, "testurls_large.txt", b.String())
+
+	list, err := openURLList([]string{file}, converter.DefaultMaxBodySize, false, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, n+1, list.count)
+	assert.Equal(t, map[string]bool{"example.com": true}, list.hosts)
+	long := "https://example.com/" + strings.Repeat("x", 100000)
+	assert.Equal(t, map[string]string{long: "long.md"}, list.fileNames)
+
+	input := make(chan string)
+	go list.send(input)
+	var urls []string
+	for u := range input {
+		urls = append(urls, u)
+	}
+	require.Len(t, urls, n+1, "repeats are sent once")
+	assert.Equal(t, "https://example.com/page/0", urls[0])
+	assert.Equal(t, "https://example.com/page/1", urls[1])
+	assert.Equal(t, "https://example.com/page/199999", urls[n-1])
+	assert.Equal(t, long, urls[n])
+
+	// Resuming skips the URLs before the first occurrence, and repeats of them after it
+	resumed, err := openURLList([]string{file}, converter.DefaultMaxBodySize, false, false, "https://example.com/page/500")
+	require.NoError(t, err)
+	assert.Equal(t, 500, resumed.skipped)
+	assert.Equal(t, n+1-500, resumed.count)
+	input = make(chan string)
+	go resumed.send(input)
+	sent := 0
+	for u := range input {
+		if sent == 0 {
+			assert.Equal(t, "https://example.com/page/500", u)
+		}
+		assert.NotEqual(t, "https://example.com/page/0", u)
+		sent++
+	}
+	assert.Equal(t, resumed.count, sent)
+
+	tooLong := writeURLFile(t, "testurls_toolong.txt", "https://example.com/"+strings.Repeat("x", maxURLLine)+"\n")
+	_, err = openURLList([]string{tooLong}, converter.DefaultMaxBodySize, false, false, "")
+	assert.ErrorContains(t, err, "a line is longer than")
+}
+
+func TestCLI_Convert_RemoteURLFile(t *testing.T) {
+	pages := titledPageServer(t)
+	lists := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lists/urls.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%[1]s/remote\n%[1]s/listed\tlisted.md\n", pages.URL)
+	}))
+	defer lists.Close()
+	local := writeURLFile(t, "testurls_local.txt", pages.URL+"/local\n")
+
+	runDir := executeConvert(t, "test_output_remote", "--file", lists.URL+"/lists/urls.txt", "--file", local, "--selector", "main")
+	assert.ElementsMatch(t, []string{"page_remote.md", "listed.md", "page_local.md"}, listFiles(t, runDir))
+}
+
+func TestOpenURLList_RemoteGuards(t *testing.T) {
+	lists := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big.txt" {
+			fmt.Fprint(w, strings.Repeat("https://example.com/page\n", 100))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer lists.Close()
+
+	_, err := openURLList([]string{lists.URL + "/missing.txt"}, converter.DefaultMaxBodySize, false, false, "")
+	assert.ErrorContains(t, err, "HTTP status 404")
+
+	_, err = openURLList([]string{lists.URL + "/big.txt"}, 1024, false, false, "")
+	assert.ErrorIs(t, err, converter.ErrTooLarge, "the --max-size limit applies to URL lists too")
+}
+
+func TestCLI_Convert_CheckLinks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<html><body><main><p><a href="%[1]s/ok">Good</a> <a href="%[1]s/gone">Dead</a> <a href="%[1]s/ok">Again</a></p></main></body></html>`, server.URL)
+		case "/ok":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	urlFile := writeURLFile(t, "testurls_links.txt", server.URL+"/page\tpage.md\n")
+
+	runDir := executeConvert(t, "test_output_links", "--file", urlFile, "--selector", "main", "--check-links")
+
+	data, err := os.ReadFile(filepath.Join(runDir, converter.LinkReportFileName))
+	require.NoError(t, err, "the link report should be written")
+	var report converter.LinkReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, 2, report.Checked, "repeated links are checked once")
+	require.Len(t, report.Broken, 1)
+	assert.Equal(t, server.URL+"/gone", report.Broken[0].URL)
+	assert.Equal(t, http.StatusNotFound, report.Broken[0].StatusCode)
+	assert.Equal(t, []string{"page.md"}, report.Broken[0].Files)
+
+	originalExitFunc := exitFunc
+	var exitCode int
+	exitFunc = func(code int) { exitCode = code }
+	defer func() { exitFunc = originalExitFunc }()
+
+	executeConvert(t, "test_output_links_fail", "--file", urlFile, "--selector", "main", "--fail-on-broken-links")
+	assert.Equal(t, 1, exitCode, "broken links should fail the run with --fail-on-broken-links")
+}
+
+func TestCLI_Convert_BreakerThreshold(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := titledPageServer(t)
+
+	var lines string
+	for i := 1; i <= 5; i++ {
+		lines += fmt.Sprintf("%s/down%d\n", down.URL, i)
+	}
+	lines += up.URL + "/up\n"
+	urlFile := writeURLFile(t, "testurls_breaker.txt", lines)
+
+	runDir := executeConvert(t, "test_output_breaker", "--file", urlFile, "--selector", "main",
+		"--concurrency", "1", "--breaker-threshold", "2", "--breaker-cooldown", "1h", "--manifest")
+
+	assert.Equal(t, 2, requests, "the failing host should not be requested once its circuit opens")
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Summary.Successful, "other hosts are unaffected")
+	assert.Equal(t, 5, m.Summary.Failed)
+	for _, r := range m.Results[2:5] {
+		assert.Contains(t, r.Error, "circuit open for "+strings.TrimPrefix(down.URL, "http://"))
+	}
+}
+
+func TestCLI_Convert_FollowIframes(t *testing.T) {
+	var crossOriginRequests int
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		crossOriginRequests++
+		fmt.Fprint(w, "<html><body><main><p>Cross-origin content</p></main></body></html>")
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/page":
+			fmt.Fprintf(w, `<html><head><title>Embedded</title></head><body><main>
+<p>Before the frame.</p>
+<iframe src="/frames/api#top"></iframe>
+<p>After the frame.</p>
+<iframe src="%s/widget"></iframe>
+</main></body></html>`, other.URL)
+		case "/frames/api":
+			fmt.Fprint(w, `<html><body><nav>Frame menu</nav><main><h2>API Reference</h2><p>Framed content.</p></main></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	urlFile := writeURLFile(t, "testurls_iframes.txt", server.URL+"/page\n")
+
+	runDir := executeConvert(t, "test_output_iframes", "--file", urlFile, "--selector", "main", "--follow-iframes")
+
+	data, err := os.ReadFile(filepath.Join(runDir, "embedded.md"))
+	require.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "Before the frame.\n\n## API Reference\n\nFramed content.\n\nAfter the frame.", "the frame's content should be spliced in place")
+	assert.NotContains(t, content, "Frame menu", "the selector applies inside the frame")
+	assert.NotContains(t, content, "Cross-origin content")
+	assert.Zero(t, crossOriginRequests, "cross-origin frames must not be fetched")
+}
+
+func TestCLI_Convert_ResumeFrom(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_resume.txt", server.URL+"/alpha\n"+server.URL+"/beta\n"+server.URL+"/gamma\n"+server.URL+"/beta\n")
+
+	runDir := executeConvert(t, "test_output_resume", "--file", urlFile, "--selector", "main", "--resume-from", server.URL+"/beta")
+	assert.ElementsMatch(t, []string{"page_beta.md", "page_gamma.md"}, listFiles(t, runDir), "the URLs before the first match are skipped")
+
+	originalExitFunc := exitFunc
+	var exitCode int
+	exitFunc = func(code int) { exitCode = code }
+	defer func() { exitFunc = originalExitFunc }()
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = []string{"doc-converter", "convert", "--file", urlFile, "--selector", "main", "--resume-from", server.URL + "/delta", "--output", t.TempDir()}
+	resetConvertFlags()
+	Execute()
+	assert.Equal(t, 1, exitCode, "a URL not in the list is an error")
+}
+
+func TestCLI_Convert_RequireEmptyOutput(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_require_empty.txt", server.URL+"/alpha\n")
+
+	// A missing output directory is empty
+	runDir := executeConvert(t, "test_output_require_empty", "--file", urlFile, "--selector", "main", "--require-empty-output")
+	assert.Equal(t, []string{"page_alpha.md"}, listFiles(t, runDir))
+
+	originalExitFunc := exitFunc
+	var exitCode int
+	exitFunc = func(code int) { exitCode = code }
+	defer func() { exitFunc = originalExitFunc }()
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = []string{"doc-converter", "convert", "--file", urlFile, "--selector", "main", "--require-empty-output", "--output", "test_output_require_empty"}
+	resetConvertFlags()
+	Execute()
+	assert.Equal(t, 1, exitCode, "an output directory holding an earlier run aborts the run")
+	dirs, err := os.ReadDir("test_output_require_empty")
+	require.NoError(t, err)
+	assert.Len(t, dirs, 1, "no run directory is created")
+}
+
+func TestCLI_Convert_EmitSitemap(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_sitemap.txt", server.URL+"/alpha\n"+server.URL+"/beta\n")
+
+	before := time.Now().UTC().Truncate(time.Second)
+	runDir := executeConvert(t, "test_output_sitemap", "--file", urlFile, "--selector", "main", "--emit-sitemap")
+	data, err := os.ReadFile(filepath.Join(runDir, "sitemap.xml"))
+	require.NoError(t, err)
+
+	var set struct {
+		URLs []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &set))
+	require.Len(t, set.URLs, 2)
+	for i, page := range []string{"alpha", "beta"} {
+		assert.Equal(t, server.URL+"/"+page, set.URLs[i].Loc)
+		lastmod, err := time.Parse(time.RFC3339, set.URLs[i].LastMod)
+		require.NoError(t, err)
+		assert.False(t, lastmod.Before(before), "lastmod is the retrieval time")
+	}
+}
+
+func TestCLI_Convert_Shard(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_shard.txt", server.URL+"/alpha\n"+server.URL+"/beta\n")
+	host := strings.NewReplacer(":", "_").Replace(strings.TrimPrefix(server.URL, "http://"))
+
+	t.Run("host", func(t *testing.T) {
+		runDir := executeConvert(t, "test_output_shard_host", "--file", urlFile, "--selector", "main", "--shard", "host", "--manifest", "--emit-index")
+		assert.ElementsMatch(t, []string{"page_alpha.md", "page_beta.md"}, listFiles(t, filepath.Join(runDir, host)))
+
+		m, err := converter.ReadManifest(runDir)
+		require.NoError(t, err)
+		assert.Equal(t, converter.ShardHost, m.Shard)
+		assert.Equal(t, filepath.Join(host, "page_alpha.md"), m.Results[0].FileName, "the manifest records the sharded path")
+
+		index, err := os.ReadFile(filepath.Join(runDir, "index.html"))
+		require.NoError(t, err)
+		assert.Contains(t, string(index), `href="./`+host+`/page_alpha.md"`)
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		runDir := executeConvert(t, "test_output_shard_hash", "--file", urlFile, "--selector", "main", "--shard", "hash")
+		for _, page := range []string{"alpha", "beta"} {
+			sum := sha256.Sum256([]byte(server.URL + "/" + page))
+			assert.FileExists(t, filepath.Join(runDir, hex.EncodeToString(sum[:1]), "page_"+page+".md"))
+		}
+	})
+}
+
+func TestCLI_Convert_HostDirs(t *testing.T) {
+	serverA, serverB := titledPageServer(t), titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_hostdirs.txt", serverA.URL+"/intro\n"+serverB.URL+"/intro\n")
+	hostName := strings.NewReplacer("http://", "", ":", "_").Replace
+
+	t.Run("two hosts", func(t *testing.T) {
+		runDir := executeConvert(t, "test_output_hostdirs", "--file", urlFile, "--selector", "main", "--manifest")
+		for _, server := range []*httptest.Server{serverA, serverB} {
+			assert.FileExists(t, filepath.Join(runDir, hostName(server.URL), "page_intro.md"), "pages of the same name from two hosts do not collide")
+		}
+
+		m, err := converter.ReadManifest(runDir)
+		require.NoError(t, err)
+		assert.Equal(t, converter.ShardHost, m.Shard)
+		assert.Equal(t, filepath.Join(hostName(serverB.URL), "page_intro.md"), m.Results[1].FileName)
+		assert.Equal(t, 1, m.Results[1].MatchCount, "the manifest records how many elements the selector matched")
+	})
+
+	t.Run("no-host-dirs", func(t *testing.T) {
+		runDir := executeConvert(t, "test_output_hostdirs_flat", "--file", urlFile, "--selector", "main", "--no-host-dirs")
+		assert.Contains(t, listFiles(t, runDir), "page_intro.md")
+		assert.NoDirExists(t, filepath.Join(runDir, hostName(serverA.URL)))
+	})
+
+	t.Run("one host", func(t *testing.T) {
+		single := writeURLFile(t, "testurls_hostdirs_single.txt", serverA.URL+"/intro\n"+serverA.URL+"/guide\n")
+		runDir := executeConvert(t, "test_output_hostdirs_single", "--file", single, "--selector", "main")
+		assert.ElementsMatch(t, []string{"page_intro.md", "page_guide.md"}, listFiles(t, runDir), "single-host runs stay flat")
+	})
+}
+
+func TestCLI_Convert_Layout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		published := ""
+		if r.URL.Path == "/launch" {
+			published = `<meta property="article:published_time" content="2024-03-05T09:30:00Z">`
+		}
+		fmt.Fprintf(w, `<html><head><title>Post %s</title>%s</head><body><main><p>Body of %s</p></main></body></html>`, r.URL.Path[1:], published, r.URL.Path[1:])
+	}))
+	defer server.Close()
+	urlFile := writeURLFile(t, "testurls_layout.txt", server.URL+"/launch\n"+server.URL+"/recap\n")
+
+	frontmatter := func(t *testing.T, path string) map[string]interface{} {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		parts := strings.SplitN(string(content), "---\n", 3)
+		require.Len(t, parts, 3)
+		var metadata map[string]interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(parts[1]), &metadata))
+		return metadata
+	}
+
+	t.Run("hugo", func(t *testing.T) {
+		runDir := executeConvert(t, "test_output_layout_hugo", "--file", urlFile, "--selector", "main", "--utc", "--layout", "hugo", "--manifest")
+		assert.ElementsMatch(t, []string{"post_launch", "post_recap", "manifest.json"}, listFiles(t, runDir))
+		assert.Equal(t, []string{"index.md"}, listFiles(t, filepath.Join(runDir, "post_launch")))
+
+		metadata := frontmatter(t, filepath.Join(runDir, "post_launch", "index.md"))
+		assert.Equal(t, "Post launch", metadata["title"])
+		assert.Equal(t, "2024-03-05T09:30:00Z", metadata["date"], "the publication date is the page's date")
+		recap := frontmatter(t, filepath.Join(runDir, "post_recap", "index.md"))
+		assert.Equal(t, recap["retrieved_at"], recap["date"], "a page without one is dated when it was retrieved")
+
+		m, err := converter.ReadManifest(runDir)
+		require.NoError(t, err)
+		assert.Equal(t, converter.LayoutHugo, m.Layout)
+		assert.Equal(t, filepath.Join("post_launch", "index.md"), m.Results[0].FileName)
+	})
+
+	t.Run("jekyll", func(t *testing.T) {
+		runDir := executeConvert(t, "test_output_layout_jekyll", "--file", urlFile, "--selector", "main", "--utc", "--layout", "jekyll")
+		today := time.Now().UTC().Format("2006-01-02")
+		assert.ElementsMatch(t, []string{"2024-03-05-post-launch.md", today + "-post-recap.md"}, listFiles(t, filepath.Join(runDir, "_posts")))
+
+		metadata := frontmatter(t, filepath.Join(runDir, "_posts", "2024-03-05-post-launch.md"))
+		assert.Equal(t, "post", metadata["layout"])
+		assert.Equal(t, "2024-03-05 09:30:00 +0000", metadata["date"])
+		assert.Equal(t, "Post launch", metadata["title"])
+	})
+}
+
+func TestCLI_Convert_OutputSingleJSON(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_single_json.txt", server.URL+"/alpha\n"+server.URL+"/beta\n"+server.URL+"/gamma\n")
+	jsonPath := filepath.Join(t.TempDir(), "pages.json")
+
+	executeConvert(t, "test_output_single_json", "--file", urlFile, "--selector", "main", "--output-single-json", jsonPath)
+
+	data, err := os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	var pages []converter.PageRecord
+	require.NoError(t, json.Unmarshal(data, &pages), "the file should be one JSON array: %s", data)
+	require.Len(t, pages, 3)
+	bodies := make(map[string]string)
+	for _, page := range pages {
+		bodies[page.Source] = page.Body
+		assert.Equal(t, "Page "+strings.TrimPrefix(page.Source, server.URL+"/"), page.Metadata["title"])
+	}
+	assert.Equal(t, "Content of beta", bodies[server.URL+"/beta"])
+}
+
+func TestCLI_Convert_ZIM(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_zim.txt", server.URL+"/alpha\n"+server.URL+"/beta\n")
+	zimPath := filepath.Join(t.TempDir(), "pages.zim")
+
+	executeConvert(t, "test_output_zim", "--file", urlFile, "--selector", "main", "--zim", zimPath, "--zim-title", "Alpha and beta")
+
+	data, err := os.ReadFile(zimPath)
+	require.NoError(t, err)
+	require.Greater(t, len(data), 80)
+	assert.Equal(t, uint32(72173914), binary.LittleEndian.Uint32(data), "the file starts with the ZIM magic number")
+	assert.Equal(t, uint32(7+2), binary.LittleEndian.Uint32(data[24:]), "two pages, the main page, its redirect and five metadata entries")
+	assert.Contains(t, string(data), "Content of beta")
+	assert.Contains(t, string(data), `<a href="page_alpha.html">Page alpha</a>`, "the main page links the pages")
+	assert.Contains(t, string(data), "Alpha and beta")
+}
+
+func TestCLI_Convert_PreserveOrder(t *testing.T) {
+	// Each page answers later than the one after it, so they complete in reverse
+	delays := map[string]time.Duration{"/alpha": 300 * time.Millisecond, "/beta": 200 * time.Millisecond, "/gone": 100 * time.Millisecond}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delays[r.URL.Path])
+		if r.URL.Path == "/gone" || r.URL.Path == "/dead" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body><main><p>%s</p></main></body></html>", r.URL.Path, r.URL.Path)
+	}))
+	defer server.Close()
+	paths := []string{"/alpha", "/beta", "/gone", "/gamma", "/dead"}
+	var lines string
+	for _, path := range paths {
+		lines += server.URL + path + "\n"
+	}
+	urlFile := writeURLFile(t, "testurls_order.txt", lines)
+	jsonPath := filepath.Join(t.TempDir(), "pages.json")
+
+	runDir := executeConvert(t, "test_output_order", "--file", urlFile, "--selector", "main",
+		"--concurrency", "5", "--manifest", "--output-single-json", jsonPath, "--preserve-order")
+
+	data, err := os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	var pages []converter.PageRecord
+	require.NoError(t, json.Unmarshal(data, &pages))
+	var sources []string
+	for _, page := range pages {
+		sources = append(sources, page.Source)
+	}
+	assert.Equal(t, []string{server.URL + "/alpha", server.URL + "/beta", server.URL + "/gamma"}, sources)
+
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{server.URL + "/gone", server.URL + "/dead"}, m.Summary.FailedURLs)
+	for i, r := range m.Results {
+		assert.Equal(t, server.URL+paths[i], r.URL)
+	}
+}
+
+func TestCLI_Convert_AddMeta(t *testing.T) {
+	server := titledPageServer(t)
+	urlFile := writeURLFile(t, "testurls_add_meta.txt", server.URL+"/alpha\n")
+
+	readMetadata := func(runDir string) map[string]interface{} {
+		content, err := os.ReadFile(filepath.Join(runDir, "page_alpha.md"))
+		require.NoError(t, err)
+		parts := strings.SplitN(string(content), "---\n", 3)
+		require.Len(t, parts, 3)
+		var metadata map[string]interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(parts[1]), &metadata))
+		return metadata
+	}
+
+	runDir := executeConvert(t, "test_output_add_meta", "--file", urlFile, "--selector", "main",
+		"--add-meta", "project=docs-migration", "--add-meta", "tags=[imported, v2]", "--add-meta", "title=Imported")
+	metadata := readMetadata(runDir)
+	assert.Equal(t, "docs-migration", metadata["project"])
+	assert.Equal(t, []interface{}{"imported", "v2"}, metadata["tags"])
+	assert.Equal(t, "Page alpha", metadata["title"], "extracted fields win by default")
+	assert.Equal(t, server.URL+"/alpha", metadata["source"])
+
+	runDir = executeConvert(t, "test_output_add_meta_override", "--file", urlFile, "--selector", "main",
+		"--add-meta", "title=Imported", "--add-meta-override")
+	assert.Equal(t, "Imported", readMetadata(runDir)["title"])
+}
+
+func TestCLI_Convert_Profile(t *testing.T) {
+	server := titledPageServer(t)
+	stagingURLs := writeURLFile(t, "testurls_profile_staging.txt", server.URL+"/staging\n")
+	productionURLs := writeURLFile(t, "testurls_profile_production.txt", server.URL+"/production\n")
+	config := writeURLFile(t, "test_profile_config.yaml", fmt.Sprintf(`selector: "main"
+add-meta: ["env=default"]
+profiles:
+  staging:
+    file: [%q]
+    add-meta: ["env=staging"]
+  production:
+    file: [%q]
+    add-meta: ["env=production"]
+`, stagingURLs, productionURLs))
+	t.Cleanup(func() {
+		// Don't leak the profile or its settings into later tests
+		rootCmd.PersistentFlags().Set("config", "")
+		rootCmd.PersistentFlags().Set("profile", "")
+		viper.SetConfigFile("")
+		viper.SetConfigType("yaml")
+		viper.ReadConfig(strings.NewReader(""))
+	})
+
+	readEnv := func(runDir, name string) interface{} {
+		content, err := os.ReadFile(filepath.Join(runDir, name))
+		require.NoError(t, err)
+		parts := strings.SplitN(string(content), "---\n", 3)
+		require.Len(t, parts, 3)
+		var metadata map[string]interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(parts[1]), &metadata))
+		return metadata["env"]
+	}
+
+	runDir := executeConvert(t, "test_output_profile_staging", "--config", config, "--profile", "staging")
+	assert.Equal(t, []string{"page_staging.md"}, listFiles(t, runDir), "the profile's URL list is used")
+	assert.Equal(t, "staging", readEnv(runDir, "page_staging.md"))
+
+	runDir = executeConvert(t, "test_output_profile_production", "--config", config, "--profile", "production")
+	assert.Equal(t, []string{"page_production.md"}, listFiles(t, runDir), "switching profiles replaces its settings")
+	assert.Equal(t, "production", readEnv(runDir, "page_production.md"))
+
+	runDir = executeConvert(t, "test_output_profile_override", "--config", config, "--profile", "production", "--add-meta", "env=local")
+	assert.Equal(t, "local", readEnv(runDir, "page_production.md"), "flags override the profile")
+}
+
+func TestCLI_Convert_ModifiedSince(t *testing.T) {
+	lastModified := map[string]time.Time{
+		"/old": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		"/new": time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	var conditional int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		modified := lastModified[r.URL.Path]
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+			mu.Lock()
+			conditional++
+			mu.Unlock()
+			if !modified.After(since) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Content</p></main></body></html>", r.URL.Path[1:])
+	}))
+	defer server.Close()
+	urlFile := writeURLFile(t, "testurls_modified.txt", server.URL+"/old\n"+server.URL+"/new\n")
+
+	runDir := executeConvert(t, "test_output_modified", "--file", urlFile, "--selector", "main", "--modified-since", "2024-01-01", "--manifest")
+
+	assert.Equal(t, 2, conditional, "every page request should be conditional")
+	assert.ElementsMatch(t, []string{"page_new.md", "manifest.json"}, listFiles(t, runDir))
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Summary.Successful)
+	assert.Equal(t, 1, m.Summary.Skipped)
+	assert.Zero(t, m.Summary.Failed, "unchanged pages are not failures")
+	assert.Empty(t, m.Summary.FailedURLs)
+	assert.True(t, m.Results[0].Skipped)
+
+	conditional = 0
+	runDir = executeConvert(t, "test_output_modified_all", "--file", urlFile, "--selector", "main")
+	assert.Zero(t, conditional)
+	assert.ElementsMatch(t, []string{"page_old.md", "page_new.md"}, listFiles(t, runDir))
+}
+
+func TestCLI_Convert_Interrupted(t *testing.T) {
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Interrupted while the first page is in flight, which still completes
+		once.Do(func() {
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+			time.Sleep(100 * time.Millisecond)
+		})
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Done</p></main></body></html>", strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer server.Close()
+	var lines string
+	for _, path := range []string{"/first", "/second", "/third", "/fourth"} {
+		lines += server.URL + path + "\n"
+	}
+	urlFile := writeURLFile(t, "testurls_interrupt.txt", lines)
+
+	exitCode := 0
+	originalExitFunc := exitFunc
+	exitFunc = func(code int) { exitCode = code }
+	defer func() { exitFunc = originalExitFunc }()
+
+	runDir := executeConvert(t, "test_output_interrupt", "--file", urlFile, "--selector", "main", "--concurrency", "1", "--manifest")
+	assert.Equal(t, 130, exitCode)
+	assert.Contains(t, listFiles(t, runDir), "page_first.md", "pages finished before the interruption are kept")
+	assert.NotContains(t, listFiles(t, runDir), "page_fourth.md")
+
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.True(t, m.Summary.Interrupted)
+	assert.Equal(t, 4, m.Summary.Successful+m.Summary.NotStarted)
+	assert.Equal(t, 1, m.Summary.Successful)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <runDirA> <runDirB>",
+	Short: "Compare the converted pages of two run directories",
+	Long: `Compares the markdown bodies of two run directories and reports pages that were added,
+removed or changed between them, including a unified diff of each changed body.
+
+Pages are paired by the 'source' field of their frontmatter, not by filename.
+
+Example usage:
+  doc-converter diff output/20250810175451 output/20250811090000
+  doc-converter diff output/20250810175451 output/20250811090000 --format json`,
+	Args: cobra.ExactArgs(2),
+	Run:  runDiff,
+}
+
+var diffFormat string
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVar(&diffFormat, "format", "text", "Output format: text or json")
+}
+
+func runDiff(cmd *cobra.Command, args []string) {
+	if diffFormat != "text" && diffFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported format '%s' (expected text or json)\n", diffFormat)
+		exitFunc(1)
+		return
+	}
+
+	result, err := converter.DiffRuns(args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exitFunc(1)
+		return
+	}
+
+	out := cmd.OutOrStdout()
+	if diffFormat == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to encode diff: %v\n", err)
+			exitFunc(1)
+		}
+		return
+	}
+	printRunDiff(out, result)
+}
+
+// printRunDiff writes a human-readable report of a run diff.
+func printRunDiff(out io.Writer, result *converter.RunDiff) {
+	for _, p := range result.Added {
+		fmt.Fprintf(out, "Added:   %s (%s)\n", p.Name(), p.FileB)
+	}
+	for _, p := range result.Removed {
+		fmt.Fprintf(out, "Removed: %s (%s)\n", p.Name(), p.FileA)
+	}
+	for _, p := range result.Changed {
+		fmt.Fprintf(out, "Changed: %s\n", p.Name())
+	}
+	for _, p := range result.Changed {
+		fmt.Fprintf(out, "\n%s", p.Diff)
+	}
+	fmt.Fprintf(out, "\n%d added, %d removed, %d changed, %d unchanged\n",
+		len(result.Added), len(result.Removed), len(result.Changed), result.Unchanged)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <url>",
+	Short: "Suggest content selectors for a page",
+	Long: `Fetches a page and prints a ranked list of candidate CSS selectors for its main
+content, with a sample of the text each would extract. Candidates are ranked by the
+amount of text outside links, favouring semantic tags like <main> and <article> and
+content-like class names, and penalizing navigation, headers and footers.
+
+Example usage:
+  doc-converter inspect https://alain.apigban.com/posts/homelab/09/netlify-02/
+  doc-converter inspect https://example.com/docs --limit 3 --format json`,
+	Args: cobra.ExactArgs(1),
+	Run:  runInspect,
+}
+
+// inspectTimeout bounds the page fetch of an inspection.
+const inspectTimeout = 10 * time.Second
+
+var (
+	inspectLimit  int
+	inspectFormat string
+)
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().IntVar(&inspectLimit, "limit", 10, "Number of candidates to print")
+	inspectCmd.Flags().StringVar(&inspectFormat, "format", "text", "Output format: text or json")
+}
+
+func runInspect(cmd *cobra.Command, args []string) {
+	if inspectFormat != "text" && inspectFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported format '%s' (expected text or json)\n", inspectFormat)
+		exitFunc(1)
+		return
+	}
+
+	// No output is written, so the Converter needs no output directory
+	c := &converter.Converter{Client: &http.Client{Timeout: inspectTimeout}}
+	candidates, err := c.Inspect(args[0], inspectLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exitFunc(1)
+		return
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: No candidate selectors found; the page may need --render js")
+		exitFunc(1)
+		return
+	}
+
+	out := cmd.OutOrStdout()
+	if inspectFormat == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(candidates); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to encode candidates: %v\n", err)
+			exitFunc(1)
+		}
+		return
+	}
+	printCandidates(out, candidates)
+}
+
+// printCandidates writes the ranked candidates as a table followed by their samples.
+func printCandidates(out io.Writer, candidates []converter.SelectorCandidate) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tSCORE\tCHARS\tSELECTOR")
+	for i, cand := range candidates {
+		fmt.Fprintf(tw, "%d\t%.1f\t%d\t%s\n", i+1, cand.Score, cand.TextLength, cand.Selector)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(out)
+	for i, cand := range candidates {
+		fmt.Fprintf(out, "%d. %s\n   %s\n", i+1, cand.Selector, cand.Sample)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressWidth is the number of cells in the progress bar.
+const progressWidth = 30
+
+// clearLine returns the cursor to the start of the line and erases it.
+const clearLine = "\r\033[K"
+
+// progressBar draws the progress of a run on one terminal line, redrawn in
+// place as pages complete. Log lines written through it appear above the bar:
+// it is cleared, the line written and the bar drawn again, so the two never
+// mix on the screen.
+type progressBar struct {
+	mu        sync.Mutex
+	out       io.Writer // The terminal the bar is drawn on
+	logs      io.Writer // Where log lines go, usually stderr on the same terminal
+	total     int
+	done      int
+	succeeded int
+	failed    int
+	skipped   int
+	start     time.Time
+	now       func() time.Time
+}
+
+func newProgressBar(out, logs io.Writer, total int) *progressBar {
+	p := &progressBar{out: out, logs: logs, total: total, start: time.Now(), now: time.Now}
+	p.draw()
+	return p
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Write writes a log line above the bar.
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.out, clearLine)
+	n, err := p.logs.Write(b)
+	p.draw()
+	return n, err
+}
+
+// record counts a completed page and redraws the bar.
+func (p *progressBar) record(result converter.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	switch {
+	case result.IsSuccess:
+		p.succeeded++
+	case result.Skipped:
+		p.skipped++
+	default:
+		p.failed++
+	}
+	p.draw()
+}
+
+// finish erases the bar, leaving the line for what is printed next.
+func (p *progressBar) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.out, clearLine)
+}
+
+// draw writes the bar over the current line. The caller holds mu.
+func (p *progressBar) draw() {
+	fmt.Fprint(p.out, clearLine+p.line())
+}
+
+// line describes the progress, e.g.
+// "[#########---------------------] 12/40  ok 10  failed 2  3.4 pages/s".
+func (p *progressBar) line() string {
+	filled := progressWidth
+	if p.total > 0 {
+		filled = p.done * progressWidth / p.total
+	}
+	rate := 0.0
+	if elapsed := p.now().Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+	line := fmt.Sprintf("[%s%s] %d/%d  ok %d  failed %d", strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled), p.done, p.total, p.succeeded, p.failed)
+	if p.skipped > 0 {
+		line += fmt.Sprintf("  skipped %d", p.skipped)
+	}
+	return line + fmt.Sprintf("  %.1f pages/s", rate)
+}
@@ -0,0 +1,61 @@
+//go:build integration
+// +build integration
+
+package cmd
+
+import (
+	"bytes"
+	"doc-converter/pkg/converter"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressBar(t *testing.T) {
+	var screen, logs bytes.Buffer
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	bar := &progressBar{out: &screen, logs: &logs, total: 4, start: start, now: func() time.Time { return start.Add(2 * time.Second) }}
+
+	bar.record(converter.Result{URL: "https://example.com/a", IsSuccess: true})
+	bar.record(converter.Result{URL: "https://example.com/b", IsSuccess: true})
+	bar.record(converter.Result{URL: "https://example.com/c", Skipped: true})
+	assert.Equal(t, "[######################--------] 3/4  ok 2  failed 0  skipped 1  1.5 pages/s", bar.line())
+
+	screen.Reset()
+	logger := log.New(bar, "", 0)
+	logger.Printf("ERROR: Failed to process https://example.com/d: HTTP status 500")
+	bar.record(converter.Result{URL: "https://example.com/d"})
+	assert.Equal(t, "ERROR: Failed to process https://example.com/d: HTTP status 500\n", logs.String())
+	assert.Equal(t, clearLine+clearLine+"[######################--------] 3/4  ok 2  failed 0  skipped 1  1.5 pages/s"+
+		clearLine+"[##############################] 4/4  ok 2  failed 1  skipped 1  2.0 pages/s", screen.String(),
+		"the bar is cleared before a log line and drawn again after it")
+
+	bar.finish()
+	assert.True(t, strings.HasSuffix(screen.String(), clearLine), "the bar is erased at the end")
+}
+
+func TestProgressBar_Concurrent(t *testing.T) {
+	var screen, logs bytes.Buffer
+	bar := newProgressBar(&screen, &logs, 100)
+	logger := log.New(bar, "", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			bar.record(converter.Result{IsSuccess: true})
+		}()
+		go func() {
+			defer wg.Done()
+			logger.Printf("WARNING: line")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, strings.Repeat("WARNING: line\n", 50), logs.String(), "log lines are written whole")
+	assert.Contains(t, bar.line(), "50/100  ok 50")
+}
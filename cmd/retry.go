@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// retryCmd represents the retry command
+var retryCmd = &cobra.Command{
+	Use:   "retry <runDir>",
+	Short: "Retry the failed URLs of a previous run",
+	Long: `Reads the manifest.json of a run made with --manifest and converts only the URLs
+that failed, with the same selector, format and --fetch-only setting. Successful retries are merged into
+the run: the manifest is updated and the new pages are written next to the others.
+
+With --output, the run is left untouched and the merged run is written to a new
+timestamped directory under the given parent instead.
+
+Example usage:
+  doc-converter retry output/20250810175451
+  doc-converter retry output/20250810175451 --output retried`,
+	Args: cobra.ExactArgs(1),
+	Run:  runRetry,
+}
+
+var retryOutput string
+
+func init() {
+	rootCmd.AddCommand(retryCmd)
+
+	retryCmd.Flags().StringVarP(&retryOutput, "output", "o", "", "Parent directory for a new run directory holding the merged run (default: update the run in place)")
+}
+
+func runRetry(cmd *cobra.Command, args []string) {
+	runDir := args[0]
+	m, err := converter.ReadManifest(runDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (was the run made with --manifest?)\n", err)
+		exitFunc(1)
+		return
+	}
+	if m.Combined {
+		// The host files would have to be rebuilt from pages that are no longer kept
+		fmt.Fprintln(os.Stderr, "Error: Runs made with --combine-by-host cannot be retried; convert the URLs again instead")
+		exitFunc(1)
+		return
+	}
+	if len(m.Summary.FailedURLs) == 0 {
+		log.Printf("INFO: No failed URLs to retry in %s", runDir)
+		return
+	}
+
+	targetDir := runDir
+	if retryOutput != "" {
+		if targetDir, err = copyRun(m, runDir, retryOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitFunc(1)
+			return
+		}
+		log.Printf("INFO: Created output directory: %s", targetDir)
+	}
+
+	c, err := converter.NewConverter(targetDir)
+	if err != nil {
+		log.Fatalf("Error creating converter: %v", err)
+	}
+	c.Format = m.Format
+	c.RichMarkdown = m.RichMarkdown
+	c.InputFormat = m.InputFormat
+	c.XMLElements = m.XMLElements
+	c.FetchOnly = m.FetchOnly
+	c.Shard = m.Shard
+	c.Layout = m.Layout
+	c.SplitTokens = m.SplitTokens
+	c.SelectorRules = m.SelectorRules
+	c.SelectorIndex = m.SelectorIndex
+	c.SelectorAttr = m.SelectorAttr
+	if m.SectionHeading != "" {
+		if c.SectionHeading, err = regexp.Compile(m.SectionHeading); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid section heading in the manifest: %v\n", err)
+			exitFunc(1)
+			return
+		}
+	}
+	c.Regions = m.Regions
+	// Retried pages must not take the files of the pages already in the run
+	c.ReserveFileNames(m.Results)
+
+	log.Printf("INFO: Retrying %d failed URLs from %s", len(m.Summary.FailedURLs), runDir)
+	resultsChan, summaryChan := c.Convert(m.Summary.FailedURLs, m.Selector)
+
+	var retried []converter.Result
+	for result := range resultsChan {
+		if result.IsSuccess {
+			log.Printf("INFO: Successfully converted: %s -> %s", result.URL, filepath.Join(c.OutputDir, result.FileName))
+		} else {
+			log.Printf("ERROR: Failed to process %s: %s", result.URL, result.Error)
+		}
+		result.Content = nil
+		retried = append(retried, result)
+	}
+	summary := <-summaryChan
+
+	m.Merge(retried)
+	// Every failed URL was retried, so the retry's count stands for the whole run
+	m.Summary.DNSFailures = summary.DNSFailures
+	if err := converter.WriteManifest(targetDir, m); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	log.Printf("INFO: Retry complete.")
+	log.Printf("INFO: Recovered: %d of %d", summary.Successful, summary.TotalURLs)
+	if m.Summary.Failed > 0 {
+		log.Printf("INFO: Still failing: %s", strings.Join(m.Summary.FailedURLs, ", "))
+	}
+}
+
+// copyRun creates a new timestamped run directory under parentDir and copies
+// the successfully converted pages of m from runDir into it.
+func copyRun(m *converter.Manifest, runDir, parentDir string) (string, error) {
+	// Unlike convert, never replace an existing directory: it could be the run being retried
+	targetDir := filepath.Join(parentDir, time.Now().Format("20060102150405"))
+	if _, err := os.Stat(targetDir); err == nil {
+		return "", fmt.Errorf("run directory %s already exists", targetDir)
+	}
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	for _, r := range m.Results {
+		if !r.IsSuccess {
+			continue
+		}
+		for _, name := range resultFiles(r) {
+			if err := copyFile(filepath.Join(runDir, name), filepath.Join(targetDir, name)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return targetDir, nil
+}
+
+// resultFiles returns the files written for r: its file, or one per part or
+// region when the page was split into parts or regions.
+func resultFiles(r converter.Result) []string {
+	if len(r.Parts) > 0 {
+		return r.Parts
+	}
+	if len(r.Regions) == 0 {
+		return []string{r.FileName}
+	}
+	names := make([]string, len(r.Regions))
+	for i, region := range r.Regions {
+		names[i] = region.FileName
+	}
+	return names
+}
+
+// copyFile copies the file at src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to copy page: %w", err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to copy page: %w", err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to copy page: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy page: %w", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,141 @@
+//go:build integration
+// +build integration
+
+package cmd
+
+import (
+	"doc-converter/pkg/converter"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyPageServer serves titled pages, failing /flaky with a 503 until healed is set.
+func flakyPageServer(t *testing.T, healed *atomic.Bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && !healed.Load() {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		name := r.URL.Path[1:]
+		fmt.Fprintf(w, `<html><head><title>Page %s</title></head><body>
+<main data-id="first-%s"><h2>Intro</h2><p>Content</p><h2>Install</h2><p>Steps</p></main>
+<main data-id="second-%s"><p>Second</p></main>
+</body></html>`, name, name, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// executeRetry runs the retry command with the given arguments.
+func executeRetry(t *testing.T, args ...string) {
+	t.Helper()
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = append([]string{"doc-converter", "retry"}, args...)
+
+	retryOutput = ""
+	Execute()
+}
+
+func TestCLI_Retry_ResolvesFailures(t *testing.T) {
+	var healed atomic.Bool
+	server := flakyPageServer(t, &healed)
+	urlFile := writeURLFile(t, "testurls_retry.txt", server.URL+"/stable\n"+server.URL+"/flaky\n")
+
+	runDir := executeConvert(t, "test_output_retry", "--file", urlFile, "--selector", "main", "--manifest")
+
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, "main", m.Selector)
+	assert.Equal(t, 1, m.Summary.Failed)
+	assert.Equal(t, []string{server.URL + "/flaky"}, m.Summary.FailedURLs)
+	assert.ElementsMatch(t, []string{"page_stable.md", converter.ManifestFileName}, listFiles(t, runDir))
+
+	healed.Store(true)
+	executeRetry(t, runDir)
+
+	m, err = converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.Summary.Successful)
+	assert.Equal(t, 0, m.Summary.Failed)
+	assert.Empty(t, m.Summary.FailedURLs)
+	require.Len(t, m.Results, 2)
+	assert.Equal(t, server.URL+"/stable", m.Results[0].URL, "results keep the input order")
+	assert.Equal(t, "page_flaky.md", m.Results[1].FileName)
+	assert.ElementsMatch(t, []string{"page_stable.md", "page_flaky.md", converter.ManifestFileName}, listFiles(t, runDir))
+}
+
+func TestCLI_Retry_IntoNewRun(t *testing.T) {
+	var healed atomic.Bool
+	server := flakyPageServer(t, &healed)
+	urlFile := writeURLFile(t, "testurls_retry_new.txt", server.URL+"/stable\n"+server.URL+"/flaky\n")
+
+	runDir := executeConvert(t, "test_output_retry_src", "--file", urlFile, "--selector", "main", "--manifest")
+	healed.Store(true)
+
+	parent := t.TempDir()
+	executeRetry(t, runDir, "--output", parent)
+
+	dirs, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, dirs, 1)
+	newRun := filepath.Join(parent, dirs[0].Name())
+	assert.ElementsMatch(t, []string{"page_stable.md", "page_flaky.md", converter.ManifestFileName}, listFiles(t, newRun))
+
+	original, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, original.Summary.Failed, "the original run is left untouched")
+}
+
+// retriedPage converts a stable and a failing page with the given convert
+// arguments and --manifest, retries the run once the page is back, and returns
+// the retried page as written.
+func retriedPage(t *testing.T, args ...string) string {
+	t.Helper()
+	var healed atomic.Bool
+	server := flakyPageServer(t, &healed)
+	urlFile := writeURLFile(t, "testurls_retry_settings.txt", server.URL+"/stable\n"+server.URL+"/flaky\n")
+
+	runDir := executeConvert(t, "test_output_retry_settings", append([]string{"--file", urlFile, "--manifest"}, args...)...)
+	healed.Store(true)
+	executeRetry(t, runDir)
+
+	m, err := converter.ReadManifest(runDir)
+	require.NoError(t, err)
+	require.Empty(t, m.Summary.FailedURLs)
+	data, err := os.ReadFile(filepath.Join(runDir, "page_flaky.md"))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCLI_Retry_SelectorAttr(t *testing.T) {
+	page := retriedPage(t, "--selector", "main", "--selector-attr", "data-id")
+	assert.Contains(t, page, "first-flaky\nsecond-flaky")
+	assert.NotContains(t, page, "Content", "the attribute values are written, not the rendered page")
+}
+
+func TestCLI_Retry_SelectorIndex(t *testing.T) {
+	page := retriedPage(t, "--selector", "main", "--selector-index", "2")
+	assert.Contains(t, page, "Second")
+	assert.NotContains(t, page, "Steps", "only the second match is converted")
+}
+
+func TestCLI_Retry_ContainsHeading(t *testing.T) {
+	page := retriedPage(t, "--selector", "main", "--contains-heading", "install")
+	assert.Contains(t, page, "Steps")
+	assert.NotContains(t, page, "Intro", "only the section is converted")
+
+	page = retriedPage(t, "--selector", "main", "--contains-heading", "^in(stall|tro)$", "--heading-regex")
+	assert.Contains(t, page, "Intro")
+	assert.NotContains(t, page, "Steps")
+}
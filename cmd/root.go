@@ -8,7 +8,10 @@ import (
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile string
+	profile string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -44,6 +47,7 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (if not set, searches for config.yaml in current and home directories)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Apply the settings of this named section under 'profiles' in the config file, over its top-level settings")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -72,5 +76,29 @@ func initConfig() {
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	} else if profile != "" {
+		cobra.CheckErr(fmt.Errorf("--profile %s needs a config file: %w", profile, err))
+	}
+	cobra.CheckErr(applyProfile())
+	if profile != "" {
+		fmt.Fprintln(os.Stderr, "Using config profile:", profile)
+	}
+}
+
+// applyProfile merges the settings of the section of the config file named
+// by --profile over its top-level settings. Flags still take precedence, as
+// they do over the rest of the config file. It must run again whenever the
+// config file is re-read.
+func applyProfile() error {
+	if profile == "" {
+		return nil
+	}
+	section, ok := viper.Get("profiles." + profile).(map[string]interface{})
+	if !ok {
+		if !viper.IsSet("profiles." + profile) {
+			return fmt.Errorf("unknown profile '%s': the config file has no profiles.%s section", profile, profile)
+		}
+		return fmt.Errorf("profile '%s' must be a mapping of settings", profile)
 	}
+	return viper.MergeConfigMap(section)
 }
@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// maxTokenSize bounds the output of a token command or endpoint.
+const maxTokenSize = 64 << 10
+
+// TokenSource obtains a fresh bearer token.
+type TokenSource func() (string, error)
+
+// TokenCommand returns a TokenSource that runs command with sh -c and reads the
+// token from what it prints.
+func TokenCommand(command string) TokenSource {
+	return func() (string, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			// Only stderr is reported: stdout may hold a token
+			return "", fmt.Errorf("token command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return parseToken(stdout.Bytes())
+	}
+}
+
+// TokenEndpoint returns a TokenSource that POSTs to endpoint and reads the
+// token from the response: the access_token or token field of a JSON object,
+// or else the whole body.
+func TokenEndpoint(endpoint string) TokenSource {
+	client := &http.Client{Timeout: httpTimeout}
+	return func() (string, error) {
+		resp, err := client.Post(endpoint, "application/x-www-form-urlencoded", nil)
+		if err != nil {
+			return "", fmt.Errorf("token request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token request failed: HTTP status %d", resp.StatusCode)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenSize))
+		if err != nil {
+			return "", fmt.Errorf("failed to read token response: %w", err)
+		}
+		return parseToken(body)
+	}
+}
+
+// parseToken reads a token printed or served as plain text, or as a JSON
+// object with an access_token or token field.
+func parseToken(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+	var fields struct {
+		AccessToken string `json:"access_token"`
+		Token       string `json:"token"`
+	}
+	token := string(data)
+	if json.Unmarshal(data, &fields) == nil {
+		token = fields.AccessToken
+		if token == "" {
+			token = fields.Token
+		}
+	}
+	if token == "" || strings.ContainsAny(token, "\r\n") {
+		return "", errors.New("no token found in the response")
+	}
+	return token, nil
+}
+
+// UseBearerToken makes the Converter's client send an Authorization: Bearer
+// header with a token from source to the hosts of the pages it fetches and to
+// hosts, given as host or host:port. The token is obtained with the first
+// request and kept; a 401 response fetches a fresh one and the request is sent
+// again. Tokens are never logged.
+func (c *Converter) UseBearerToken(source TokenSource, hosts ...string) {
+	c.Client.Transport = &bearerTransport{source: source, hosts: c.credentialHosts(hosts), next: transportOrDefault(c.Client.Transport)}
+}
+
+// bearerTransport authorizes requests to hosts with a cached bearer token,
+// refreshed when the server rejects it. Requests to other hosts, such as
+// redirects off the site, are sent as they are.
+type bearerTransport struct {
+	source TokenSource
+	hosts  *credentialHosts
+	next   http.RoundTripper
+
+	mu    sync.Mutex
+	token string
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hosts.allows(req) {
+		return t.next.RoundTrip(req)
+	}
+	token, err := t.current("")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(withHeader(req, "Authorization", "Bearer "+token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if token, err = t.current(token); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(withHeader(retry, "Authorization", "Bearer "+token))
+}
+
+// current returns the cached token, obtaining one when there is none or when
+// the cached one is rejected, the token a request was refused with. Requests
+// refused at the same time refresh the token once.
+func (t *bearerTransport) current(rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && t.token != rejected {
+		return t.token, nil
+	}
+	token, err := t.source()
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain a bearer token: %w", err)
+	}
+	t.token = token
+	return token, nil
+}
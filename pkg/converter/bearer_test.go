@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseBearerToken_Refresh(t *testing.T) {
+	// The server accepts only the second token the source hands out, as if the
+	// first had expired
+	var refreshes atomic.Int32
+	source := func() (string, error) {
+		return fmt.Sprintf("token-%d", refreshes.Add(1)), nil
+	}
+	var unauthorized atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			unauthorized.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "secret page")
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: &http.Client{}}
+	c.UseBearerToken(source, strings.TrimPrefix(server.URL, "http://"))
+
+	resp, err := c.Client.Get(server.URL + "/docs/page")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the request is retried with a fresh token after a 401")
+	assert.Equal(t, "secret page", string(body))
+	assert.Equal(t, int32(2), refreshes.Load())
+	assert.Equal(t, int32(1), unauthorized.Load())
+
+	// Later requests, concurrent ones too, reuse the cached token
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Client.Get(server.URL + "/docs/other")
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), refreshes.Load(), "the token is refreshed only on a 401")
+	assert.Equal(t, int32(1), unauthorized.Load())
+}
+
+func TestUseBearerToken_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var refreshes atomic.Int32
+	c := &Converter{Client: &http.Client{}}
+	c.UseBearerToken(func() (string, error) {
+		refreshes.Add(1)
+		return "never-valid", nil
+	}, strings.TrimPrefix(server.URL, "http://"))
+	resp, err := c.Client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "a token refused again is not refreshed in a loop")
+	assert.Equal(t, int32(2), refreshes.Load())
+}
+
+func TestUseBearerToken_OnlyInputHosts(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]string) // Authorization header by path
+	record := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+	}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		io.WriteString(w, "<html><body><main>elsewhere</main></body></html>")
+	}))
+	defer other.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+	}))
+	defer site.Close()
+
+	c := &Converter{Client: &http.Client{}}
+	c.UseBearerToken(func() (string, error) { return "secret", nil })
+	_, err := c.fetchDocument(site.URL + "/start")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer secret", seen["/start"], "the input URL's host gets the token")
+	assert.Empty(t, seen["/landing"], "a redirect to another host gets no Authorization header")
+
+	resp, err := c.Client.Get(other.URL + "/direct")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, seen["/direct"], "nor does any request to a host that is not an input")
+
+	c = &Converter{Client: &http.Client{}}
+	c.UseBearerToken(func() (string, error) { return "secret", nil }, strings.TrimPrefix(other.URL, "http://"))
+	_, err = c.fetchDocument(site.URL + "/start")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer secret", seen["/landing"], "hosts can be allowed explicitly")
+}
+
+func TestTokenSources(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			io.WriteString(w, `{"access_token": "from-json", "expires_in": 60}`)
+		case "/plain":
+			io.WriteString(w, "from-plain\n")
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer endpoint.Close()
+
+	testCases := []struct {
+		name    string
+		source  TokenSource
+		token   string
+		wantErr string
+	}{
+		{"command", TokenCommand("echo '  from-command  '"), "from-command", ""},
+		{"command json", TokenCommand(`echo '{"token": "from-command-json"}'`), "from-command-json", ""},
+		{"failing command", TokenCommand("echo leaked-token; echo denied >&2; exit 3"), "", "exit status 3: denied"},
+		{"empty command output", TokenCommand("true"), "", "no token found"},
+		{"endpoint json", TokenEndpoint(endpoint.URL + "/json"), "from-json", ""},
+		{"endpoint plain", TokenEndpoint(endpoint.URL + "/plain"), "from-plain", ""},
+		{"endpoint error", TokenEndpoint(endpoint.URL + "/denied"), "", "HTTP status 403"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := tc.source()
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.NotContains(t, err.Error(), "leaked-token", "errors never include a token")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.token, token)
+		})
+	}
+}
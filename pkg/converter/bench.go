@@ -0,0 +1,203 @@
+package converter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchOptions configures Benchmark.
+type BenchOptions struct {
+	URL         string // Page converted repeatedly; a built-in local page when empty
+	Selector    string
+	Requests    int   // Conversions per concurrency level
+	Concurrency []int // Levels to measure, in order
+}
+
+// BenchResult is the measurement of one concurrency level.
+type BenchResult struct {
+	Concurrency    int           `json:"concurrency"`
+	Requests       int           `json:"requests"`
+	Failed         int           `json:"failed"`
+	Duration       time.Duration `json:"durationNs"`
+	PagesPerSecond float64       `json:"pagesPerSecond"`
+	P50            time.Duration `json:"p50Ns"`
+	P90            time.Duration `json:"p90Ns"`
+	P99            time.Duration `json:"p99Ns"`
+	Max            time.Duration `json:"maxNs"`
+	AllocPerPage   uint64        `json:"allocBytesPerPage"` // Bytes allocated per conversion
+	PeakHeap       uint64        `json:"peakHeapBytes"`     // Highest heap in use, sampled
+}
+
+// benchSampleInterval is how often the heap is sampled during a benchmark.
+const benchSampleInterval = 10 * time.Millisecond
+
+// Benchmark converts a page Requests times at each concurrency level through
+// the same fetch, convert and write path as Convert, and reports throughput,
+// latency percentiles and memory use. Output goes to a temporary directory
+// that is removed afterwards. Without a URL, a page served from a local
+// listener is used, so no network access is needed.
+func Benchmark(opts BenchOptions) ([]BenchResult, error) {
+	u := opts.URL
+	local := u == ""
+	if local {
+		stop, addr, err := serveBenchPage()
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+		u = "http://" + addr + "/bench"
+	}
+
+	outputDir, err := os.MkdirTemp("", "doc-converter-bench-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create benchmark directory: %w", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	var results []BenchResult
+	for _, level := range opts.Concurrency {
+		c, err := NewConverter(outputDir)
+		if err != nil {
+			return nil, err
+		}
+		c.Concurrency = level
+		// Keep-alive connections for every worker, as a long run would have
+		c.Client.Transport = &http.Transport{MaxIdleConnsPerHost: level}
+		results = append(results, c.benchLevel(u, opts.Selector, opts.Requests, local))
+	}
+	return results, nil
+}
+
+// benchLevel runs one concurrency level. The local page is on a loopback
+// address, so it skips the URL validation that would block it.
+func (c *Converter) benchLevel(u, selector string, requests int, local bool) BenchResult {
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var stats runtime.MemStats
+		var peakHeap uint64
+		ticker := time.NewTicker(benchSampleInterval)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			peakHeap = max(peakHeap, stats.HeapInuse)
+			select {
+			case <-done:
+				peak <- peakHeap
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	latencies := make([]time.Duration, 0, requests)
+	var failed int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan struct{})
+	start := time.Now()
+	for i := 0; i < c.concurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				began := time.Now()
+				var result Result
+				if local {
+					result = c.convertPage(u, selector)
+				} else {
+					result = c.convertURL(u, selector)
+				}
+				elapsed := time.Since(began)
+
+				mu.Lock()
+				latencies = append(latencies, elapsed)
+				if !result.IsSuccess {
+					failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	duration := time.Since(start)
+	close(done)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	result := BenchResult{
+		Concurrency: c.concurrency(),
+		Requests:    requests,
+		Failed:      failed,
+		Duration:    duration,
+		P50:         percentile(latencies, 50),
+		P90:         percentile(latencies, 90),
+		P99:         percentile(latencies, 99),
+		PeakHeap:    <-peak,
+	}
+	if requests > 0 {
+		result.Max = latencies[len(latencies)-1]
+		result.PagesPerSecond = float64(requests) / duration.Seconds()
+		result.AllocPerPage = (after.TotalAlloc - before.TotalAlloc) / uint64(requests)
+	}
+	return result
+}
+
+// percentile returns the nearest-rank pth percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// serveBenchPage serves a documentation-like page on a loopback port and
+// returns a function that stops the server, and the server's address.
+func serveBenchPage() (func(), string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to start benchmark server: %w", err)
+	}
+	page := benchPage()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})}
+	go server.Serve(listener)
+	return func() { server.Close() }, listener.Addr().String(), nil
+}
+
+// benchPage builds a page of about 40KB with the elements the renderer
+// handles: headings, paragraphs with links and inline code, and code blocks.
+func benchPage() []byte {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head><title>Benchmark Page</title><meta name="description" content="A page for doc-converter bench"></head><body>`)
+	b.WriteString(`<nav><a href="/">Home</a> <a href="/docs">Docs</a> <a href="/blog">Blog</a></nav><main>`)
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&b, "<h2>Section %d</h2>", i)
+		for j := 0; j < 3; j++ {
+			fmt.Fprintf(&b, `<p>Paragraph %d of section %d explains a step of the guide, with a <a href="https://example.com/docs/%d/%d">reference link</a> and a mention of <code>config_%d.yaml</code> so that inline markup is rendered too.</p>`, j+1, i, i, j, i)
+		}
+		fmt.Fprintf(&b, "<pre><code class=\"language-go\">func step%d() error {\n\treturn run(%d)\n}</code></pre>", i, i)
+	}
+	b.WriteString(`</main><footer><p>Footer</p></footer></body></html>`)
+	return []byte(b.String())
+}
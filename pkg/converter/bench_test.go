@@ -0,0 +1,36 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchmark_LocalPage(t *testing.T) {
+	results, err := Benchmark(BenchOptions{Selector: "main", Requests: 6, Concurrency: []int{1, 3}})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	for i, r := range results {
+		assert.Equal(t, []int{1, 3}[i], r.Concurrency)
+		assert.Equal(t, 6, r.Requests)
+		assert.Zero(t, r.Failed, "the built-in page should convert without errors")
+		assert.Positive(t, r.PagesPerSecond)
+		assert.LessOrEqual(t, r.P50, r.P90)
+		assert.LessOrEqual(t, r.P99, r.Max)
+		assert.Positive(t, r.AllocPerPage)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 5*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 9*time.Millisecond, percentile(sorted, 90))
+	assert.Equal(t, 10*time.Millisecond, percentile(sorted, 99))
+	assert.Zero(t, percentile(nil, 50))
+}
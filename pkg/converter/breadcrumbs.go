@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// breadcrumbs returns the page's breadcrumb trail, from the first element to the
+// page itself. Elements matching BreadcrumbSelector are used when it is set and
+// matches; otherwise the trail is read from a JSON-LD BreadcrumbList.
+func (c *Converter) breadcrumbs(doc *goquery.Document) []string {
+	if c.BreadcrumbSelector != "" {
+		var trail []string
+		doc.Find(c.BreadcrumbSelector).Each(func(i int, s *goquery.Selection) {
+			if text := collapseWhitespace(s.Text()); text != "" {
+				trail = append(trail, text)
+			}
+		})
+		if len(trail) > 0 {
+			return trail
+		}
+	}
+
+	var trail []string
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return true // Malformed JSON-LD is common; skip it
+		}
+		trail = breadcrumbList(data)
+		return len(trail) == 0
+	})
+	return trail
+}
+
+// breadcrumbList finds a schema.org BreadcrumbList in decoded JSON-LD, including
+// inside arrays and @graph, and returns its item names ordered by position.
+func breadcrumbList(data interface{}) []string {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if trail := breadcrumbList(item); len(trail) > 0 {
+				return trail
+			}
+		}
+	case map[string]interface{}:
+		if v["@type"] != "BreadcrumbList" {
+			return breadcrumbList(v["@graph"])
+		}
+		elements, _ := v["itemListElement"].([]interface{})
+		type crumb struct {
+			position float64
+			name     string
+		}
+		var crumbs []crumb
+		for i, element := range elements {
+			e, ok := element.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := e["name"].(string)
+			if item, ok := e["item"].(map[string]interface{}); ok && name == "" {
+				name, _ = item["name"].(string)
+			}
+			position, ok := e["position"].(float64)
+			if !ok {
+				position = float64(i + 1)
+			}
+			if name = collapseWhitespace(name); name != "" {
+				crumbs = append(crumbs, crumb{position, name})
+			}
+		}
+		sort.SliceStable(crumbs, func(i, j int) bool { return crumbs[i].position < crumbs[j].position })
+		trail := make([]string, 0, len(crumbs))
+		for _, c := range crumbs {
+			trail = append(trail, c.name)
+		}
+		return trail
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerCooldown is how long a host's circuit stays open when
+// BreakerCooldown is unset.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// hostBreakers is a circuit breaker per host. After threshold consecutive
+// failures a host's circuit opens and its URLs fail fast; once the cooldown
+// has passed, a single URL is let through as a probe. A successful probe
+// closes the circuit, a failed one opens it for another cooldown.
+type hostBreakers struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+}
+
+type hostBreaker struct {
+	failures  int       // Consecutive failures
+	openUntil time.Time // Zero while the circuit is closed
+	probing   bool      // A probe is in flight
+}
+
+// newHostBreakers returns the breakers for a run, or nil (which never trips)
+// when threshold is zero.
+func newHostBreakers(threshold int, cooldown time.Duration) *hostBreakers {
+	if threshold <= 0 {
+		return nil
+	}
+	return &hostBreakers{threshold: threshold, cooldown: cooldown, now: time.Now, hosts: make(map[string]*hostBreaker)}
+}
+
+// allow reports an error when requests to host must fail fast.
+func (b *hostBreakers) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hb := b.hosts[host]
+	if hb == nil || hb.openUntil.IsZero() {
+		return nil
+	}
+	if hb.probing || b.now().Before(hb.openUntil) {
+		return fmt.Errorf("circuit open for %s after %d consecutive failures; skipped until %s",
+			host, hb.failures, hb.openUntil.Format(time.TimeOnly))
+	}
+	hb.probing = true
+	return nil
+}
+
+// record updates host's circuit with the outcome of a conversion.
+func (b *hostBreakers) record(host string, err error) {
+	if b == nil || errors.Is(err, ErrBlocked) || errors.Is(err, ErrInvalidURL) {
+		return // The host was never contacted
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hb := b.hosts[host]
+	if hb == nil {
+		hb = &hostBreaker{}
+		b.hosts[host] = hb
+	}
+	hb.probing = false
+	if !isHostFailure(err) {
+		*hb = hostBreaker{}
+		return
+	}
+	hb.failures++
+	if hb.failures >= b.threshold {
+		hb.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// isHostFailure reports whether err means the host is unwell: the request timed
+// out or failed, or the server answered with a 5xx status. Other failures, such
+// as a 404 or a selector that matches nothing, come from a working host.
+func isHostFailure(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Kind {
+	case ErrTimeout, ErrDNS:
+		return true
+	case ErrFetch:
+		return e.StatusCode == 0 || e.StatusCode >= 500
+	}
+	return false
+}
+
+// breakerHost returns the host that u's circuit is kept for.
+func breakerHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+func (c *Converter) breakerCooldown() time.Duration {
+	if c.BreakerCooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+	return c.BreakerCooldown
+}
@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostBreakers(t *testing.T) {
+	now := time.Date(2025, 8, 10, 12, 0, 0, 0, time.UTC)
+	b := newHostBreakers(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	unavailable := &Error{Kind: ErrFetch, StatusCode: 503, Err: errors.New("HTTP status 503")}
+	notFound := &Error{Kind: ErrFetch, StatusCode: 404, Err: errors.New("HTTP status 404")}
+	timeout := &Error{Kind: ErrTimeout, Err: errors.New("deadline exceeded")}
+
+	b.record("down.example", unavailable)
+	assert.NoError(t, b.allow("down.example"), "one failure is below the threshold")
+	b.record("down.example", timeout)
+	assert.ErrorContains(t, b.allow("down.example"), "circuit open for down.example after 2 consecutive failures")
+	assert.NoError(t, b.allow("up.example"), "circuits are kept per host")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.allow("down.example"), "a probe is let through after the cooldown")
+	assert.Error(t, b.allow("down.example"), "only one probe at a time")
+	b.record("down.example", unavailable)
+	assert.Error(t, b.allow("down.example"), "a failed probe reopens the circuit")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.allow("down.example"))
+	b.record("down.example", nil)
+	assert.NoError(t, b.allow("down.example"), "a successful probe closes the circuit")
+	b.record("down.example", unavailable)
+	assert.NoError(t, b.allow("down.example"), "the failure count starts over")
+
+	b.record("flaky.example", unavailable)
+	b.record("flaky.example", notFound)
+	b.record("flaky.example", unavailable)
+	assert.NoError(t, b.allow("flaky.example"), "a 404 comes from a working host and resets the count")
+
+	var disabled *hostBreakers
+	disabled.record("down.example", unavailable)
+	assert.NoError(t, disabled.allow("down.example"))
+}
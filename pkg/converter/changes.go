@@ -0,0 +1,229 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeEvent is emitted when a page body changed beyond the monitor's threshold.
+type ChangeEvent struct {
+	Source        string  `json:"source"`
+	ChangePercent float64 `json:"changePercent"`
+	PreviousHash  string  `json:"previousHash"`
+	CurrentHash   string  `json:"currentHash"`
+	DetectedAt    string  `json:"detectedAt"`
+}
+
+// ChangeMonitor compares newly converted bodies against the version stored by
+// the previous conversion of the same canonical URL.
+type ChangeMonitor struct {
+	Dir        string  // Directory holding the previously converted bodies
+	Threshold  float64 // Minimum percentage of changed lines that triggers an event
+	WebhookURL string  // Optional endpoint that receives each ChangeEvent as JSON
+	Client     *http.Client
+
+	mu    sync.Mutex
+	locks map[string]*historyLock // Held while a page's stored version is read and replaced
+
+	start      sync.Once
+	queue      chan *ChangeEvent // Events waiting for the webhook
+	delivering sync.WaitGroup
+}
+
+// changeQueueSize is the number of events that may wait for the webhook;
+// events beyond it are dropped and logged rather than stalling conversions.
+const changeQueueSize = 100
+
+// historyLock serializes the checks of one page; users counts the checks
+// holding or waiting for it, so that it is dropped once none do.
+type historyLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// NewChangeMonitor creates a ChangeMonitor storing prior bodies in dir.
+func NewChangeMonitor(dir string, threshold float64, webhookURL string) (*ChangeMonitor, error) {
+	if threshold < 0 || threshold > 100 {
+		return nil, fmt.Errorf("change threshold must be between 0 and 100, got %v", threshold)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &ChangeMonitor{
+		Dir:        dir,
+		Threshold:  threshold,
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: httpTimeout},
+	}, nil
+}
+
+// Check compares body with the stored version for source and records body as the
+// new version. It returns a ChangeEvent when the change exceeds the threshold, or
+// nil when the page is new, unchanged, or changed too little. Checks of
+// different pages run in parallel; only the swap of the stored version is
+// serialized per page, and the bodies are only diffed when their hashes differ.
+func (m *ChangeMonitor) Check(source, body string) (*ChangeEvent, error) {
+	key := hashString(canonicalURL(source))
+	previous, err := m.swap(key, source, body)
+	if err != nil || previous == nil {
+		return nil, err
+	}
+	previousHash, currentHash := hashString(string(previous)), hashString(body)
+	if previousHash == currentHash {
+		return nil, nil
+	}
+
+	percent := changePercent(string(previous), body)
+	if percent <= m.Threshold {
+		return nil, nil
+	}
+	return &ChangeEvent{
+		Source:        source,
+		ChangePercent: percent,
+		PreviousHash:  previousHash,
+		CurrentHash:   currentHash,
+		DetectedAt:    time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// swap stores body as the version of source, whose file is named after key,
+// and returns the version it replaces, nil for a page seen for the first time.
+func (m *ChangeMonitor) swap(key, source, body string) ([]byte, error) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*historyLock)
+	}
+	lock := m.locks[key]
+	if lock == nil {
+		lock = &historyLock{}
+		m.locks[key] = lock
+	}
+	lock.users++
+	m.mu.Unlock()
+
+	lock.mu.Lock()
+	defer func() {
+		lock.mu.Unlock()
+		m.mu.Lock()
+		if lock.users--; lock.users == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}()
+
+	path := filepath.Join(m.Dir, key+".md")
+	previous, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read previous version of %s: %w", source, err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		return nil, fmt.Errorf("failed to store current version of %s: %w", source, err)
+	}
+	return previous, nil
+}
+
+// Notify logs the event and queues it for the webhook, if one is configured.
+// Events are delivered one at a time in the background, so a slow webhook
+// never holds up a conversion; when changeQueueSize events are already
+// waiting, the event is dropped with an error.
+func (m *ChangeMonitor) Notify(event *ChangeEvent) {
+	log.Printf("INFO: Content change detected for %s (%.1f%% changed)", event.Source, event.ChangePercent)
+	if m.WebhookURL == "" {
+		return
+	}
+	m.start.Do(func() {
+		m.queue = make(chan *ChangeEvent, changeQueueSize)
+		m.delivering.Add(1)
+		go func() {
+			defer m.delivering.Done()
+			for event := range m.queue {
+				m.deliver(event)
+			}
+		}()
+	})
+	select {
+	case m.queue <- event:
+	default:
+		log.Printf("ERROR: Dropped change event for %s: %d events already waiting for the webhook", event.Source, changeQueueSize)
+	}
+}
+
+// Close waits for the queued events to be delivered. Notify must not be
+// called after it.
+func (m *ChangeMonitor) Close() {
+	m.start.Do(func() {}) // No event was ever queued
+	if m.queue != nil {
+		close(m.queue)
+		m.delivering.Wait()
+	}
+}
+
+// deliver posts event to the webhook.
+func (m *ChangeMonitor) deliver(event *ChangeEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal change event for %s: %v", event.Source, err)
+		return
+	}
+	resp, err := m.Client.Post(m.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("ERROR: Failed to deliver change event for %s: %v", event.Source, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("ERROR: Change webhook returned HTTP status %d for %s", resp.StatusCode, event.Source)
+	}
+}
+
+// changePercent returns the share of lines added or removed between a and b.
+func changePercent(a, b string) float64 {
+	linesA, linesB := splitLines(a), splitLines(b)
+	total := len(linesA) + len(linesB)
+	if total == 0 {
+		return 0
+	}
+	var changed int
+	for _, op := range diffLines(linesA, linesB) {
+		if op.kind != ' ' {
+			changed++
+		}
+	}
+	return float64(changed) / float64(total) * 100
+}
+
+// canonicalURL normalizes a URL so that trivially different spellings of the
+// same page share one history entry.
+func canonicalURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// hashString returns the hex-encoded SHA-256 digest of s.
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
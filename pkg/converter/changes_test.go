@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeMonitor_Threshold(t *testing.T) {
+	m := &ChangeMonitor{Dir: t.TempDir(), Threshold: 20}
+	lines := func(changed int) string {
+		var b strings.Builder
+		for i := 0; i < 10; i++ {
+			if i < changed {
+				b.WriteString("changed\n")
+			} else {
+				b.WriteString("line\n")
+			}
+		}
+		return b.String()
+	}
+
+	event, err := m.Check("https://example.com/page", lines(0))
+	require.NoError(t, err)
+	assert.Nil(t, event, "a page seen for the first time is not a change")
+
+	event, err = m.Check("https://example.com/page", lines(0))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+
+	// One line of ten: one deletion and one addition of twenty lines, 10%.
+	event, err = m.Check("https://example.com/page", lines(1))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+
+	event, err = m.Check("https://example.com/page", lines(5))
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, "https://example.com/page", event.Source)
+	assert.InDelta(t, 40, event.ChangePercent, 0.01)
+	assert.Equal(t, hashString(lines(1)), event.PreviousHash)
+	assert.Equal(t, hashString(lines(5)), event.CurrentHash)
+}
+
+func TestChangeMonitor_KeyedByCanonicalURL(t *testing.T) {
+	dir := t.TempDir()
+	m := &ChangeMonitor{Dir: dir}
+
+	event, err := m.Check("HTTPS://Example.com:443#top", "before\n")
+	require.NoError(t, err)
+	assert.Nil(t, event)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, hashString("https://example.com/")+".md", entries[0].Name())
+
+	event, err = m.Check("https://example.com/", "after\n")
+	require.NoError(t, err)
+	require.NotNil(t, event, "both spellings share one stored version")
+
+	stored, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", string(stored))
+}
+
+func TestChangeMonitor_Webhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var payload map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	m := &ChangeMonitor{Dir: t.TempDir(), WebhookURL: server.URL, Client: server.Client()}
+	_, err := m.Check("https://example.com/page", "before\n")
+	require.NoError(t, err)
+	event, err := m.Check("https://example.com/page", "after\n")
+	require.NoError(t, err)
+	require.NotNil(t, event)
+
+	m.Notify(event)
+	m.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	assert.Equal(t, "https://example.com/page", received[0]["source"])
+	assert.Equal(t, float64(100), received[0]["changePercent"])
+	assert.Equal(t, hashString("before\n"), received[0]["previousHash"])
+	assert.Equal(t, hashString("after\n"), received[0]["currentHash"])
+	assert.NotEmpty(t, received[0]["detectedAt"])
+	assert.Len(t, received[0], 5)
+}
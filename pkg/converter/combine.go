@@ -0,0 +1,80 @@
+package converter
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hostFileChars matches the characters dropped from a host when it becomes a file name.
+var hostFileChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// hostFileName returns the name of the combined file for the host of u, e.g.
+// "docs.example.com.md", or "example.com_8080.md" when a port is given.
+func (c *Converter) hostFileName(u string) string {
+	return safeHostName(u) + c.renderer().extension()
+}
+
+// safeHostName returns the host of u, with its port, as it appears in file and
+// directory names.
+func safeHostName(u string) string {
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		return hostFileChars.ReplaceAllString(strings.ToLower(parsed.Host), "_")
+	}
+	return "unknown_host"
+}
+
+// writeCombined writes one file per host that concatenates the successfully
+// converted pages in results, in order. Each page becomes a section headed by
+// its title and a link to its source.
+func (c *Converter) writeCombined(results []Result) error {
+	var files []string
+	sections := make(map[string][]Result)
+	for _, r := range results {
+		if !r.IsSuccess {
+			continue
+		}
+		if _, seen := sections[r.FileName]; !seen {
+			files = append(files, r.FileName)
+		}
+		sections[r.FileName] = append(sections[r.FileName], r)
+	}
+
+	rdr := c.renderer()
+	for _, name := range files {
+		pages := sections[name]
+		host := strings.TrimSuffix(name, filepath.Ext(name))
+		if parsed, err := url.Parse(pages[0].URL); err == nil && parsed.Host != "" {
+			host = parsed.Host
+		}
+
+		var sources []string
+		var parts []string
+		for _, p := range pages {
+			sources = append(sources, p.URL)
+			parts = append(parts, rdr.heading(1, p.Section), rdr.paragraph(rdr.link(p.URL, p.URL)))
+			if body := string(p.Content); body != "" {
+				parts = append(parts, body)
+			}
+		}
+
+		metadata := map[string]interface{}{
+			"title":        host,
+			"sources":      sources,
+			"retrieved_at": c.timestamp(time.Now()),
+		}
+		c.addExtraMetadata(metadata)
+		header, err := c.frontmatter(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to render frontmatter for %s: %w", name, err)
+		}
+		content := append(header, strings.Join(parts, "\n\n")...)
+		if err := c.writeFile(filepath.Join(c.OutputDir, name), content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
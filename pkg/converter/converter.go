@@ -3,33 +3,60 @@ package converter
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
 	"github.com/google/uuid"
-	"gopkg.in/yaml.v2"
+	"golang.org/x/net/html"
 )
 
 const (
-	maxBodySize = 5 * 1024 * 1024 // 5MB
+	// DefaultMaxBodySize is the largest response body accepted for a page when MaxBodySize is unset.
+	DefaultMaxBodySize = 5 * 1024 * 1024 // 5MB
+	// DefaultConcurrency is the number of pages processed in parallel when Concurrency is unset.
+	DefaultConcurrency = 8
+	// DefaultDirMode and DefaultFileMode are the permissions of created output
+	// directories and of files when FileMode is unset.
+	DefaultDirMode  os.FileMode = 0755
+	DefaultFileMode os.FileMode = 0644
+
 	httpTimeout = 5 * time.Second
 )
 
 // Result holds the outcome of a single URL conversion.
 type Result struct {
-	URL       string `json:"url"`
-	FileName  string `json:"fileName"`
-	Content   []byte `json:"-"` // Exclude raw content from logs. Kept for CLI compatibility.
-	Error     string `json:"error,omitempty"`
-	IsSuccess bool   `json:"isSuccess"`
+	URL        string        `json:"url"`
+	FileName   string        `json:"fileName"`
+	Title      string        `json:"title,omitempty"`
+	Section    string        `json:"section,omitempty"` // Heading of the page's section in a combined file
+	Regions    []RegionFile  `json:"regions,omitempty"` // The files of a page split into Regions; FileName is the first
+	Parts      []string      `json:"parts,omitempty"`   // The files of a page split by SplitTokens; FileName is the first
+	MatchCount int           `json:"matchCount"`        // Elements the selector matched, 1 for the whole page: 0 is a miss, many may mean an over-broad selector
+	Content    []byte        `json:"-"`                 // Exclude raw content from logs. Kept for CLI compatibility.
+	Error      string        `json:"error,omitempty"`
+	Err        error         `json:"-"` // The failure as an *Error, for callers that handle kinds of failure
+	IsSuccess  bool          `json:"isSuccess"`
+	Skipped    bool          `json:"skipped,omitempty"`  // Not converted, but not failed either: unchanged since ModifiedSince, or a skip signal found
+	Duration   time.Duration `json:"duration,omitempty"` // Time taken to fetch and convert the page, in nanoseconds in JSON
+	Retrieved  time.Time     `json:"-"`                  // When the page was fetched; its retrieved_at
 }
 
 // Summary provides a final overview of the batch conversion.
@@ -37,182 +64,560 @@ type Summary struct {
 	TotalURLs      int      `json:"totalUrls"`
 	Successful     int      `json:"successful"`
 	Failed         int      `json:"failed"`
+	Skipped        int      `json:"skipped"`               // URLs neither converted nor failed, such as pages not modified since ModifiedSince or marked noindex
+	DNSFailures    int      `json:"dnsFailures"`           // Failed URLs whose host does not resolve; included in Failed
+	Interrupted    bool     `json:"interrupted,omitempty"` // The run was cancelled before every URL was started
+	NotStarted     int      `json:"notStarted,omitempty"`  // URLs left unprocessed by an interrupted run
 	FailedURLs     []string `json:"failedUrls"`
 	ProcessingTime string   `json:"processingTime"`
 	DownloadID     string   `json:"downloadId,omitempty"` // ID for the final zip file
 }
 
+// ProgressFunc is called as each URL completes with the number of URLs done so
+// far, the total, and the result of the URL that just completed.
+type ProgressFunc func(done, total int, last Result)
+
 // Converter holds the configuration and methods for conversion.
 type Converter struct {
-	Client     *http.Client
-	OutputDir  string
-	DownloadID string
+	Client       *http.Client
+	OutputDir    string
+	DownloadID   string
+	Changes      *ChangeMonitor    // Optional; reports pages whose body changed since the last conversion
+	EmojiStyle   string            // EmojiKeep (default) or EmojiShortcode
+	Format       string            // Output format: FormatMarkdown (default), FormatAsciiDoc or FormatRST
+	HeadingStyle string            // Markdown headings: HeadingATX (default) or HeadingSetext
+	RichMarkdown bool              // Markdown with code blocks, lists, tables and links inline in their paragraphs
+	AnchorStyle  string            // Heading ids: AnchorNone (default), AnchorHTML or AnchorAttribute; other formats use their own anchors for either
+	FileNames    map[string]string // Optional output filenames keyed by URL, overriding the title-derived name
+
+	// ModifiedSince, when set, makes page requests conditional with an
+	// If-Modified-Since header. Pages the server reports unchanged are
+	// skipped: their Result has Skipped set and an ErrNotModified error.
+	ModifiedSince time.Time
+
+	// SkipSelector and SkipNoindex skip pages that ask not to be converted:
+	// those with an element matched by SkipSelector, such as a .noindex marker,
+	// and with SkipNoindex those with a robots meta tag with noindex. Such a
+	// page is not written; its Result has Skipped set and an ErrSkipSignal error.
+	SkipSelector string
+	SkipNoindex  bool
+
+	// ExtraMetadata holds fixed fields added to the metadata of every page, as
+	// strings or []string lists. A field also extracted from the page keeps its
+	// extracted value unless ExtraMetadataWins is set.
+	ExtraMetadata     map[string]interface{}
+	ExtraMetadataWins bool
+
+	// MaxHeadingDepth, when set, caps the heading levels in the output: deeper
+	// headings are demoted as HeadingDemotion says, HeadingDemoteBold by default.
+	MaxHeadingDepth int
+	HeadingDemotion string
+
+	// SplitTokens, when positive, caps the size of Markdown files for LLM
+	// context windows: a page estimated at more tokens is written as parts of
+	// at most that many, split at paragraph boundaries, to name-part1.md,
+	// name-part2.md and so on. Each part's metadata gives its part number and
+	// the number of parts. Tokens are estimated from the words and characters.
+	SplitTokens int
+
+	// Filenames derived from the URL of a page without a title include its query
+	// parameters ("page?id=42" becomes page_id_42), so pages told apart only by
+	// the query don't overwrite each other. DropQuery leaves them all out;
+	// QueryParams, when set, keeps only the named ones.
+	DropQuery   bool
+	QueryParams []string
+
+	// TimestampFormat is the Go time layout of retrieved_at (time.RFC3339 when
+	// empty); see TimestampLayout for the named formats. UTC writes it in UTC
+	// rather than local time.
+	TimestampFormat string
+	UTC             bool
+
+	// ContentHash adds a content_hash field to the frontmatter, the digest of
+	// the page body with this algorithm (HashSHA256, HashSHA512, HashSHA1 or
+	// HashMD5), so that runs can be compared without diffing the pages.
+	ContentHash string
+
+	// LinkBase resolves the relative links of each page against a base URL:
+	// the request URL, the canonical URL or the <base href> (LinkBaseRequest,
+	// LinkBaseCanonical, LinkBaseDocument), or with LinkBaseAuto the <base
+	// href>, else the canonical URL, else the request URL. Links then still
+	// work once the page is republished elsewhere. They are written as they
+	// are when empty.
+	LinkBase string
+
+	// SectionHeading, when set, narrows the extracted content to the section
+	// whose heading text it matches: the heading and what follows it, up to the
+	// next heading of the same or a higher level.
+	SectionHeading *regexp.Regexp
+
+	// FollowIframes fetches the source of each same-origin <iframe> and splices
+	// its content into the page in place of the frame, before the selector is
+	// applied. Cross-origin frames are never fetched.
+	FollowIframes bool
+
+	// Breadcrumbs adds the page's breadcrumb trail to the metadata as a
+	// "breadcrumbs" list when one is found. BreadcrumbSelector matches the
+	// individual crumbs; without it, or when it matches nothing, the trail is
+	// read from a JSON-LD BreadcrumbList.
+	Breadcrumbs        bool
+	BreadcrumbSelector string
+
+	// Layout shapes the output for a static site generator: LayoutHugo writes
+	// each page as a Hugo page bundle and LayoutJekyll as a dated Jekyll post,
+	// each with the frontmatter date it expects. The page's
+	// article:published_time is its date, or else the time it was retrieved.
+	Layout string
+
+	// TitleSelector, when set, reads the title used for filenames and metadata
+	// from the first element it matches, falling back to <title> when nothing
+	// matches. TitleStrip is removed from the <title> text, e.g. a " | Site"
+	// suffix.
+	TitleSelector string
+	TitleStrip    *regexp.Regexp
+
+	// FetchOnly saves each page's raw HTML as fetched, with its metadata in a
+	// YAML sidecar file, instead of extracting and rendering its content.
+	FetchOnly bool
+
+	// Render selects how pages are loaded: RenderStatic (default) parses the
+	// HTML as served, RenderJS runs it in a headless browser first. BrowserPath
+	// names the browser; by default Chrome or Chromium is looked up in PATH.
+	Render      string
+	BrowserPath string
+
+	// WaitFor delays extraction in RenderJS mode until an element matches this
+	// selector, for pages that fill in their content asynchronously. After
+	// WaitTimeout (DefaultWaitTimeout when unset) the page is converted as it is.
+	WaitFor     string
+	WaitTimeout time.Duration
+
+	// Preflight sends a HEAD request before each GET and skips the GET when the
+	// response is an error or not HTML. Servers that reject HEAD are fetched
+	// as usual.
+	Preflight bool
+
+	// Manifest writes a manifest.json recording the run's settings, summary and
+	// per-URL results once the run completes.
+	Manifest bool
+
+	// CombineByHost writes one file per host, named after it, that holds the
+	// host's pages as sections in input order, instead of one file per page.
+	// The pages are kept in memory until the run completes, as MemoryCeiling
+	// counts.
+	CombineByHost bool
+
+	// EmitIndex writes an index.html linking every converted page once the run completes.
+	EmitIndex bool
+
+	// EmitSitemap writes a sitemap.xml listing the source URL of every converted
+	// page, with the time it was retrieved as its lastmod, once the run completes.
+	EmitSitemap bool
+
+	// SliceStart and SliceEnd are an experimental escape hatch for content no
+	// selector captures: after rendering, the text is trimmed to the region
+	// between their matches. A page where SliceStart does not match fails.
+	SliceStart *regexp.Regexp
+	SliceEnd   *regexp.Regexp
+
+	// SelectorIndex picks which match of the content selector is converted: 1 is
+	// the first match, -1 the last. Zero keeps the default of the first match.
+	SelectorIndex int
+
+	// SelectorAttr, when set, extracts the value of this attribute from the
+	// selector's matches, one per line, and writes it as is instead of the
+	// rendered content. A match without the attribute fails the page.
+	SelectorAttr string
+
+	// SelectorRules pick the content selector per page, for sites with several
+	// page templates. The first rule whose condition matches wins; pages that
+	// match none use the selector given to Convert.
+	SelectorRules []SelectorRule
+
+	// ValidateMarkdown checks each page's rendered Markdown with CheckMarkdown
+	// and logs the problems found as warnings; StrictMarkdown fails the page
+	// with ErrInvalidMarkdown instead. Other output formats are not checked.
+	ValidateMarkdown bool
+	StrictMarkdown   bool
+
+	// InputFormat is InputHTML (the default) or InputXML. XML documents, such as
+	// DocBook, are selected with an XMLPath in place of the CSS selector and
+	// rendered by mapping element names to blocks: XMLElements, keyed by
+	// element name, overrides and extends DocBookElements.
+	InputFormat string
+	XMLElements map[string]string
+
+	// Regions, when set, split each page into one file per region instead of
+	// converting the selector's match: page-<name>.md holds what the region's
+	// selector matches. A page fails unless every region matches.
+	Regions []Region
+
+	// Progress, when set, is called once per URL as it completes. Calls are
+	// serialized, so done increases by one each time, but they hold up the
+	// workers: keep the function quick.
+	Progress ProgressFunc
+
+	// OnLog, when set, also receives the lines logged about each page during a
+	// run, such as failures and warnings. It is called from the workers, at
+	// the same time for different pages: keep it quick and safe for that.
+	OnLog func(LogEntry)
+
+	// Concurrency and MaxBodySize bound memory use: at most Concurrency pages are
+	// in flight, each with a body of at most MaxBodySize bytes.
+	Concurrency int
+	MaxBodySize int64
+
+	// ResultsBuffer is the capacity of the results channel: how many completed
+	// pages the workers may hand over before a slow consumer reads them. The
+	// default, 0, is unbuffered, so each worker waits for its result to be read
+	// before starting another page. Buffered results hold the converted
+	// content, which MemoryCeiling counts like pages in flight.
+	ResultsBuffer int
+
+	// MaxBodySizes overrides MaxBodySize for responses of some content types.
+	// Keys are media types ("text/html") or wildcards of a top-level type
+	// ("image/*"); the exact media type wins over a wildcard.
+	MaxBodySizes map[string]int64
+
+	// AcceptStatus lists HTTP status codes other than 200 whose responses are
+	// converted like a 200's, such as 203 or a custom 404 page to archive.
+	AcceptStatus []int
+
+	// BreakerThreshold, when positive, opens a host's circuit after that many
+	// consecutive timeouts, failed requests or 5xx responses: its remaining
+	// URLs fail with ErrCircuitOpen, without being requested, until
+	// BreakerCooldown (DefaultBreakerCooldown when unset) has passed and a
+	// probe succeeds.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// FileMode is the permission of every file written to OutputDir, applied
+	// regardless of the umask.
+	FileMode os.FileMode
+
+	// Shard distributes the pages into subdirectories of OutputDir (ShardHash
+	// or ShardHost) to keep huge runs listable. Result.FileName is then the path
+	// relative to OutputDir. Sharded directories are created with DirMode.
+	Shard   string
+	DirMode os.FileMode
+
+	// SingleJSON, when set, also receives every converted page of a run as an
+	// element of one JSON array of PageRecords, written as the pages complete.
+	// The array is closed when the run ends; closing the writer is the caller's.
+	SingleJSON io.Writer
+
+	// PreserveOrder writes the SingleJSON pages in the order of the URLs given
+	// to Convert rather than as they complete, holding back pages that finish
+	// before an earlier URL. The results channel is unaffected.
+	PreserveOrder bool
+
+	// ZIM, when set, receives a ZIM archive of the pages of a run, for offline
+	// readers such as Kiwix: their extracted HTML, with links between them kept,
+	// and a main page listing them. It is written when the run ends, titled
+	// ZIMTitle or after the host; closing the writer is the caller's.
+	ZIM      io.Writer
+	ZIMTitle string
+
+	resolver    *hostResolver    // Set by UseResolver
+	userAgents  *userAgentPool   // Set by UseUserAgents
+	recorded    *HAR             // Set by UseHAR
+	pages       *jsonArray       // Writes to SingleJSON during a run
+	names       *nameRegistry    // The file names given to pages, set by NewConverter
+	zim         *zimArchive      // Collects the pages for ZIM during a run
+	credentials *credentialHosts // Set by UseBearerToken and UseDigestAuth
 }
 
 // NewConverter creates a new Converter with a secure HTTP client and output configuration.
 // If outputDir is empty, a temporary directory with a UUID will be created.
 func NewConverter(outputDir string) (*Converter, error) {
-	var finalOutputDir string
-	var downloadID string
-
 	if outputDir == "" {
 		// Server mode: create a temporary directory
-		downloadID = uuid.New().String()
-		finalOutputDir = filepath.Join("tmp", "downloads", downloadID)
-	} else {
-		// CLI mode: use the provided directory
-		finalOutputDir = outputDir
+		return NewDownloadConverter(uuid.New().String())
 	}
-
-	if err := os.MkdirAll(finalOutputDir, 0755); err != nil {
+	// CLI mode: use the provided directory
+	if err := os.MkdirAll(outputDir, DefaultDirMode); err != nil {
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
+	return newConverter(outputDir, ""), nil
+}
+
+// NewDownloadConverter creates a server-mode Converter that writes into a new
+// temporary directory for the download with the given ID.
+func NewDownloadConverter(downloadID string) (*Converter, error) {
+	dir := filepath.Join("tmp", "downloads", downloadID)
+	if err := createDownloadDir(dir); err != nil {
+		return nil, err
+	}
+	return newConverter(dir, downloadID), nil
+}
 
-	return &Converter{
+func newConverter(outputDir, downloadID string) *Converter {
+	c := &Converter{
 		Client: &http.Client{
 			Timeout: httpTimeout,
 		},
-		OutputDir:  finalOutputDir,
-		DownloadID: downloadID,
-	}, nil
+		OutputDir:   outputDir,
+		DownloadID:  downloadID,
+		Concurrency: DefaultConcurrency,
+		MaxBodySize: DefaultMaxBodySize,
+		FileMode:    DefaultFileMode,
+		names:       newNameRegistry(),
+	}
+	// The system resolver, so that pages are fetched from the addresses the URL
+	// validation approved; it cannot fail on the default transport
+	c.UseResolver("", nil)
+	return c
+}
+
+// createDownloadDir creates the directory of a new download. A directory that
+// already holds files belongs to another job, so it is refused rather than
+// mixing the two jobs' output.
+func createDownloadDir(dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), DefaultDirMode); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	err := os.Mkdir(dir, DefaultDirMode)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read existing output directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("download directory %s is already populated by another job", dir)
+	}
+	return nil
 }
 
 // Convert orchestrates the fetching, parsing, and conversion of multiple URLs concurrently.
+// At most Concurrency pages are processed at a time.
 func (c *Converter) Convert(urls []string, selector string) (<-chan Result, <-chan Summary) {
-	resultsChan := make(chan Result)
+	return c.ConvertContext(context.Background(), urls, selector)
+}
+
+// ConvertContext is Convert, interrupted when ctx is done: no page is started
+// after that, the pages in progress are finished, and the run ends as usual
+// with a summary and run-level artifacts covering what completed. The summary
+// is then marked Interrupted and counts the URLs that were never started.
+func (c *Converter) ConvertContext(ctx context.Context, urls []string, selector string) (<-chan Result, <-chan Summary) {
+	input := make(chan string)
+	go func() {
+		defer close(input)
+		for _, u := range urls {
+			input <- u
+		}
+	}()
+	return c.ConvertFrom(ctx, input, len(urls), selector)
+}
+
+// ConvertFrom is ConvertContext for URLs received from urls until it is
+// closed, each taken as a worker frees up, so that the caller never has to
+// hold the whole list. total is the number of URLs urls delivers, as passed to
+// Progress; 0 passes the number received so far instead. After an
+// interruption, the URLs still to come are read and counted as not started,
+// so urls must be closed. Of the pages completed, a run keeps only the failed
+// URLs, for the summary, unless Manifest, EmitIndex, EmitSitemap or
+// CombineByHost need every result once it ends; a ZIM archive keeps every URL.
+func (c *Converter) ConvertFrom(ctx context.Context, urls <-chan string, total int, selector string) (<-chan Result, <-chan Summary) {
+	resultsChan := make(chan Result, max(c.ResultsBuffer, 0))
 	summaryChan := make(chan Summary)
 
 	go func() {
 		startTime := time.Now()
 		var wg sync.WaitGroup
-		var successCount, errorCount int
-		var failedURLs []string
-		var mu sync.Mutex // To protect shared summary variables
+		var successCount, errorCount, skippedCount, dnsCount, droppedCount int
+		var results []Result // Kept for the run-level artifacts written once all pages are done
+		var positions []int  // The position in the input of each of results
+		var failed []job     // The failed URLs, when results are not kept
+		var completed int    // Pages finished, as passed to Progress
+		var received int     // URLs taken from urls
+		var mu sync.Mutex    // To protect shared summary variables
 
-		for _, u := range urls {
+		// Only the run-level artifacts need every result; without them, a run
+		// over a long list keeps its failures alone.
+		keepResults := c.Manifest || c.EmitIndex || c.EmitSitemap || c.CombineByHost
+
+		breakers := newHostBreakers(c.BreakerThreshold, c.breakerCooldown())
+		if c.SingleJSON != nil {
+			c.pages = newJSONArray(c.SingleJSON, c.PreserveOrder)
+		}
+		var order []string // The URLs in input order, listed on the ZIM archive's main page
+		if c.ZIM != nil {
+			c.zim = newZIMArchive(c.ZIM, c.ZIMTitle)
+		}
+		jobs := make(chan job)
+		for i := 0; i < c.concurrency(); i++ {
 			wg.Add(1)
-			go func(u string) {
+			go func() {
 				defer wg.Done()
+				for job := range jobs {
+					i, u := job.position, job.url
+					if ctx.Err() != nil {
+						// Handed over as the run was interrupted
+						mu.Lock()
+						droppedCount++
+						mu.Unlock()
+						if c.pages != nil {
+							c.pages.complete(i)
+						}
+						continue
+					}
+					pageStart := time.Now()
+					var result Result
+					host := breakerHost(u)
+					if err := breakers.allow(host); err != nil {
+						c.logf(u, "ERROR: Failed to process %s: %v", u, err)
+						result = failure(u, newError(ErrCircuitOpen, u, err))
+					} else {
+						result = c.convertURL(u, selector)
+						breakers.record(host, result.Err)
+					}
+					result.Duration = time.Since(pageStart)
+					if c.pages != nil {
+						if err := c.pages.complete(i); err != nil {
+							log.Printf("ERROR: Failed to write to the JSON output: %v", err)
+						}
+					}
 
-				// URL Validation
-				isPublic, err := c.isPublicURL(u)
-				if err != nil {
-					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
-					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: fmt.Sprintf("URL validation failed: %v", err), IsSuccess: false}
-					return
-				}
-				if !isPublic {
-					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
-					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: "SSRF attack suspected: URL resolves to a non-public IP", IsSuccess: false}
-					return
-				}
-
-				content, err := c.processURL(u, selector)
-				if err != nil {
-					log.Printf("ERROR: Failed to process %s: %v", u, err)
-					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
-					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: err.Error(), IsSuccess: false}
-					return
-				}
-
-				// Fetch the document again to get the title and metadata
-				resp, err := c.Client.Get(u)
-				if err != nil {
-					log.Printf("ERROR: Failed to fetch URL for metadata %s: %v", u, err)
-					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
-					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: fmt.Sprintf("failed to fetch URL for metadata: %v", err), IsSuccess: false}
-					return
-				}
-				defer resp.Body.Close()
-
-				// Limit response body for metadata parsing as well
-				resp.Body = http.MaxBytesReader(nil, resp.Body, maxBodySize)
-				doc, err := goquery.NewDocumentFromReader(resp.Body)
-				if err != nil {
-					log.Printf("ERROR: Failed to parse HTML for metadata %s: %v", u, err)
-					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
-					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: fmt.Sprintf("failed to parse HTML for metadata: %v", err), IsSuccess: false}
-					return
-				}
-
-				// Extract metadata
-				pageMetadata := c.getMetadata(doc, u)
-				pageMetadata["retrieved_at"] = time.Now().Format(time.RFC3339)
-
-				// Convert content to Markdown
-				markdownContent := c.htmlToMarkdown(content)
-
-				// Marshal metadata to YAML
-				yamlBytes, err := yaml.Marshal(pageMetadata)
-				if err != nil {
-					log.Printf("ERROR: Failed to marshal YAML for %s: %v", u, err)
-					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
-					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: fmt.Sprintf("failed to marshal YAML: %v", err), IsSuccess: false}
-					return
-				}
-
-				// Combine frontmatter and markdown content
-				var buf bytes.Buffer
-				buf.WriteString("---\n")
-				buf.Write(yamlBytes)
-				buf.WriteString("---\n\n")
-				buf.WriteString(markdownContent)
-				finalContent := buf.Bytes()
-				filename := c.getSanitizedTitle(doc, u) + ".md"
-
-				// Write the file to the configured output directory
-				filePath := filepath.Join(c.OutputDir, filename)
-				if err := os.WriteFile(filePath, finalContent, 0644); err != nil {
 					mu.Lock()
-					errorCount++
-					failedURLs = append(failedURLs, u)
+					if result.IsSuccess {
+						successCount++
+					} else if result.Skipped {
+						skippedCount++
+					} else {
+						errorCount++
+						if errors.Is(result.Err, ErrDNS) {
+							dnsCount++
+						}
+					}
+					slim := Result{URL: result.URL, FileName: result.FileName, Title: result.Title, Section: result.Section, Regions: result.Regions, Parts: result.Parts, MatchCount: result.MatchCount, Error: result.Error, IsSuccess: result.IsSuccess, Skipped: result.Skipped, Duration: result.Duration, Retrieved: result.Retrieved}
+					if c.CombineByHost {
+						slim.Content = result.Content // Needed to write the combined files
+					}
+					if keepResults {
+						results = append(results, slim)
+						positions = append(positions, i)
+					} else if !result.IsSuccess && !result.Skipped {
+						failed = append(failed, job)
+					}
+					completed++
+					if c.Progress != nil {
+						progressTotal := total
+						if progressTotal <= 0 {
+							progressTotal = received
+						}
+						c.Progress(completed, progressTotal, result)
+					}
 					mu.Unlock()
-					resultsChan <- Result{URL: u, Error: fmt.Sprintf("failed to write file: %v", err), IsSuccess: false}
-					return
+					resultsChan <- result
 				}
+			}()
+		}
 
-				mu.Lock()
-				successCount++
-				mu.Unlock()
-				resultsChan <- Result{
-					URL:       u,
-					FileName:  filename,
-					Content:   finalContent, // Keep for CLI compatibility for now
-					IsSuccess: true,
+		started := 0
+	dispatch:
+		for ctx.Err() == nil {
+			var u string
+			var ok bool
+			select {
+			case u, ok = <-urls:
+			case <-ctx.Done():
+			}
+			if !ok {
+				break
+			}
+			mu.Lock()
+			received++
+			mu.Unlock()
+			if c.pages != nil {
+				c.pages.expect(u)
+			}
+			if c.zim != nil {
+				order = append(order, u)
+			}
+			select {
+			case jobs <- job{position: started, url: u}:
+				started++
+			case <-ctx.Done():
+				if c.pages != nil {
+					c.pages.complete(started) // Never ran
 				}
-			}(u)
+				break dispatch
+			}
 		}
-
+		close(jobs)
 		wg.Wait()
+		unstarted := received - started // Taken from urls as the run was interrupted
+		for range urls {
+			unstarted++
+		}
+		if c.pages != nil {
+			if err := c.pages.close(); err != nil {
+				log.Printf("ERROR: Failed to finish the JSON output: %v", err)
+			}
+		}
 
-		close(resultsChan) // Close results channel before sending summary
-
+		// Run-level artifacts list the pages in input order, whatever order they completed in
+		sort.Sort(byInput{results, positions})
+		sort.Slice(failed, func(i, j int) bool { return failed[i].position < failed[j].position })
+		var failedURLs []string
+		for _, r := range results {
+			if !r.IsSuccess && !r.Skipped {
+				failedURLs = append(failedURLs, r.URL)
+			}
+		}
+		for _, j := range failed {
+			failedURLs = append(failedURLs, j.url)
+		}
 		summary := Summary{
-			TotalURLs:      len(urls),
+			TotalURLs:      started + unstarted,
 			Successful:     successCount,
 			Failed:         errorCount,
+			Skipped:        skippedCount,
+			DNSFailures:    dnsCount,
+			Interrupted:    unstarted+droppedCount > 0,
+			NotStarted:     unstarted + droppedCount,
 			FailedURLs:     failedURLs,
 			ProcessingTime: time.Since(startTime).String(),
 			DownloadID:     c.DownloadID,
 		}
+
+		if c.CombineByHost {
+			if err := c.writeCombined(results); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+			for i := range results {
+				results[i].Content = nil
+			}
+		}
+		if c.EmitIndex {
+			if err := c.writeIndex(results); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+		if c.EmitSitemap {
+			if err := c.writeSitemap(results); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+		if c.zim != nil {
+			if err := c.zim.close(order, time.Now()); err != nil {
+				log.Printf("ERROR: Failed to write the ZIM archive: %v", err)
+			}
+		}
+		if c.Manifest {
+			m := &Manifest{Selector: selector, SectionHeading: sectionPattern(c.SectionHeading), SelectorRules: c.SelectorRules, SelectorIndex: c.SelectorIndex, SelectorAttr: c.SelectorAttr, Regions: c.Regions, Format: c.Format, RichMarkdown: c.RichMarkdown, InputFormat: c.InputFormat, XMLElements: c.XMLElements, FetchOnly: c.FetchOnly, Combined: c.CombineByHost, Shard: c.Shard, Layout: c.Layout, SplitTokens: c.SplitTokens, Summary: summary, Results: results}
+			if err := c.writeManifest(m); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+
+		close(resultsChan) // Close results channel before sending summary
+
 		summaryChan <- summary
 		close(summaryChan)
 	}()
@@ -220,39 +625,744 @@ func (c *Converter) Convert(urls []string, selector string) (<-chan Result, <-ch
 	return resultsChan, summaryChan
 }
 
-// processURL fetches the HTML content at the given URL and extracts elements matching the provided selector.
-// On error or if no selection is found, returns a descriptive error including the URL and selector.
-func (c *Converter) processURL(urlStr string, selector string) (string, error) {
-	resp, err := c.Client.Get(urlStr)
+// job is a URL handed to a worker, with its position in the input.
+type job struct {
+	position int
+	url      string
+}
+
+// byInput sorts results by their positions in the input.
+type byInput struct {
+	results   []Result
+	positions []int
+}
+
+func (b byInput) Len() int           { return len(b.results) }
+func (b byInput) Less(i, j int) bool { return b.positions[i] < b.positions[j] }
+func (b byInput) Swap(i, j int) {
+	b.results[i], b.results[j] = b.results[j], b.results[i]
+	b.positions[i], b.positions[j] = b.positions[j], b.positions[i]
+}
+
+// convertURL runs the full pipeline for a single URL: validation, fetching,
+// extraction, rendering and writing the output file.
+func (c *Converter) convertURL(u string, selector string) Result {
+	if c.recorded != nil {
+		return c.convertPage(u, selector) // Read from the capture, not fetched
+	}
+
+	// URL Validation
+	isPublic, err := c.isPublicURL(u)
+	if err != nil {
+		return failure(u, newError(validationErrorKind(err), u, fmt.Errorf("URL validation failed: %w", err)))
+	}
+	if !isPublic {
+		return failure(u, newError(ErrBlocked, u, errors.New("SSRF attack suspected: URL resolves to a non-public IP")))
+	}
+	return c.convertPage(u, selector)
+}
+
+// convertPage fetches, converts and writes the page at u, which has passed the
+// URL validation.
+func (c *Converter) convertPage(u string, selector string) Result {
+	if c.FetchOnly {
+		body, doc, err := c.fetchRaw(u)
+		if err == nil {
+			err = c.skipSignal(doc, u)
+		}
+		if err != nil {
+			c.logFailure(u, err)
+			return failure(u, err)
+		}
+		return c.writeRawPage(doc, u, body)
+	}
+
+	// The page is fetched and parsed once; the content and metadata both come
+	// from the same document, which is released as soon as this returns.
+	var doc *goquery.Document
+	var err error
+	if c.InputFormat == InputXML {
+		// The document holds only what the XML path selected
+		doc, err = c.fetchXMLDocument(u, selector)
+		selector = ""
+	} else {
+		doc, err = c.fetchDocumentSince(u, c.ModifiedSince)
+	}
+	if err == nil {
+		err = c.skipSignal(doc, u)
+	}
+	matches := 0
+	if err == nil {
+		selector = c.pageSelector(doc, selector)
+		if c.FollowIframes {
+			c.inlineIframes(doc, u, selector)
+		}
+		if len(c.Regions) > 0 {
+			return c.convertRegions(doc, u)
+		}
+		matches = matchCount(doc, selector)
+		var content string
+		content, err = c.extractContent(doc, u, selector)
+		if err == nil {
+			result := c.writePage(doc, u, content)
+			result.MatchCount = matches
+			return result
+		}
+	}
+	c.logFailure(u, err)
+	result := failure(u, err)
+	result.MatchCount = matches
+	return result
+}
+
+// matchCount returns the number of elements selector matches in doc, counting
+// the whole page as one.
+func matchCount(doc *goquery.Document, selector string) int {
+	if IsWholePageSelector(selector) {
+		return 1
+	}
+	return doc.Find(selector).Length()
+}
+
+// writePage renders the extracted content with the page metadata and writes it
+// to the configured output directory.
+func (c *Converter) writePage(doc *goquery.Document, u string, content string) Result {
+	return c.writeContent(doc, u, content, nil)
+}
+
+// writeContent writes content as writePage does; the content of a region goes
+// into a file of its own, named after the page and the region.
+func (c *Converter) writeContent(doc *goquery.Document, u string, content string, region *Region) Result {
+	// Extract metadata
+	pageMetadata := c.getMetadata(doc, u)
+	retrieved := time.Now()
+	pageMetadata["retrieved_at"] = c.timestamp(retrieved)
+	date := pageDate(doc, retrieved)
+	c.addLayoutMetadata(pageMetadata, date)
+	if region != nil {
+		pageMetadata["region"] = region.Name
+	}
+	if c.Breadcrumbs {
+		if trail := c.breadcrumbs(doc); len(trail) > 0 {
+			pageMetadata["breadcrumbs"] = trail
+		}
+	}
+
+	// Convert content to the configured output format; attribute values are
+	// written as they are
+	renderedContent := content
+	if c.SelectorAttr == "" {
+		renderedContent = c.renderAt(content, c.linkBase(doc, u))
+	}
+	renderedContent, err := c.slice(renderedContent, u)
+	if err == nil {
+		err = c.validateMarkdown(u, renderedContent)
+	}
+	if err != nil {
+		c.logf(u, "ERROR: Failed to process %s: %v", u, err)
+		return failure(u, err)
+	}
+
+	c.addContentHash(pageMetadata, renderedContent)
+
+	// Render metadata as the format's frontmatter
+	header, err := c.frontmatter(pageMetadata)
+	if err != nil {
+		c.logf(u, "ERROR: Failed to render frontmatter for %s: %v", u, err)
+		return failure(u, newError(ErrRender, u, fmt.Errorf("failed to render frontmatter: %w", err)))
+	}
+
+	title, _ := pageMetadata["title"].(string)
+	if c.CombineByHost {
+		// Written with the rest of the host's pages once the run completes
+		section := title
+		if section == "" {
+			section = u
+		}
+		if err := c.recordPage(u, pageMetadata, renderedContent); err != nil {
+			c.logf(u, "ERROR: %v", err)
+			return failure(u, err)
+		}
+		c.checkChanges(u, renderedContent)
+		return Result{
+			URL:       u,
+			FileName:  c.hostFileName(u),
+			Title:     title,
+			Section:   section,
+			Content:   []byte(renderedContent),
+			IsSuccess: true,
+			Retrieved: retrieved,
+		}
+	}
+
+	// Combine frontmatter and rendered content
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteString(renderedContent)
+	finalContent := buf.Bytes()
+	filename := c.names.claim(u, c.outputFileName(doc, u), func(name string) string {
+		return c.layoutFileName(name, date)
+	})
+	changeKey := u
+	if region != nil {
+		filename = regionFileName(filename, region.Name)
+		changeKey = u + "#" + region.Name
+	}
+
+	// Write the file to the configured output directory, split into parts when
+	// it is longer than SplitTokens
+	pageName := filename // The ZIM archive holds the page whole, under its unsplit name
+	var parts []string
+	if c.SplitTokens > 0 {
+		parts = splitTokens(renderedContent, c.SplitTokens)
+	}
+	if len(parts) > 1 {
+		names, err := c.writeParts(u, filename, pageMetadata, parts)
+		if err != nil {
+			c.logf(u, "ERROR: Failed to process %s: %v", u, err)
+			return failure(u, err)
+		}
+		filename = names[0]
+		parts = names
+	} else {
+		parts = nil
+		filePath := filepath.Join(c.OutputDir, filename)
+		if err := c.writeFile(filePath, finalContent); err != nil {
+			return failure(u, newError(ErrWrite, u, fmt.Errorf("failed to write file: %w", err)))
+		}
+	}
+	if err := c.recordPage(u, pageMetadata, renderedContent); err != nil {
+		c.logf(u, "ERROR: %v", err)
+		return failure(u, err)
+	}
+	if err := c.recordZIMPage(u, pageName, title, content); err != nil {
+		c.logf(u, "ERROR: %v", err)
+		return failure(u, err)
+	}
+
+	c.checkChanges(changeKey, renderedContent)
+
+	return Result{
+		URL:       u,
+		FileName:  filename,
+		Title:     title,
+		Parts:     parts,
+		Content:   finalContent, // Keep for CLI compatibility for now
+		IsSuccess: true,
+		Retrieved: retrieved,
+	}
+}
+
+// checkChanges reports a change event for u when its rendered body changed
+// since the previous conversion and change monitoring is enabled.
+func (c *Converter) checkChanges(u string, renderedContent string) {
+	if c.Changes == nil {
+		return
+	}
+	event, err := c.Changes.Check(u, renderedContent)
+	if err != nil {
+		c.logf(u, "ERROR: Failed to check %s for content changes: %v", u, err)
+	} else if event != nil {
+		c.Changes.Notify(event)
+	}
+}
+
+// timestamp formats t for the metadata with TimestampFormat and UTC.
+func (c *Converter) timestamp(t time.Time) string {
+	if c.UTC {
+		t = t.UTC()
+	}
+	layout := c.TimestampFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return t.Format(layout)
+}
+
+// writeRawPage writes the page body exactly as fetched, with its metadata in a
+// YAML sidecar next to it. Both files share the page's output name.
+func (c *Converter) writeRawPage(doc *goquery.Document, u string, body []byte) Result {
+	pageMetadata := c.getMetadata(doc, u)
+	retrieved := time.Now()
+	pageMetadata["retrieved_at"] = c.timestamp(retrieved)
+	c.addContentHash(pageMetadata, string(body))
+
+	sidecar, err := marshalYAML(pageMetadata)
+	if err != nil {
+		c.logf(u, "ERROR: Failed to render metadata for %s: %v", u, err)
+		return failure(u, newError(ErrRender, u, fmt.Errorf("failed to render metadata: %w", err)))
+	}
+
+	filename := c.names.claim(u, c.outputFileName(doc, u), nil)
+	filePath := filepath.Join(c.OutputDir, filename)
+	if err := c.writeFile(filePath, body); err != nil {
+		return failure(u, newError(ErrWrite, u, fmt.Errorf("failed to write file: %w", err)))
+	}
+	sidecarPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".yaml"
+	if err := c.writeFile(sidecarPath, sidecar); err != nil {
+		return failure(u, newError(ErrWrite, u, fmt.Errorf("failed to write metadata file: %w", err)))
+	}
+	if err := c.recordPage(u, pageMetadata, string(body)); err != nil {
+		c.logf(u, "ERROR: %v", err)
+		return failure(u, err)
+	}
+
+	title, _ := pageMetadata["title"].(string)
+	return Result{
+		URL:       u,
+		FileName:  filename,
+		Title:     title,
+		Content:   body,
+		IsSuccess: true,
+		Retrieved: retrieved,
+	}
+}
+
+// fetch requests urlStr and returns the response of a successful request with
+// its body limited to MaxBodySize. The caller must close the body. With a
+// non-zero since, a page unchanged since then fails with ErrNotModified.
+// The page's host becomes one that credentials are sent to.
+func (c *Converter) fetch(urlStr string, since time.Time) (*http.Response, error) {
+	c.credentials.addPage(urlStr)
+	if c.Preflight {
+		if err := c.preflight(urlStr, since); err != nil {
+			return nil, err
+		}
+	}
+	return c.getSince(urlStr, since)
+}
+
+// get sends a GET request for urlStr and returns the response of a successful
+// request with its body limited to MaxBodySize. The caller must close the body.
+func (c *Converter) get(urlStr string) (*http.Response, error) {
+	return c.getSince(urlStr, time.Time{})
+}
+
+// getSince is get with an If-Modified-Since header when since is not zero.
+func (c *Converter) getSince(urlStr string, since time.Time) (*http.Response, error) {
+	req, err := c.newRequest(http.MethodGet, urlStr, since)
+	if err != nil {
+		return nil, newError(ErrInvalidURL, urlStr, fmt.Errorf("failed to fetch URL %s: %w", urlStr, err))
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, newError(fetchErrorKind(err), urlStr, fmt.Errorf("failed to fetch URL %s: %w", urlStr, err))
+	}
+
+	if resp.StatusCode == http.StatusNotModified && !since.IsZero() {
+		resp.Body.Close()
+		return nil, notModified(urlStr, since)
+	}
+	if !c.acceptsStatus(resp.StatusCode) {
+		resp.Body.Close()
+		e := newError(ErrFetch, urlStr, fmt.Errorf("failed to fetch URL %s: HTTP status %d", urlStr, resp.StatusCode))
+		e.StatusCode = resp.StatusCode
+		return nil, e
+	}
+
+	// Limit response body to the configured size. The limit applies to the bytes
+	// read, as chunked responses have no Content-Length; a declared length over
+	// the limit is refused before reading anything.
+	limit := c.bodyLimit(resp.Header.Get("Content-Type"))
+	if resp.ContentLength > limit {
+		resp.Body.Close()
+		return nil, newError(ErrTooLarge, urlStr, fmt.Errorf("failed to fetch URL %s: Content-Length %d exceeds the %d byte limit", urlStr, resp.ContentLength, limit))
+	}
+	resp.Body = http.MaxBytesReader(nil, resp.Body, limit)
+	return resp, nil
+}
+
+// acceptsStatus reports whether a response with the given status code is
+// converted: a 200, or one of AcceptStatus.
+func (c *Converter) acceptsStatus(code int) bool {
+	return code == http.StatusOK || slices.Contains(c.AcceptStatus, code)
+}
+
+// newRequest returns a request for urlStr, conditional on the resource having
+// changed since the given time when it is not zero.
+func (c *Converter) newRequest(method, urlStr string, since time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !since.IsZero() {
+		req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+	}
+	if c.userAgents != nil {
+		req.Header.Set("User-Agent", c.userAgents.pick())
+	}
+	return req, nil
+}
+
+// notModified returns the ErrNotModified error for urlStr.
+func notModified(urlStr string, since time.Time) *Error {
+	e := newError(ErrNotModified, urlStr, fmt.Errorf("%s not modified since %s", urlStr, since.UTC().Format(http.TimeFormat)))
+	e.StatusCode = http.StatusNotModified
+	return e
+}
+
+// FetchURLList fetches a remote list of URLs with the same guards as page
+// fetches: the URL must resolve to a public address, the request times out,
+// and the body may be at most maxSize bytes (DefaultMaxBodySize when zero).
+func FetchURLList(u string, maxSize int64) ([]byte, error) {
+	c := &Converter{Client: &http.Client{Timeout: httpTimeout}, MaxBodySize: maxSize}
+	isPublic, err := c.isPublicURL(u)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch URL %s: %v", urlStr, err)
+		return nil, newError(validationErrorKind(err), u, fmt.Errorf("URL validation failed: %w", err))
+	}
+	if !isPublic {
+		return nil, newError(ErrBlocked, u, errors.New("SSRF attack suspected: URL resolves to a non-public IP"))
+	}
+
+	resp, err := c.get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newError(fetchErrorKind(err), u, fmt.Errorf("failed to read body of %s: %w", u, err))
+	}
+	return data, nil
+}
+
+// preflight checks with a HEAD request that urlStr is an HTML page worth fetching.
+func (c *Converter) preflight(urlStr string, since time.Time) error {
+	req, err := c.newRequest(http.MethodHead, urlStr, since)
+	if err != nil {
+		return newError(ErrInvalidURL, urlStr, fmt.Errorf("preflight request for %s failed: %w", urlStr, err))
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return newError(fetchErrorKind(err), urlStr, fmt.Errorf("preflight request for %s failed: %w", urlStr, err))
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && !since.IsZero():
+		return notModified(urlStr, since)
+	case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		return nil // HEAD unsupported; let the GET decide
+	case !c.acceptsStatus(resp.StatusCode):
+		e := newError(ErrFetch, urlStr, fmt.Errorf("failed to fetch URL %s: HTTP status %d", urlStr, resp.StatusCode))
+		e.StatusCode = resp.StatusCode
+		return e
+	case c.InputFormat == InputXML && !isXMLContentType(resp.Header.Get("Content-Type")):
+		return newError(ErrNotHTML, urlStr, fmt.Errorf("skipped %s: content type %s is not XML", urlStr, resp.Header.Get("Content-Type")))
+	case c.InputFormat != InputXML && !isHTMLContentType(resp.Header.Get("Content-Type")):
+		return newError(ErrNotHTML, urlStr, fmt.Errorf("skipped %s: content type %s is not HTML", urlStr, resp.Header.Get("Content-Type")))
+	}
+	return nil
+}
+
+// isHTMLContentType reports whether a Content-Type header value may be HTML. A
+// missing or malformed header is given the benefit of the doubt.
+func isHTMLContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// fetchRaw fetches the page at urlStr and returns its body as received, along
+// with the parsed document for metadata and naming.
+func (c *Converter) fetchRaw(urlStr string) ([]byte, *goquery.Document, error) {
+	if c.Render == RenderJS {
+		return c.fetchRendered(urlStr)
+	}
+
+	resp, err := c.fetch(urlStr, c.ModifiedSince)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch URL %s: HTTP status %d", urlStr, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, newError(fetchErrorKind(err), urlStr, fmt.Errorf("failed to read body of %s: %w", urlStr, err))
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, newError(ErrFetch, urlStr, fmt.Errorf("failed to read HTML for %s: %w", urlStr, err))
+	}
+	return body, doc, nil
+}
+
+// fetchDocument fetches the HTML page at urlStr and parses it. The body is parsed
+// while it streams in and reading stops with an error once it exceeds MaxBodySize,
+// so no more than that is ever buffered for a single page.
+func (c *Converter) fetchDocument(urlStr string) (*goquery.Document, error) {
+	return c.fetchDocumentSince(urlStr, time.Time{})
+}
+
+// fetchDocumentSince is fetchDocument for a page that is only wanted if it
+// changed since the given time, when that is not zero.
+func (c *Converter) fetchDocumentSince(urlStr string, since time.Time) (*goquery.Document, error) {
+	if c.Render == RenderJS {
+		_, doc, err := c.fetchRendered(urlStr)
+		return doc, err
 	}
 
-	// Limit response body to 5MB
-	resp.Body = http.MaxBytesReader(nil, resp.Body, maxBodySize)
+	resp, err := c.fetch(urlStr, since)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read HTML for %s: %v", urlStr, err)
+		return nil, newError(fetchErrorKind(err), urlStr, fmt.Errorf("failed to read HTML for %s: %w", urlStr, err))
+	}
+	return doc, nil
+}
+
+// pageChromeSelector matches the parts of a page dropped when the whole body is
+// converted: code and navigation rather than content.
+const pageChromeSelector = "script, style, noscript, template, nav, [role='navigation']"
+
+// IsWholePageSelector reports whether selector asks for the whole page rather
+// than a part of it: an empty selector, "body" or "*".
+func IsWholePageSelector(selector string) bool {
+	switch strings.TrimSpace(selector) {
+	case "", "body", "*":
+		return true
+	}
+	return false
+}
+
+// ValidateSelector reports whether selector is a valid CSS selector. goquery
+// treats an invalid selector as one that matches nothing, so a typo would
+// otherwise surface as ErrSelectorNoMatch on every page.
+func ValidateSelector(selector string) error {
+	if _, err := cascadia.Compile(selector); err != nil {
+		return fmt.Errorf("invalid CSS selector '%s': %w", selector, err)
+	}
+	return nil
+}
+
+// extractContent returns the HTML of the first element in doc matching the provided
+// selector, or of the SelectorIndex-th match when it is set. A whole-page selector
+// returns the body without scripts, styles and navigation. With SelectorAttr, the
+// matches' attribute values are returned instead.
+// If no selection is found, returns a descriptive error including the URL and selector.
+func (c *Converter) extractContent(doc *goquery.Document, urlStr string, selector string) (string, error) {
+	if IsWholePageSelector(selector) {
+		body := doc.Find("body").First()
+		if body.Length() == 0 {
+			body = doc.Selection
+		}
+		// Strip a copy: the document is still needed for metadata
+		body = body.Clone()
+		body.Find(pageChromeSelector).Remove()
+		c.warnIfShadowed(doc, body, urlStr, "body")
+		if c.SelectorAttr != "" {
+			return c.attrValues(body, urlStr, "body")
+		}
+		if c.SectionHeading != nil {
+			return c.headingSection(body, urlStr)
+		}
+		htmlContent, err := body.Html()
+		if err != nil {
+			return "", newError(ErrRender, urlStr, fmt.Errorf("failed to get HTML content of the page body: %w", err))
+		}
+		return htmlContent, nil
 	}
 
 	content := doc.Find(selector)
 	if content.Length() == 0 {
-		return "", fmt.Errorf("could not find content in %s using selector '%s'", urlStr, selector)
+		msg := fmt.Sprintf("could not find content in %s using selector '%s'", urlStr, selector)
+		if hint := c.shadowDOMHint(doc); hint != "" {
+			msg += "; " + hint
+		}
+		return "", newError(ErrSelectorNoMatch, urlStr, errors.New(msg))
+	}
+
+	if c.SelectorIndex != 0 {
+		// 1-based from the start, or counting back from the end when negative
+		i := c.SelectorIndex - 1
+		if c.SelectorIndex < 0 {
+			i = content.Length() + c.SelectorIndex
+		}
+		if i < 0 || i >= content.Length() {
+			return "", newError(ErrSelectorNoMatch, urlStr, fmt.Errorf("selector '%s' matched %d elements in %s; index %d is out of range",
+				selector, content.Length(), urlStr, c.SelectorIndex))
+		}
+		content = content.Eq(i)
+	}
+	if c.SelectorAttr != "" {
+		return c.attrValues(content, urlStr, selector)
+	}
+	c.warnIfShadowed(doc, content, urlStr, selector)
+	if c.SectionHeading != nil {
+		return c.headingSection(content, urlStr)
 	}
 
 	htmlContent, err := content.Html()
 	if err != nil {
-		return "", fmt.Errorf("failed to get HTML content for selector '%s': %v", selector, err)
+		return "", newError(ErrRender, urlStr, fmt.Errorf("failed to get HTML content for selector '%s': %w", selector, err))
 	}
 	return htmlContent, nil
 }
 
+// attrValues returns the SelectorAttr value of each element in content, one
+// per line.
+func (c *Converter) attrValues(content *goquery.Selection, urlStr string, selector string) (string, error) {
+	values := make([]string, 0, content.Length())
+	for i := range content.Length() {
+		value, ok := content.Eq(i).Attr(c.SelectorAttr)
+		if !ok {
+			return "", newError(ErrSelectorNoMatch, urlStr, fmt.Errorf("element %d matched by '%s' in %s has no attribute '%s'",
+				i+1, selector, urlStr, c.SelectorAttr))
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, "\n"), nil
+}
+
+// headingSection returns the HTML of the section in content introduced by the
+// first heading whose text matches SectionHeading: the heading and its
+// following siblings, up to the next heading of the same or a higher level.
+// A sibling holding such a heading, like a wrapper of the next section, ends
+// the section too.
+func (c *Converter) headingSection(content *goquery.Selection, urlStr string) (string, error) {
+	heading := content.Find(headingSelector).FilterFunction(func(_ int, h *goquery.Selection) bool {
+		return c.SectionHeading.MatchString(collapseWhitespace(h.Text()))
+	}).First()
+	if heading.Length() == 0 {
+		return "", newError(ErrSelectorNoMatch, urlStr, fmt.Errorf("no heading matching /%s/ in %s", c.SectionHeading, urlStr))
+	}
+	level := headingLevel(heading)
+
+	var b strings.Builder
+	for n := heading.Get(0); n != nil; n = n.NextSibling {
+		node := goquery.NewDocumentFromNode(n).Selection
+		if n != heading.Get(0) && n.Type == html.ElementNode && endsSection(node, level) {
+			break
+		}
+		fragment, err := goquery.OuterHtml(node)
+		if err != nil {
+			return "", newError(ErrRender, urlStr, fmt.Errorf("failed to get HTML content of the section in %s: %w", urlStr, err))
+		}
+		b.WriteString(fragment)
+	}
+	return b.String(), nil
+}
+
+// headingSelector matches every heading level.
+const headingSelector = "h1, h2, h3, h4, h5, h6"
+
+// headingLevel returns the level of the heading element h, 1 to 6.
+func headingLevel(h *goquery.Selection) int {
+	return int(goquery.NodeName(h)[1] - '0')
+}
+
+// endsSection reports whether node is, or holds, a heading of level or higher.
+func endsSection(node *goquery.Selection, level int) bool {
+	ends := false
+	node.Find(headingSelector).AddSelection(node.Filter(headingSelector)).EachWithBreak(func(_ int, h *goquery.Selection) bool {
+		ends = headingLevel(h) <= level
+		return !ends
+	})
+	return ends
+}
+
+// concurrency returns the number of pages processed in parallel.
+func (c *Converter) concurrency() int {
+	if c.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+	return c.Concurrency
+}
+
+// maxBodySize returns the largest response body accepted for a single page.
+func (c *Converter) maxBodySize() int64 {
+	if c.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+	return c.MaxBodySize
+}
+
+// bodyLimit returns the size limit of a response body with the given
+// Content-Type header.
+func (c *Converter) bodyLimit(contentType string) int64 {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && len(c.MaxBodySizes) > 0 {
+		if limit, ok := c.MaxBodySizes[mediaType]; ok {
+			return limit
+		}
+		major, _, _ := strings.Cut(mediaType, "/")
+		if limit, ok := c.MaxBodySizes[major+"/*"]; ok {
+			return limit
+		}
+	}
+	return c.maxBodySize()
+}
+
+// writeFile writes data to path with FileMode. The mode is set explicitly, since
+// the umask would otherwise strip group write permissions.
+func (c *Converter) writeFile(path string, data []byte) error {
+	mode := c.FileMode
+	if mode == 0 {
+		mode = DefaultFileMode
+	}
+	if err := c.makeParentDir(path); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, mode)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so that readers of path, and a run that is killed mid-write,
+// never see a partial file. The temporary file is removed when any step fails.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(mode); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// MemoryCeiling returns the most page-body bytes that can be in flight at once
+// in a run of the given number of pages: (Concurrency + ResultsBuffer) × the
+// largest body limit, plus the byte read past it to tell an oversized body.
+// With CombineByHost, the content of every page is kept until the run
+// completes, so each of the pages counts as one more at the limit. Parsed
+// documents take a small multiple of that, so operators can size a machine
+// from this figure.
+func (c *Converter) MemoryCeiling(pages int) int64 {
+	largest := c.maxBodySize()
+	for _, limit := range c.MaxBodySizes {
+		largest = max(largest, limit)
+	}
+	slots := int64(c.concurrency() + max(c.ResultsBuffer, 0))
+	if c.CombineByHost {
+		slots += int64(max(pages, 0))
+	}
+	if largest >= math.MaxInt64/slots {
+		return math.MaxInt64
+	}
+	return slots * (largest + 1)
+}
+
 // isPublicURL checks if a URL resolves to a public IP address to prevent SSRF attacks.
 // func (c *Converter) isPublicURL(urlStr string) (bool, error) {
 // 	parsedURL, err := url.Parse(urlStr)
@@ -274,24 +1384,87 @@ func (c *Converter) processURL(urlStr string, selector string) (string, error) {
 // 	return true, nil
 // }
 
+// outputFileName returns the path of the page at u relative to OutputDir: its
+// file name, in its shard directory when output is sharded.
+func (c *Converter) outputFileName(doc *goquery.Document, u string) string {
+	return filepath.Join(c.shardDir(u), c.baseFileName(doc, u))
+}
+
+// baseFileName returns the file name for the page at u. An explicit name from
+// FileNames is preferred over the title-derived one; both are sanitized, and the
+// extension always matches the output format (.html in FetchOnly mode).
+func (c *Converter) baseFileName(doc *goquery.Document, u string) string {
+	ext := c.renderer().extension()
+	if c.FetchOnly {
+		ext = ".html"
+	}
+	if name, ok := c.FileNames[u]; ok {
+		if stem := SanitizeFilename(strings.TrimSuffix(name, filepath.Ext(name))); stem != "" {
+			return stem + ext
+		}
+	}
+	return c.getSanitizedTitle(doc, u) + ext
+}
+
 // getSanitizedTitle extracts the title from the document or uses the fallback URL
 // to create a valid filename
 func (c *Converter) getSanitizedTitle(doc *goquery.Document, fallbackURL string) string {
-	title := strings.TrimSpace(doc.Find("title").Text())
+	title := c.pageTitle(doc)
 	if title == "" {
-		// Use the last part of the URL as fallback
-		parts := strings.Split(fallbackURL, "/")
-		if len(parts) > 0 {
-			title = parts[len(parts)-1]
-			if title == "" && len(parts) > 1 {
-				title = parts[len(parts)-2]
-			}
+		title = c.urlFileStem(fallbackURL)
+	}
+	return SanitizeFilename(title)
+}
+
+// pageTitle returns the title of the page: the text of the element matched by
+// TitleSelector when there is one, otherwise the <title> with TitleStrip removed.
+func (c *Converter) pageTitle(doc *goquery.Document) string {
+	if c.TitleSelector != "" {
+		if title := collapseWhitespace(doc.Find(c.TitleSelector).First().Text()); title != "" {
+			return title
 		}
-		if title == "" {
-			title = "untitled"
+	}
+	title := strings.TrimSpace(doc.Find("title").Text())
+	if c.TitleStrip != nil {
+		title = strings.TrimSpace(c.TitleStrip.ReplaceAllString(title, ""))
+	}
+	return title
+}
+
+// urlFileStem names a page after the last segment of its URL path (or its host,
+// for the root page), followed by the query parameters selected by DropQuery
+// and QueryParams in the order they appear.
+func (c *Converter) urlFileStem(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "untitled"
+	}
+	var stem string
+	if segments := strings.FieldsFunc(parsed.Path, func(r rune) bool { return r == '/' }); len(segments) > 0 {
+		stem = segments[len(segments)-1]
+	} else {
+		stem = parsed.Host
+	}
+
+	if !c.DropQuery && parsed.RawQuery != "" {
+		for _, param := range strings.Split(parsed.RawQuery, "&") {
+			key, value, _ := strings.Cut(param, "=")
+			key, _ = url.QueryUnescape(key)
+			value, _ = url.QueryUnescape(value)
+			if key == "" || (len(c.QueryParams) > 0 && !slices.Contains(c.QueryParams, key)) {
+				continue
+			}
+			stem += "_" + key
+			if value != "" {
+				stem += "_" + value
+			}
 		}
 	}
-	return SanitizeFilename(title)
+
+	if SanitizeFilename(stem) == "" {
+		return "untitled"
+	}
+	return stem
 }
 
 // getMetadata extracts relevant metadata from the goquery document.
@@ -302,8 +1475,7 @@ func (c *Converter) getMetadata(doc *goquery.Document, url string) map[string]in
 	metadata["source"] = url
 
 	// Title
-	title := strings.TrimSpace(doc.Find("title").Text())
-	if title != "" {
+	if title := c.pageTitle(doc); title != "" {
 		metadata["title"] = title
 	}
 
@@ -321,76 +1493,19 @@ func (c *Converter) getMetadata(doc *goquery.Document, url string) map[string]in
 		}
 	})
 
+	c.addExtraMetadata(metadata)
 	return metadata
 }
 
-// htmlToMarkdown converts a given HTML string to Markdown.
-// This is a simplified conversion and might need a more robust library for complex HTML.
-func (c *Converter) htmlToMarkdown(htmlContent string) string {
-	// This is a simplified conversion. For robust conversion, a dedicated library like
-	// "github.com/JohannesKaufmann/html-to-markdown" would be used.
-	// For the purpose of this task, we'll implement basic conversions.
-
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
-	if err != nil {
-		log.Printf("ERROR: Failed to parse HTML for markdown conversion: %v", err)
-		return ""
-	}
-
-	var markdownBuilder strings.Builder
-
-	// Create a selection from the document
-	var selection *goquery.Selection
-	body := doc.Find("body")
-	if body.Length() > 0 {
-		selection = body
-	} else {
-		selection = doc.Selection
-	}
-
-	// Find all relevant elements and process them
-	selection.Find("h1, h2, h3, h4, h5, h6, p, a").Each(func(i int, s *goquery.Selection) {
-		tagName := goquery.NodeName(s)
-		text := strings.TrimSpace(s.Text())
-
-		if text == "" {
-			return
-		}
-
-		switch tagName {
-		case "h1":
-			markdownBuilder.WriteString("# " + text + "\n\n")
-		case "h2":
-			markdownBuilder.WriteString("## " + text + "\n\n")
-		case "h3":
-			markdownBuilder.WriteString("### " + text + "\n\n")
-		case "h4":
-			markdownBuilder.WriteString("#### " + text + "\n\n")
-		case "h5":
-			markdownBuilder.WriteString("##### " + text + "\n\n")
-		case "h6":
-			markdownBuilder.WriteString("###### " + text + "\n\n")
-		case "p":
-			markdownBuilder.WriteString(text + "\n\n")
-		case "a":
-			href, exists := s.Attr("href")
-			if exists {
-				markdownBuilder.WriteString(fmt.Sprintf("[%s](%s)", text, href))
-			} else {
-				markdownBuilder.WriteString(text)
-			}
+// addExtraMetadata adds the ExtraMetadata fields to metadata.
+func (c *Converter) addExtraMetadata(metadata map[string]interface{}) {
+	for key, value := range c.ExtraMetadata {
+		if _, extracted := metadata[key]; extracted && !c.ExtraMetadataWins {
+			continue
 		}
-	})
-
-	// If no specific tags found, just use the text content
-	if markdownBuilder.Len() == 0 {
-		text := strings.TrimSpace(selection.Text())
-		if text != "" {
-			markdownBuilder.WriteString(text)
+		if list, ok := value.([]string); ok {
+			value = append([]string(nil), list...) // Pages are rendered concurrently, each in place
 		}
+		metadata[key] = value
 	}
-
-	// Clean up multiple newlines and trim overall whitespace
-	result := regexp.MustCompile(`\n\n+`).ReplaceAllString(markdownBuilder.String(), "\n\n")
-	return strings.TrimSpace(result)
 }
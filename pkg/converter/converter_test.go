@@ -0,0 +1,1862 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+// loadFixture parses an HTML file from testdata.
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	return doc
+}
+
+func TestEntitiesAndEmoji_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name          string
+		style         string
+		expectedTitle string
+		expectedBody  string
+	}{
+		{
+			name:          "keep",
+			style:         EmojiKeep,
+			expectedTitle: "Tom & Jerry 😀",
+			expectedBody:  "# Fish & Chips 😀\n\nSmile 😀 and ship it 🚀 © 2025",
+		},
+		{
+			name:          "shortcode",
+			style:         EmojiShortcode,
+			expectedTitle: "Tom & Jerry :grinning:",
+			expectedBody:  "# Fish & Chips :grinning:\n\nSmile :grinning: and ship it :rocket: © 2025",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Converter{EmojiStyle: tc.style}
+			doc := loadFixture(t, "entities.html")
+
+			content, err := doc.Find("main").Html()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedBody, c.render(content))
+
+			frontmatter, err := c.frontmatter(c.getMetadata(doc, "https://example.com/entities"))
+			require.NoError(t, err)
+			assert.NotContains(t, string(frontmatter), `\U`, "emoji should not be escaped in frontmatter")
+
+			var metadata map[string]interface{}
+			require.NoError(t, yaml.Unmarshal(frontmatter, &metadata))
+			assert.Equal(t, tc.expectedTitle, metadata["title"])
+		})
+	}
+}
+
+func TestUnescapeYAMLRunes_KeepsEscapedBackslash(t *testing.T) {
+	input := []byte(`title: "a \\U0001F600 b \U0001F600"` + "\n")
+	assert.Equal(t, `title: "a \\U0001F600 b 😀"`+"\n", string(unescapeYAMLRunes(input)))
+}
+
+func TestRender_ClassicMarkdown(t *testing.T) {
+	content := `<h1>Getting Started</h1>
+<p>Read the <a href="https://example.com/guide">install guide</a> first.</p>
+<pre><code>fmt.Println("hi")</code></pre>`
+
+	// A link follows its paragraph, and code blocks are left out, as they always have been
+	expected := "# Getting Started\n\n" +
+		"Read the install guide first.\n\n" +
+		"[install guide](https://example.com/guide)"
+	assert.Equal(t, expected, (&Converter{}).render(content))
+
+	expected = "# Getting Started\n\n" +
+		"Read the [install guide](https://example.com/guide) first.\n\n" +
+		"```\nfmt.Println(\"hi\")\n```"
+	assert.Equal(t, expected, (&Converter{RichMarkdown: true}).render(content))
+}
+
+func TestRender_AsciiDoc(t *testing.T) {
+	c := &Converter{Format: FormatAsciiDoc}
+	content := `<h1>Getting Started</h1>
+<p>Read the <a href="https://example.com/guide">install guide</a> first.</p>
+<h3>Example</h3>
+<pre><code class="language-go">fmt.Println("hi")</code></pre>`
+
+	expected := "== Getting Started\n\n" +
+		"Read the link:https://example.com/guide[install guide] first.\n\n" +
+		"==== Example\n\n" +
+		"[source,go]\n----\nfmt.Println(\"hi\")\n----"
+	assert.Equal(t, expected, c.render(content))
+
+	header, err := c.frontmatter(map[string]interface{}{"title": "Guide", "source": "https://example.com/guide"})
+	require.NoError(t, err)
+	assert.Equal(t, "= Guide\n:source: https://example.com/guide\n\n", string(header))
+	assert.Equal(t, ".adoc", c.renderer().extension())
+}
+
+func TestRender_RST(t *testing.T) {
+	c := &Converter{Format: FormatRST}
+	content := `<h1>Getting Started</h1>
+<p>Read the <a href="https://example.com/guide">install guide</a> first.</p>
+<h2>Setup</h2>
+<h3>Example</h3>
+<pre><code class="language-python">def main():
+    pass</code></pre>`
+
+	expected := "Getting Started\n===============\n\n" +
+		"Read the `install guide <https://example.com/guide>`__ first.\n\n" +
+		"Setup\n-----\n\n" +
+		"Example\n~~~~~~~\n\n" +
+		".. code-block:: python\n\n   def main():\n       pass"
+	assert.Equal(t, expected, c.render(content))
+
+	header, err := c.frontmatter(map[string]interface{}{"title": "Guide", "source": "https://example.com/guide"})
+	require.NoError(t, err)
+	assert.Equal(t, ":source: https://example.com/guide\n\n=====\nGuide\n=====\n\n", string(header))
+}
+
+func TestExtractContent_SelectorIndex(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(
+		`<div class="panel">first</div><div class="panel">second</div><div class="panel">third</div>`)))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		index    int
+		expected string
+		wantErr  bool
+	}{
+		{"unset uses the first match", 0, "first", false},
+		{"first", 1, "first", false},
+		{"second", 2, "second", false},
+		{"last", -1, "third", false},
+		{"second from end", -2, "second", false},
+		{"past the end", 4, "", true},
+		{"before the start", -4, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Converter{SelectorIndex: tc.index}
+			content, err := c.extractContent(doc, "https://example.com", ".panel")
+			if tc.wantErr {
+				assert.ErrorContains(t, err, "out of range")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, content)
+		})
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	doc := loadFixture(t, "breadcrumbs.html")
+	expected := []string{"Home", "Docs", "Guide", "Intro"}
+
+	t.Run("nav selector", func(t *testing.T) {
+		c := &Converter{Breadcrumbs: true, BreadcrumbSelector: "nav.breadcrumb li"}
+		assert.Equal(t, expected, c.breadcrumbs(doc))
+	})
+
+	t.Run("json-ld", func(t *testing.T) {
+		c := &Converter{Breadcrumbs: true}
+		assert.Equal(t, expected, c.breadcrumbs(doc))
+	})
+
+	t.Run("selector without matches falls back to json-ld", func(t *testing.T) {
+		c := &Converter{Breadcrumbs: true, BreadcrumbSelector: ".missing"}
+		assert.Equal(t, expected, c.breadcrumbs(doc))
+	})
+
+	t.Run("frontmatter list", func(t *testing.T) {
+		c := &Converter{Breadcrumbs: true, BreadcrumbSelector: "nav.breadcrumb li", OutputDir: t.TempDir()}
+		result := c.writePage(doc, "https://example.com/docs/guide/intro", "<p>Intro</p>")
+		require.True(t, result.IsSuccess, result.Error)
+
+		var metadata map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(result.Content, &metadata))
+		assert.Equal(t, []interface{}{"Home", "Docs", "Guide", "Intro"}, metadata["breadcrumbs"])
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		c := &Converter{Breadcrumbs: true}
+		assert.Empty(t, c.breadcrumbs(loadFixture(t, "entities.html")))
+	})
+}
+
+func TestExtractContent_SelectorAttr(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(`<html><head>
+<meta name="description" content="A page about widgets">
+</head><body>
+<div class="item" data-json='{"id":1}'>one</div><div class="item" data-json='{"id":2}'>two</div><div class="item">three</div>
+</body></html>`)))
+	require.NoError(t, err)
+
+	c := &Converter{SelectorAttr: "content"}
+	content, err := c.extractContent(doc, "https://example.com", `meta[name="description"]`)
+	require.NoError(t, err)
+	assert.Equal(t, "A page about widgets", content)
+
+	c = &Converter{SelectorAttr: "data-json", SelectorIndex: 2}
+	content, err = c.extractContent(doc, "https://example.com", ".item")
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":2}`, content)
+
+	c = &Converter{SelectorAttr: "data-json"}
+	_, err = c.extractContent(doc, "https://example.com", ".item")
+	assert.ErrorIs(t, err, ErrSelectorNoMatch)
+	assert.ErrorContains(t, err, "element 3 matched by '.item' in https://example.com has no attribute 'data-json'")
+
+	c = &Converter{SelectorAttr: "data-json", OutputDir: t.TempDir(), FileMode: 0644}
+	result := c.writePage(doc, "https://example.com/widgets", `{"id":1}`)
+	require.True(t, result.IsSuccess, result.Error)
+	data, err := os.ReadFile(filepath.Join(c.OutputDir, result.FileName))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(data), `{"id":1}`), "the value is written unrendered: %s", data)
+}
+
+func TestConvertPage_SelectorRules(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/article":
+			fmt.Fprint(w, `<html><head><title>Post</title></head><body class="article">
+<nav>Menu</nav><article><p>Article body</p></article></body></html>`)
+		case "/listing":
+			fmt.Fprint(w, `<html><head><title>Index</title></head><body>
+<meta name="page-type" content="listing"><div class="entries"><p>Entry list</p></div></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><head><title>Other</title></head><body><main><p>Main body</p></main></body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	var rules []SelectorRule
+	for _, entry := range []string{"body.article => article", `meta[name="page-type"][content="listing"] => div.entries`} {
+		rule, err := ParseSelectorRule(entry)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, SelectorRules: rules}
+
+	for path, expected := range map[string]string{"/article": "Article body", "/listing": "Entry list", "/other": "Main body"} {
+		result := c.convertPage(server.URL+path, "main")
+		require.True(t, result.IsSuccess, "%s: %s", path, result.Error)
+		data, err := os.ReadFile(filepath.Join(c.OutputDir, result.FileName))
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(strings.TrimSpace(string(data)), expected), "%s converted with its rule's selector: %s", path, data)
+	}
+
+	for _, entry := range []string{"body.article", "=> main", "body[ => main", "body.article => main["} {
+		_, err := ParseSelectorRule(entry)
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestExtractContent_ShadowDOM(t *testing.T) {
+	parse := func(page string) *goquery.Document {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+		require.NoError(t, err)
+		return doc
+	}
+	components := parse(`<html><body><app-shell><doc-page><template shadowrootmode="open"><article><p>Hidden</p></article></template></doc-page></app-shell>
+<main><doc-article></doc-article></main><site-nav></site-nav><site-footer></site-footer></body></html>`)
+	plain := parse(`<html><body><main></main></body></html>`)
+
+	c := &Converter{}
+	_, err := c.extractContent(components, "https://example.com/app", "article.content")
+	assert.ErrorIs(t, err, ErrSelectorNoMatch)
+	assert.ErrorContains(t, err, "could not find content in https://example.com/app using selector 'article.content'; the page has 1 declarative shadow roots "+
+		"and custom elements <app-shell>, <doc-page>, <doc-article> and 2 more, so its content is likely rendered in shadow DOM")
+	assert.ErrorContains(t, err, "try rendering it with JavaScript (--render js)")
+
+	_, err = c.extractContent(plain, "https://example.com/plain", "article.content")
+	assert.EqualError(t, err, "could not find content in https://example.com/plain using selector 'article.content'", "pages without components get the plain message")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	content, err := c.extractContent(components, "https://example.com/app", "main")
+	require.NoError(t, err, "an empty match is still converted")
+	assert.Equal(t, "<doc-article></doc-article>", content)
+	assert.Contains(t, logs.String(), "WARNING: Selector 'main' matched only empty content in https://example.com/app: the page has 1 declarative shadow roots")
+
+	logs.Reset()
+	_, err = c.extractContent(plain, "https://example.com/plain", "main")
+	require.NoError(t, err)
+	assert.Empty(t, logs.String())
+
+	rendered := &Converter{Render: RenderJS}
+	_, err = rendered.extractContent(components, "https://example.com/app", "article.content")
+	assert.NotContains(t, err.Error(), "shadow DOM", "there is nothing to suggest once the page was rendered")
+}
+
+func TestConvertPage_Regions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>Guide</title></head><body>
+<div class="tutorial"><h2>Tutorial</h2><p>Step one.</p></div>
+<div class="reference"><h2>Reference</h2><p>All options.</p></div>
+</body></html>`)
+	}))
+	defer server.Close()
+
+	var regions []Region
+	for _, entry := range []string{"tutorial=.tutorial", "reference = .reference"} {
+		region, err := ParseRegion(entry)
+		require.NoError(t, err)
+		regions = append(regions, region)
+	}
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, Regions: regions}
+
+	result := c.convertPage(server.URL+"/guide", "")
+	require.True(t, result.IsSuccess, result.Error)
+	assert.Equal(t, "guide-tutorial.md", result.FileName)
+	assert.Equal(t, []RegionFile{
+		{Name: "tutorial", Selector: ".tutorial", FileName: "guide-tutorial.md"},
+		{Name: "reference", Selector: ".reference", FileName: "guide-reference.md"},
+	}, result.Regions)
+
+	tutorial, err := os.ReadFile(filepath.Join(c.OutputDir, "guide-tutorial.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(tutorial), "region: tutorial\n")
+	assert.Contains(t, string(tutorial), "## Tutorial\n\nStep one.")
+	assert.NotContains(t, string(tutorial), "All options.")
+	reference, err := os.ReadFile(filepath.Join(c.OutputDir, "guide-reference.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(reference), "## Reference\n\nAll options.")
+
+	c = &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, Regions: append(regions, Region{Name: "faq", Selector: ".faq"})}
+	result = c.convertPage(server.URL+"/guide", "")
+	assert.ErrorIs(t, result.Err, ErrSelectorNoMatch)
+	files, err := os.ReadDir(c.OutputDir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "a page missing a region writes nothing")
+
+	for _, entry := range []string{"tutorial", "=.tutorial", "Tutorial=.tutorial", "tutorial=.tutorial["} {
+		_, err := ParseRegion(entry)
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestExtractContent_WholePage(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(`<html><head><title>T</title></head><body>
+<nav><a href="/">Home</a></nav>
+<script>track()</script><style>p { color: red }</style>
+<div role="navigation">Menu</div>
+<h1>Title</h1><p>Body text</p>
+</body></html>`)))
+	require.NoError(t, err)
+
+	for _, selector := range []string{"", "body", "*", " body "} {
+		t.Run("selector "+selector, func(t *testing.T) {
+			c := &Converter{}
+			content, err := c.extractContent(doc, "https://example.com", selector)
+			require.NoError(t, err)
+			assert.Equal(t, "# Title\n\nBody text", c.render(content))
+		})
+	}
+	assert.Equal(t, 1, doc.Find("nav").Length(), "the document itself must not be modified")
+}
+
+func TestConvert_ProgressFunc(t *testing.T) {
+	// Loopback URLs fail fast whether or not they pass URL validation; progress
+	// is reported for failures too
+	var urls []string
+	for i := 0; i < 20; i++ {
+		urls = append(urls, fmt.Sprintf("http://127.0.0.1:1/page%d", i))
+	}
+
+	var done []int
+	seen := make(map[string]int)
+	c := &Converter{
+		Client:      &http.Client{},
+		OutputDir:   t.TempDir(),
+		Concurrency: 4,
+		Progress: func(n, total int, last Result) {
+			done = append(done, n)
+			seen[last.URL]++
+			assert.Equal(t, len(urls), total)
+			assert.Positive(t, last.Duration, "each page is timed")
+		},
+	}
+
+	resultsChan, summaryChan := c.Convert(urls, "main")
+	for range resultsChan {
+	}
+	<-summaryChan
+
+	require.Len(t, done, len(urls), "called once per URL")
+	for i, n := range done {
+		assert.Equal(t, i+1, n, "done increases by one with each call")
+	}
+	for _, u := range urls {
+		assert.Equal(t, 1, seen[u], "each URL is reported once")
+	}
+}
+
+func TestConvertFrom_TakesURLsAsWorkersFree(t *testing.T) {
+	const n = 50
+	var sent atomic.Int64
+	send := func() <-chan string {
+		input := make(chan string)
+		go func() {
+			defer close(input)
+			for i := 0; i < n; i++ {
+				input <- fmt.Sprintf("http://127.0.0.1:1/page%d", i)
+				sent.Add(1)
+			}
+		}()
+		return input
+	}
+
+	c := &Converter{Client: &http.Client{}, OutputDir: t.TempDir(), Concurrency: 2}
+	resultsChan, summaryChan := c.ConvertFrom(context.Background(), send(), 0, "main")
+	received := 0
+	for range resultsChan {
+		received++
+		// Each worker holds one URL and the dispatcher the next
+		assert.LessOrEqual(t, sent.Load(), int64(received+c.Concurrency+1), "URLs are only taken as workers free up")
+	}
+	summary := <-summaryChan
+	assert.Equal(t, n, received)
+	assert.Equal(t, n, summary.TotalURLs)
+	assert.False(t, summary.Interrupted)
+
+	// Interrupted, the URLs still to come are counted as not started
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sent.Store(0)
+	resultsChan, summaryChan = c.ConvertFrom(ctx, send(), 0, "main")
+	received = 0
+	for range resultsChan {
+		if received++; received == 5 {
+			cancel()
+		}
+	}
+	summary = <-summaryChan
+	assert.True(t, summary.Interrupted)
+	assert.Equal(t, n, summary.TotalURLs)
+	assert.Equal(t, n, summary.Successful+summary.Failed+summary.Skipped+summary.NotStarted)
+}
+
+func TestConvertFrom_LongList(t *testing.T) {
+	const n = 100000
+	input := make(chan string)
+	go func() {
+		defer close(input)
+		for i := 0; i < n; i++ {
+			input <- fmt.Sprintf("https://docs.example.com/page/%d", i)
+		}
+	}()
+
+	var heapGrowth uint64
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	c := &Converter{
+		Client:        &http.Client{},
+		OutputDir:     t.TempDir(),
+		Concurrency:   8,
+		ModifiedSince: time.Now(),
+		Progress: func(done, total int, _ Result) {
+			if done == n {
+				// The run has not yet let go of what it kept
+				var after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heapGrowth = after.HeapAlloc - min(after.HeapAlloc, before.HeapAlloc)
+			}
+		},
+	}
+	require.NoError(t, c.UseResolver("", map[string]string{"docs.example.com": "93.184.216.34"}))
+	c.Client.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		status := http.StatusNotModified // Skipped, so no file is written
+		if strings.HasSuffix(r.URL.Path, "000") {
+			status = http.StatusNotFound
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody, Request: r}, nil
+	})
+
+	resultsChan, summaryChan := c.ConvertFrom(context.Background(), input, 0, "main")
+	for range resultsChan {
+	}
+	summary := <-summaryChan
+
+	assert.Equal(t, n, summary.TotalURLs)
+	assert.Equal(t, n/1000-1, summary.Failed)
+	assert.Equal(t, n-summary.Failed, summary.Skipped)
+	require.Len(t, summary.FailedURLs, summary.Failed)
+	assert.Equal(t, "https://docs.example.com/page/1000", summary.FailedURLs[0], "failures are listed in input order")
+	assert.Equal(t, "https://docs.example.com/page/99000", summary.FailedURLs[len(summary.FailedURLs)-1])
+	assert.Less(t, heapGrowth, uint64(4<<20), "a result is not kept for every page")
+}
+
+func TestConvert_ResultsBuffer(t *testing.T) {
+	var urls []string
+	for i := 0; i < 12; i++ {
+		urls = append(urls, fmt.Sprintf("http://127.0.0.1:1/page%d", i))
+	}
+
+	for _, buffer := range []int{0, 1, 5, len(urls), 100} {
+		t.Run(fmt.Sprintf("buffer %d", buffer), func(t *testing.T) {
+			allDone := make(chan struct{})
+			c := &Converter{
+				Client:        &http.Client{},
+				OutputDir:     t.TempDir(),
+				Concurrency:   3,
+				ResultsBuffer: buffer,
+				Progress: func(n, total int, _ Result) {
+					if n == total {
+						close(allDone)
+					}
+				},
+			}
+
+			resultsChan, summaryChan := c.Convert(urls, "main")
+			if buffer >= len(urls) {
+				// Every result fits in the buffer, so the workers finish before any is read
+				select {
+				case <-allDone:
+				case <-time.After(10 * time.Second):
+					t.Fatal("workers did not run ahead of the consumer")
+				}
+			}
+			received := 0
+			timeout := time.After(10 * time.Second)
+			for results := resultsChan; results != nil; {
+				select {
+				case _, ok := <-results:
+					if !ok {
+						results = nil
+						continue
+					}
+					received++
+					time.Sleep(2 * time.Millisecond) // A slow consumer
+				case <-timeout:
+					t.Fatal("the run deadlocked")
+				}
+			}
+			summary := <-summaryChan
+			assert.Equal(t, len(urls), received)
+			assert.Equal(t, len(urls), summary.Failed)
+		})
+	}
+}
+
+func TestConvertPage_AcceptStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/cached":
+			w.WriteHeader(http.StatusNonAuthoritativeInfo)
+			fmt.Fprint(w, `<html><head><title>Cached</title></head><body><main><p>From a proxy.</p></main></body></html>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<html><head><title>Lost</title></head><body><main><p>Nothing here, but a fine 404 page.</p></main></body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644}
+	result := c.convertPage(server.URL+"/cached", "main")
+	assert.ErrorIs(t, result.Err, ErrFetch, "only a 200 is converted by default")
+
+	c.AcceptStatus = []int{http.StatusNonAuthoritativeInfo, http.StatusNotFound}
+	c.Preflight = true
+	for _, page := range []string{"cached", "missing"} {
+		result = c.convertPage(server.URL+"/"+page, "main")
+		require.True(t, result.IsSuccess, "%s: %s", page, result.Error)
+	}
+	data, err := os.ReadFile(filepath.Join(c.OutputDir, "lost.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Nothing here, but a fine 404 page.")
+
+	c.AcceptStatus = []int{http.StatusNotFound}
+	result = c.convertPage(server.URL+"/cached", "main")
+	var e *Error
+	require.ErrorAs(t, result.Err, &e, "codes not listed still fail")
+	assert.Equal(t, http.StatusNonAuthoritativeInfo, e.StatusCode)
+}
+
+func TestConvertPage_MatchCount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><head><title>Cards</title></head><body><main><div class="card">One</div><div class="card">Two</div><div class="card">Three</div></main></body></html>`)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		selector string
+		count    int
+		success  bool
+	}{
+		{"main", 1, true},
+		{".card", 3, true},
+		{"article", 0, false},
+		{"", 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.selector, func(t *testing.T) {
+			c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644}
+			result := c.convertPage(server.URL+"/cards", tc.selector)
+			assert.Equal(t, tc.success, result.IsSuccess, result.Error)
+			assert.Equal(t, tc.count, result.MatchCount)
+		})
+	}
+}
+
+func TestConvertPage_SkipSignal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		head := ""
+		switch r.URL.Path {
+		case "/hidden":
+			head = `<meta name="Robots" content="nofollow, NOINDEX">`
+		case "/banner":
+			head = `<meta name="robots" content="index, follow">`
+		}
+		fmt.Fprintf(w, `<html><head><title>%s</title>%s</head><body><main><p>Content</p></main>`, r.URL.Path[1:], head)
+		if r.URL.Path == "/banner" {
+			io.WriteString(w, `<div class="noindex">Archived</div>`)
+		}
+		io.WriteString(w, `</body></html>`)
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644}
+	result := c.convertPage(server.URL+"/hidden", "main")
+	assert.True(t, result.IsSuccess, "noindex pages are converted by default")
+
+	c = &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, SkipNoindex: true, SkipSelector: ".noindex"}
+	for _, page := range []string{"hidden", "banner"} {
+		result = c.convertPage(server.URL+"/"+page, "main")
+		assert.True(t, result.Skipped, "%s is skipped", page)
+		assert.False(t, result.IsSuccess)
+		assert.ErrorIs(t, result.Err, ErrSkipSignal)
+	}
+	assert.Contains(t, result.Error, "matches skip selector '.noindex'")
+	result = c.convertPage(server.URL+"/plain", "main")
+	assert.True(t, result.IsSuccess, result.Error)
+
+	entries, err := os.ReadDir(c.OutputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "skipped pages are not written")
+	assert.Equal(t, "plain.md", entries[0].Name())
+}
+
+func TestSplitTokens(t *testing.T) {
+	paragraph := strings.TrimSpace(strings.Repeat("word ", 30)) // 40 tokens, from its 30 words
+	code := "```go\nfunc a() {}\n\n\nfunc b() {}\n```"
+
+	assert.Equal(t, []string{"short text"}, splitTokens("short text", 100))
+	parts := splitTokens(strings.Join([]string{paragraph, paragraph, code, paragraph, paragraph}, "\n\n"), 82)
+	assert.Equal(t, []string{paragraph + "\n\n" + paragraph, code + "\n\n" + paragraph, paragraph}, parts,
+		"parts break between paragraphs, never inside a code block")
+	for _, part := range parts {
+		assert.LessOrEqual(t, estimateTokens(part), 82)
+	}
+	assert.Len(t, splitTokens(paragraph+"\n\n"+paragraph, 10), 2, "a paragraph over the limit is a part of its own")
+}
+
+func TestConvertPage_SplitTokens(t *testing.T) {
+	var body strings.Builder
+	for i := 1; i <= 6; i++ {
+		fmt.Fprintf(&body, "<h2>Section %d</h2><p>%s</p>", i, strings.Repeat("lorem ipsum ", 40))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Long page</title></head><body><main>%s</main></body></html>", body.String())
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, SplitTokens: 250}
+	result := c.convertPage(server.URL+"/long", "main")
+	require.True(t, result.IsSuccess, result.Error)
+	assert.Equal(t, []string{"long_page-part1.md", "long_page-part2.md", "long_page-part3.md"}, result.Parts)
+	assert.Equal(t, "long_page-part1.md", result.FileName)
+	assert.NoFileExists(t, filepath.Join(c.OutputDir, "long_page.md"))
+
+	var text []string
+	for i, name := range result.Parts {
+		data, err := os.ReadFile(filepath.Join(c.OutputDir, name))
+		require.NoError(t, err)
+		parts := strings.SplitN(string(data), "---\n", 3)
+		require.Len(t, parts, 3)
+		var metadata map[string]interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(parts[1]), &metadata))
+		assert.Equal(t, i+1, metadata["part"])
+		assert.Equal(t, 3, metadata["parts"])
+		assert.Equal(t, "Long page", metadata["title"])
+		assert.LessOrEqual(t, estimateTokens(parts[2]), 250)
+		text = append(text, strings.TrimSpace(parts[2]))
+	}
+	assert.True(t, strings.HasPrefix(text[0], "## Section 1"))
+	assert.Equal(t, 6, strings.Count(strings.Join(text, "\n"), "## Section"), "no content is lost between parts")
+
+	result = (&Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, SplitTokens: 100000}).convertPage(server.URL+"/long", "main")
+	assert.Equal(t, "long_page.md", result.FileName, "pages within the limit are written whole")
+	assert.Empty(t, result.Parts)
+}
+
+func TestConvertPage_StableFileNames(t *testing.T) {
+	// Every page has the same title, so they all sanitize to guide.md
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Guide</title></head><body><main><p>Content of %s</p></main></body></html>", r.URL.Path)
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, names: newNameRegistry()}
+	first := c.convertPage(server.URL+"/v1/guide", "main")
+	second := c.convertPage(server.URL+"/v2/guide", "main")
+	require.True(t, first.IsSuccess, first.Error)
+	require.True(t, second.IsSuccess, second.Error)
+	assert.Equal(t, "guide.md", first.FileName)
+	assert.Equal(t, "guide-2.md", second.FileName, "different sources get distinct names")
+
+	// Converting the pages again, as a retry would, reuses their files
+	again := c.convertPage(server.URL+"/v2/guide#intro", "main")
+	assert.Equal(t, "guide-2.md", again.FileName)
+	assert.Equal(t, "guide.md", c.convertPage(server.URL+"/v1/guide", "main").FileName)
+	entries, err := os.ReadDir(c.OutputDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "reprocessing a URL yields one file, not two")
+
+	// A new converter continuing the run knows whose files are there
+	resumed := &Converter{Client: server.Client(), OutputDir: c.OutputDir, FileMode: 0644, names: newNameRegistry()}
+	resumed.ReserveFileNames([]Result{first})
+	assert.Equal(t, "guide-2.md", resumed.convertPage(server.URL+"/v2/guide", "main").FileName, "another page's file is never overwritten")
+	assert.Equal(t, "guide.md", resumed.convertPage(server.URL+"/v1/guide", "main").FileName)
+}
+
+func TestConvertPage_ContentHash(t *testing.T) {
+	body := "First version"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Status</title></head><body><main><p>%s</p></main></body></html>", body)
+	}))
+	defer server.Close()
+
+	// convert runs the page through a new converter, as a separate run would
+	convert := func(algorithm string) (interface{}, string) {
+		c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, ContentHash: algorithm}
+		result := c.convertPage(server.URL+"/status", "main")
+		require.True(t, result.IsSuccess, result.Error)
+		data, err := os.ReadFile(filepath.Join(c.OutputDir, result.FileName))
+		require.NoError(t, err)
+		parts := strings.SplitN(string(data), "---\n", 3)
+		require.Len(t, parts, 3)
+		var metadata map[string]interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(parts[1]), &metadata))
+		return metadata["content_hash"], strings.TrimPrefix(parts[2], "\n") // The blank line after the frontmatter
+	}
+
+	first, written := convert(HashSHA256)
+	sum := sha256.Sum256([]byte(written))
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), first, "the hash covers the body as written")
+	second, _ := convert(HashSHA256)
+	assert.Equal(t, first, second, "identical content has identical hashes across runs")
+
+	other, _ := convert(HashMD5)
+	assert.Regexp(t, `^md5:[0-9a-f]{32}$`, other)
+	none, _ := convert(HashNone)
+	assert.Nil(t, none, "no field unless asked for")
+
+	body = "Second version"
+	changed, _ := convert(HashSHA256)
+	assert.NotEqual(t, first, changed)
+}
+
+func TestFetch_Preflight(t *testing.T) {
+	var gets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets = append(gets, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		case "/dead":
+			http.NotFound(w, r)
+			return
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+		}
+		fmt.Fprint(w, "<html><body><main>ok</main></body></html>")
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), Preflight: true}
+
+	_, err := c.fetchDocument(server.URL + "/page")
+	assert.NoError(t, err)
+
+	_, err = c.fetchDocument(server.URL + "/report.pdf")
+	assert.ErrorIs(t, err, ErrNotHTML)
+
+	_, err = c.fetchDocument(server.URL + "/dead")
+	assert.ErrorIs(t, err, ErrFetch)
+
+	_, err = c.fetchDocument(server.URL + "/no-head")
+	assert.NoError(t, err, "a 405 to HEAD falls back to GET")
+
+	assert.Equal(t, []string{"/page", "/no-head"}, gets, "no GET after a failed preflight")
+}
+
+func TestGet_MaxBodySizes(t *testing.T) {
+	page := "<html><body><main>" + strings.Repeat("x", 2048) + "</main></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	c := &Converter{
+		Client:       server.Client(),
+		MaxBodySize:  4096,
+		MaxBodySizes: map[string]int64{"text/html": 1024, "image/*": 8192},
+	}
+
+	_, err := c.fetchDocument(server.URL + "/page")
+	assert.ErrorIs(t, err, ErrTooLarge, "HTML is held to its own, smaller limit")
+
+	resp, err := c.get(server.URL + "/image")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "a body of the same size passes under the image limit")
+	assert.Len(t, body, len(page))
+
+	assert.Equal(t, int64(1024), c.bodyLimit("TEXT/HTML; charset=utf-8"))
+	assert.Equal(t, int64(4096), c.bodyLimit("application/pdf"), "other types fall back to MaxBodySize")
+	assert.Equal(t, int64(DefaultConcurrency*8193), c.MemoryCeiling(100))
+	c.ResultsBuffer = 2
+	assert.Equal(t, int64((DefaultConcurrency+2)*8193), c.MemoryCeiling(100), "buffered results count like pages in flight")
+	c.CombineByHost = true
+	assert.Equal(t, int64((DefaultConcurrency+2+100)*8193), c.MemoryCeiling(100), "combined pages are kept until the run completes")
+	c.MaxBodySize = math.MaxInt64
+	assert.Equal(t, int64(math.MaxInt64), c.MemoryCeiling(100), "the ceiling does not wrap around")
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// countingBody is a response body of size bytes that adds each byte read to
+// read and inflight, and records the largest inflight total in peak.
+type countingBody struct {
+	size, read     int64
+	inflight, peak *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	if b.read >= b.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), b.size-b.read, 512))
+	for i := range p[:n] {
+		p[i] = 'x'
+	}
+	b.read += int64(n)
+	now := b.inflight.Add(int64(n))
+	for peak := b.peak.Load(); now > peak && !b.peak.CompareAndSwap(peak, now); peak = b.peak.Load() {
+	}
+	return n, nil
+}
+
+func (b *countingBody) Close() error { return nil }
+
+func TestConvert_MemoryCeiling(t *testing.T) {
+	const limit = 4096
+	var inflight, peak atomic.Int64
+	var mu sync.Mutex
+	bodies := make(map[string]*countingBody)
+
+	c := &Converter{
+		Client:        &http.Client{},
+		OutputDir:     t.TempDir(),
+		Concurrency:   4,
+		ResultsBuffer: 2,
+		MaxBodySize:   limit,
+	}
+	require.NoError(t, c.UseResolver("", map[string]string{"docs.example.com": "93.184.216.34"}))
+	c.Client.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		size := int64(16 * limit) // Oversized, and streamed without a Content-Length
+		if strings.HasSuffix(r.URL.Path, "/small") {
+			size = limit / 2
+		}
+		body := &countingBody{size: size, inflight: &inflight, peak: &peak}
+		mu.Lock()
+		bodies[r.URL.String()] = body
+		mu.Unlock()
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {"text/html"}},
+			Body:          body,
+			ContentLength: -1,
+			Request:       r,
+		}, nil
+	})
+
+	var urls []string
+	for i := 0; i < 24; i++ {
+		if i%3 == 0 {
+			urls = append(urls, fmt.Sprintf("https://docs.example.com/%d/small", i))
+		} else {
+			urls = append(urls, fmt.Sprintf("https://docs.example.com/%d/large", i))
+		}
+	}
+
+	resultsChan, summaryChan := c.Convert(urls, "body")
+	for result := range resultsChan {
+		// A page's bytes count as in flight until the consumer has its result
+		mu.Lock()
+		body := bodies[result.URL]
+		mu.Unlock()
+		require.NotNil(t, body, result.URL)
+		assert.LessOrEqual(t, body.read, int64(limit+1), "a body is not read far past its limit")
+		if strings.HasSuffix(result.URL, "/large") {
+			assert.ErrorIs(t, result.Err, ErrTooLarge, result.URL)
+		}
+		inflight.Add(-body.read)
+		time.Sleep(5 * time.Millisecond) // A slow consumer lets every slot fill up
+	}
+	summary := <-summaryChan
+
+	assert.Equal(t, len(urls), summary.TotalURLs)
+	assert.Equal(t, 16, summary.Failed)
+	assert.Greater(t, peak.Load(), int64(2*limit), "the workers ran concurrently")
+	assert.LessOrEqual(t, peak.Load(), c.MemoryCeiling(len(urls)))
+}
+
+func TestConvert_DNSFailures(t *testing.T) {
+	// The .invalid top-level domain is reserved and never resolves
+	urls := []string{"http://doc-converter-test.invalid/page", "http://127.0.0.1:1/page"}
+	c := &Converter{Client: &http.Client{Timeout: time.Second}, OutputDir: t.TempDir(), Concurrency: 2}
+
+	resultsChan, summaryChan := c.Convert(urls, "main")
+	errs := make(map[string]error)
+	for result := range resultsChan {
+		errs[result.URL] = result.Err
+	}
+	summary := <-summaryChan
+
+	assert.ErrorIs(t, errs[urls[0]], ErrDNS)
+	var e *Error
+	require.ErrorAs(t, errs[urls[0]], &e)
+	assert.Equal(t, ErrDNS, e.Kind)
+	assert.NotErrorIs(t, errs[urls[1]], ErrDNS)
+	assert.Equal(t, 2, summary.Failed)
+	assert.Equal(t, 1, summary.DNSFailures)
+}
+
+func TestConvertContext_Interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var pages bytes.Buffer
+	c := &Converter{Client: &http.Client{Timeout: time.Second}, OutputDir: t.TempDir(), Concurrency: 2, SingleJSON: &pages, PreserveOrder: true}
+
+	resultsChan, summaryChan := c.ConvertContext(ctx, []string{"http://doc-converter-test.invalid/a", "http://doc-converter-test.invalid/b"}, "main")
+	for result := range resultsChan {
+		t.Errorf("unexpected result for %s after the run was interrupted", result.URL)
+	}
+	summary := <-summaryChan
+	assert.True(t, summary.Interrupted)
+	assert.Equal(t, 2, summary.NotStarted)
+	assert.Equal(t, 2, summary.TotalURLs)
+	assert.Zero(t, summary.Failed)
+	assert.Equal(t, "[]\n", pages.String(), "the JSON output is still closed")
+}
+
+func TestConvertPage_TooLarge(t *testing.T) {
+	chunk := "<p>" + strings.Repeat("x", 1000) + "</p>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/sized" {
+			w.Header().Set("Content-Length", "100000")
+			fmt.Fprint(w, strings.Repeat(chunk, 100)[:100000])
+			return
+		}
+		// Flushing before the end streams the body in chunks, without a Content-Length
+		fmt.Fprint(w, "<html><head><title>Huge</title></head><body><main>")
+		for i := 0; i < 100; i++ {
+			fmt.Fprint(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "</main></body></html>")
+	}))
+	defer server.Close()
+
+	for _, fetchOnly := range []bool{false, true} {
+		for _, path := range []string{"/chunked", "/sized"} {
+			t.Run(fmt.Sprintf("%s fetch-only=%v", path, fetchOnly), func(t *testing.T) {
+				c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, MaxBodySize: 10000, FetchOnly: fetchOnly}
+				result := c.convertPage(server.URL+path, "main")
+				assert.False(t, result.IsSuccess)
+				assert.ErrorIs(t, result.Err, ErrTooLarge)
+				assert.Empty(t, result.FileName)
+				assert.Nil(t, result.Content, "nothing of the partial read is kept")
+				files, err := os.ReadDir(c.OutputDir)
+				require.NoError(t, err)
+				assert.Empty(t, files, "no file is written for a partial body")
+			})
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	text := "# Intro\n\nSkip me\n\n## Begin\n\nKeep this\n\nand this\n\n## End\n\nFooter"
+
+	testCases := []struct {
+		name       string
+		start, end string
+		expected   string
+		wantErr    bool
+	}{
+		{"between markers", `## Begin`, `## End`, "Keep this\n\nand this", false},
+		{"start only", `## Begin`, "", "Keep this\n\nand this\n\n## End\n\nFooter", false},
+		{"end only", "", `(?m)^## End`, "# Intro\n\nSkip me\n\n## Begin\n\nKeep this\n\nand this", false},
+		{"end not found runs to the end", `## Begin`, `## Missing`, "Keep this\n\nand this\n\n## End\n\nFooter", false},
+		{"start not found fails", `## Missing`, `## End`, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Converter{}
+			if tc.start != "" {
+				c.SliceStart = regexp.MustCompile(tc.start)
+			}
+			if tc.end != "" {
+				c.SliceEnd = regexp.MustCompile(tc.end)
+			}
+			sliced, err := c.slice(text, "https://example.com")
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrSliceNoMatch)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, sliced)
+		})
+	}
+}
+
+func TestConvertPage_XML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/docbook+xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<book xmlns="http://docbook.org/ns/docbook" xmlns:xlink="http://www.w3.org/1999/xlink">
+  <info><title>Admin Guide</title></info>
+  <chapter xml:id="install">
+    <title>Installing</title>
+    <para>Run <command>make install</command> as root.</para>
+    <para>See the <link xlink:href="https://example.com/faq">FAQ</link>&nbsp;first.<remark>TODO</remark></para>
+    <section>
+      <title>Checking</title>
+      <programlisting language="sh">make check
+  make test</programlisting>
+    </section>
+  </chapter>
+  <chapter xml:id="upgrade"><title>Upgrading</title><para>Not yet.</para></chapter>
+</book>`)
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, InputFormat: InputXML, Preflight: true}
+	result := c.convertPage(server.URL+"/guide.xml", "chapter[@id='install']")
+	require.True(t, result.IsSuccess, result.Error)
+	assert.Equal(t, "installing.md", result.FileName)
+	assert.Contains(t, string(result.Content), "title: Installing\n")
+	assert.True(t, strings.HasSuffix(string(result.Content), "---\n\n# Installing\n\n"+
+		"Run `make install` as root.\n\n"+
+		"See the [FAQ](https://example.com/faq) first.\n\n"+
+		"## Checking\n\n"+
+		"```sh\nmake check\n  make test\n```"), string(result.Content))
+
+	// Whole documents are titled after the root; rules map other elements
+	c.XMLElements = map[string]string{"title": XMLDrop}
+	result = c.convertPage(server.URL+"/guide.xml", "")
+	require.True(t, result.IsSuccess, result.Error)
+	assert.Equal(t, "admin_guide.md", result.FileName)
+	assert.NotContains(t, string(result.Content), "Installing")
+	assert.Contains(t, string(result.Content), "Not yet.")
+
+	result = c.convertPage(server.URL+"/guide.xml", "/book/appendix")
+	assert.ErrorIs(t, result.Err, ErrSelectorNoMatch)
+}
+
+func TestParseXMLPath(t *testing.T) {
+	doc, err := parseXML(strings.NewReader(`<book><chapter id="a"><para>1</para><para>2</para></chapter><chapter id="b"><section><para>3</para></section></chapter></book>`))
+	require.NoError(t, err)
+
+	for path, want := range map[string]string{
+		"":                   "123",
+		"/book/chapter":      "12",
+		"/book/chapter[2]":   "3",
+		"//para":             "1",
+		"chapter[@id=\"b\"]": "3",
+		"//chapter/para[2]":  "2",
+		"/book/*[@id]//para": "1",
+		"/book/chapter/para": "1",
+		"section/para":       "3",
+	} {
+		p, err := ParseXMLPath(path)
+		require.NoError(t, err, path)
+		matches := p.find(doc)
+		require.NotEmpty(t, matches, path)
+		assert.Equal(t, want, matches[0].textContent(), path)
+	}
+
+	for _, path := range []string{"/book/[1]", "//para[0]", "//para[@id=b]", "//para[last()]", "//para[1"} {
+		_, err := ParseXMLPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestGet_UserAgentRotation(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.UserAgent())
+		mu.Unlock()
+	}))
+	defer server.Close()
+	agents := []string{"agent-a/1.0", "agent-b/2.0", "agent-c/3.0"}
+	fetch := func(c *Converter, n int) []string {
+		seen = nil
+		for range n {
+			resp, err := c.get(server.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		return seen
+	}
+
+	c := &Converter{Client: server.Client()}
+	require.NoError(t, c.UseUserAgents(agents, RotateRoundRobin))
+	assert.Equal(t, append(agents, agents...), fetch(c, 6))
+
+	require.NoError(t, c.UseUserAgents(agents, RotateRandom))
+	used := make(map[string]bool)
+	for _, agent := range fetch(c, 50) {
+		assert.Contains(t, agents, agent)
+		used[agent] = true
+	}
+	assert.Greater(t, len(used), 1, "random rotation uses more than one agent")
+
+	require.NoError(t, c.UseUserAgents(agents[:1], ""))
+	assert.Equal(t, []string{"agent-a/1.0", "agent-a/1.0"}, fetch(c, 2), "a single agent is sent with every request")
+	assert.Error(t, c.UseUserAgents(agents, "sticky"))
+}
+
+func TestRender_HeadingStyle(t *testing.T) {
+	html := "<h1>One</h1><h2>Two</h2><h3>Three</h3><h4>Four</h4><h5>Five</h5><h6>Six</h6><p>Text</p>"
+
+	t.Run("atx by default", func(t *testing.T) {
+		rendered := (&Converter{}).render(html)
+		assert.Equal(t, "# One\n\n## Two\n\n### Three\n\n#### Four\n\n##### Five\n\n###### Six\n\nText", rendered)
+		for _, line := range strings.Split(rendered, "\n") {
+			assert.NotRegexp(t, `^(=+|-+)$`, line, "no Setext underlines")
+		}
+	})
+
+	t.Run("setext", func(t *testing.T) {
+		rendered := (&Converter{HeadingStyle: HeadingSetext}).render(html)
+		assert.Equal(t, "One\n===\n\nTwo\n---\n\n### Three\n\n#### Four\n\n##### Five\n\n###### Six\n\nText", rendered)
+	})
+}
+
+func TestRender_MaxHeadingDepth(t *testing.T) {
+	html := "<h1>One</h1><h2>Two</h2><h3>Three</h3><h4>Four</h4><h5>Five</h5><h6>Six</h6><p>Text</p>"
+
+	t.Run("bold by default", func(t *testing.T) {
+		rendered := (&Converter{MaxHeadingDepth: 3}).render(html)
+		assert.Equal(t, "# One\n\n## Two\n\n### Three\n\n**Four**\n\n**Five**\n\n**Six**\n\nText", rendered)
+	})
+
+	t.Run("clamp", func(t *testing.T) {
+		rendered := (&Converter{MaxHeadingDepth: 3, HeadingDemotion: HeadingDemoteClamp}).render(html)
+		assert.Equal(t, "# One\n\n## Two\n\n### Three\n\n### Four\n\n### Five\n\n### Six\n\nText", rendered)
+	})
+
+	t.Run("other formats", func(t *testing.T) {
+		rendered := (&Converter{Format: FormatAsciiDoc, MaxHeadingDepth: 3}).render(html)
+		assert.Equal(t, "== One\n\n=== Two\n\n==== Three\n\n*Four*\n\n*Five*\n\n*Six*\n\nText", rendered)
+		rendered = (&Converter{Format: FormatRST, MaxHeadingDepth: 3, HeadingDemotion: HeadingDemoteClamp}).render("<h2>Two</h2><h5>Five</h5>")
+		assert.Equal(t, "Two\n---\n\nFive\n~~~~", rendered)
+	})
+}
+
+func TestRender_Anchors(t *testing.T) {
+	html := `<h1 id="intro">Intro</h1><p>Text</p><h2 id="installation">Installation</h2><h3>No id</h3><h4 id="step 1">Step one</h4>`
+
+	t.Run("dropped by default", func(t *testing.T) {
+		rendered := (&Converter{}).render(html)
+		assert.Equal(t, "# Intro\n\nText\n\n## Installation\n\n### No id\n\n#### Step one", rendered)
+	})
+
+	t.Run("html", func(t *testing.T) {
+		rendered := (&Converter{AnchorStyle: AnchorHTML}).render(html)
+		assert.Equal(t, `<a id="intro"></a>`+"\n\n# Intro\n\nText\n\n"+`<a id="installation"></a>`+"\n\n## Installation\n\n### No id\n\n"+`<a id="step 1"></a>`+"\n\n#### Step one", rendered)
+	})
+
+	t.Run("attribute", func(t *testing.T) {
+		rendered := (&Converter{AnchorStyle: AnchorAttribute}).render(html)
+		assert.Equal(t, "# Intro {#intro}\n\nText\n\n## Installation {#installation}\n\n### No id\n\n"+`<a id="step 1"></a>`+"\n\n#### Step one", rendered,
+			"an id with a space cannot be an attribute")
+
+		rendered = (&Converter{AnchorStyle: AnchorAttribute, HeadingStyle: HeadingSetext}).render(html)
+		assert.Contains(t, rendered, "Installation {#installation}\n------------")
+
+		rendered = (&Converter{AnchorStyle: AnchorAttribute, MaxHeadingDepth: 1}).render(html)
+		assert.Contains(t, rendered, `<a id="installation"></a>`+"\n\n**Installation**", "demoted headings are paragraphs, which take no attribute")
+	})
+
+	t.Run("other formats", func(t *testing.T) {
+		rendered := (&Converter{Format: FormatAsciiDoc, AnchorStyle: AnchorHTML}).render(html)
+		assert.Contains(t, rendered, "[[installation]]\n=== Installation")
+		assert.NotContains(t, rendered, "[[step 1]]", "AsciiDoc anchors cannot hold spaces")
+
+		rendered = (&Converter{Format: FormatRST, AnchorStyle: AnchorHTML}).render(html)
+		assert.Contains(t, rendered, ".. _installation:\n\nInstallation\n------------")
+		assert.Contains(t, rendered, ".. _`step 1`:\n\nStep one")
+	})
+
+	t.Run("converted page", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<html><head><title>Guide</title></head><body><main>`+html+`</main></body></html>`)
+		}))
+		defer server.Close()
+
+		c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, AnchorStyle: AnchorAttribute}
+		result := c.convertPage(server.URL+"/guide", "main")
+		require.True(t, result.IsSuccess, result.Error)
+		data, err := os.ReadFile(filepath.Join(c.OutputDir, "guide.md"))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "## Installation {#installation}", "ids survive extraction")
+	})
+}
+
+func TestRender_InlineCodeAndPaths(t *testing.T) {
+	doc := loadFixture(t, "escaping.html")
+	content, err := doc.Find("main").Html()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{FormatMarkdown, "Edit pkg/converter/file_name.go and set `max_body_size` to 2*1024*1024.\n\n" +
+			"Dereference with `*ptr` or match `` `tick` `` literally."},
+		{FormatAsciiDoc, "Edit pkg/converter/file_name.go and set `+max_body_size+` to 2*1024*1024.\n\n" +
+			"Dereference with `+*ptr+` or match `+`tick`+` literally."},
+		{FormatRST, "Edit pkg/converter/file_name.go and set ``max_body_size`` to 2*1024*1024.\n\n" +
+			"Dereference with ``*ptr`` or match ```tick``` literally."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			c := &Converter{Format: tc.format, RichMarkdown: true}
+			assert.Equal(t, tc.expected, c.render(content), "paths and code spans should not be escaped")
+		})
+	}
+
+	// The classic Markdown writes inline code as plain text, as it always has
+	assert.Equal(t, "Edit pkg/converter/file_name.go and set max_body_size to 2*1024*1024.\n\n"+
+		"Dereference with *ptr or match `tick` literally.", (&Converter{}).render(content))
+}
+
+func TestRender_CodeBlockWhitespace(t *testing.T) {
+	doc := loadFixture(t, "code.html")
+	content, err := doc.Find("main").Html()
+	require.NoError(t, err)
+
+	python := "def greet(names):\n" +
+		"    for name in names:\n" +
+		"\n" +
+		"        if name:\n" +
+		"\t        print(f\"hi  {name}\")  \n" +
+		"    return None"
+	highlighted := "if x:\n    y()\n        z()"
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{FormatMarkdown, "A paragraph, collapsed.\n\n```python\n" + python + "\n```\n\n```\n" + highlighted + "\n```"},
+		{FormatAsciiDoc, "A paragraph, collapsed.\n\n[source,python]\n----\n" + python + "\n----\n\n----\n" + highlighted + "\n----"},
+		{FormatRST, "A paragraph, collapsed.\n\n.. code-block:: python\n\n" + indentLines(python) + "\n\n::\n\n" + indentLines(highlighted)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			c := &Converter{Format: tc.format, RichMarkdown: true}
+			assert.Equal(t, tc.expected, c.render(content), "code keeps its whitespace; only prose is collapsed")
+		})
+	}
+
+	// The classic Markdown leaves code blocks out, as it always has
+	assert.Equal(t, "A   paragraph,\n   collapsed.", (&Converter{}).render(content))
+}
+
+func TestRender_NestedStructures(t *testing.T) {
+	doc := loadFixture(t, "nested.html")
+	content, err := doc.Find("main").Html()
+	require.NoError(t, err)
+
+	// The classic Markdown keeps only the paragraphs and links of lists and
+	// tables, as it always has
+	assert.Equal(t, "[support](https://example.com/support)Pick a region:", (&Converter{}).render(content))
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{FormatMarkdown, "| Plan | Includes |\n" +
+			"| --- | --- |\n" +
+			"| Free | • 1 project<br>• Community [support](https://example.com/support) |\n" +
+			"| Pro \\| Team | Everything in Free<br>plus:<br>1. SSO<br>2. Audit logs |\n\n" +
+			"1. Install the CLI.\n\n" +
+			"2. Pick a region:\n\n" +
+			"   | Region | Latency |\n" +
+			"   | --- | --- |\n" +
+			"   | eu-west | 20 ms |\n\n" +
+			"3. Deploy with `deploy --all`:\n" +
+			"   - staging first\n" +
+			"   - then production"},
+		{FormatAsciiDoc, "[%header,cols=\"2*\"]\n|===\n" +
+			"| Plan | Includes\n" +
+			"| Free | • 1 project +\n• Community link:https://example.com/support[support]\n" +
+			"| Pro \\| Team | Everything in Free +\nplus: +\n1. SSO +\n2. Audit logs\n" +
+			"|===\n\n" +
+			". Install the CLI.\n" +
+			". Pick a region:\n+\n[%header,cols=\"2*\"]\n|===\n| Region | Latency\n| eu-west | 20 ms\n|===\n" +
+			". Deploy with `+deploy --all+`:\n" +
+			"** staging first\n" +
+			"** then production"},
+		{FormatRST, ".. list-table::\n   :header-rows: 1\n\n" +
+			"   * - Plan\n     - Includes\n" +
+			"   * - Free\n     - | • 1 project\n       | • Community `support <https://example.com/support>`__\n" +
+			"   * - Pro | Team\n     - | Everything in Free\n       | plus:\n       | 1. SSO\n       | 2. Audit logs\n\n" +
+			"1. Install the CLI.\n\n" +
+			"2. Pick a region:\n\n" +
+			"   .. list-table::\n      :header-rows: 1\n\n" +
+			"      * - Region\n        - Latency\n      * - eu-west\n        - 20 ms\n\n" +
+			"3. Deploy with ``deploy --all``:\n\n" +
+			"   - staging first\n" +
+			"   - then production"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			c := &Converter{Format: tc.format, RichMarkdown: true}
+			assert.Equal(t, tc.expected, c.render(content), "lists in cells become lines; tables in list items keep the item's indentation")
+		})
+	}
+	assert.Empty(t, CheckMarkdown((&Converter{RichMarkdown: true}).render(content)), "the markdown tables and lists are well-formed")
+}
+
+// indentLines indents the non-empty lines of s as an RST literal block.
+func indentLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "   " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestNewDownloadConverter_RefusesPopulatedDownloadDir(t *testing.T) {
+	dir := filepath.Join("tmp", "downloads", "reused-id")
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+		// Only removed when no other download is left behind
+		os.Remove(filepath.Join("tmp", "downloads"))
+		os.Remove("tmp")
+	})
+
+	c, err := NewDownloadConverter("reused-id")
+	require.NoError(t, err)
+	assert.Equal(t, dir, c.OutputDir)
+	assert.Equal(t, "reused-id", c.DownloadID)
+
+	_, err = NewDownloadConverter("reused-id")
+	assert.NoError(t, err, "an empty directory holds no other job's output")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page.md"), []byte("other job"), 0644))
+	_, err = NewDownloadConverter("reused-id")
+	assert.ErrorContains(t, err, "already populated by another job")
+	data, _ := os.ReadFile(filepath.Join(dir, "page.md"))
+	assert.Equal(t, "other job", string(data), "the other job's files must be left alone")
+}
+
+func TestGetSanitizedTitle_QueryParams(t *testing.T) {
+	untitled, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body><p>No title</p></body></html>"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		converter Converter
+		url       string
+		expected  string
+	}{
+		{"keeps the query by default", Converter{}, "https://example.com/docs/view?id=42&lang=en", "view_id_42_lang_en"},
+		{"disambiguates the root page", Converter{}, "https://example.com/?page=2", "examplecom_page_2"},
+		{"drops the query", Converter{DropQuery: true}, "https://example.com/docs/view?id=42&lang=en", "view"},
+		{"keeps selected params", Converter{QueryParams: []string{"id"}}, "https://example.com/docs/view?lang=en&id=42&utm_source=x", "view_id_42"},
+		{"ignores an unselected query", Converter{QueryParams: []string{"id"}}, "https://example.com/docs/view?utm_source=x", "view"},
+		{"uses the last path segment", Converter{}, "https://example.com/docs/guide/", "guide"},
+		{"falls back to untitled", Converter{DropQuery: true}, "https://example.com/%E6%97%A5?id=1", "untitled"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.converter.getSanitizedTitle(untitled, tc.url))
+		})
+	}
+
+	c := &Converter{}
+	assert.NotEqual(t, c.getSanitizedTitle(untitled, "https://example.com/item?id=1"), c.getSanitizedTitle(untitled, "https://example.com/item?id=2"),
+		"pages told apart by the query should get different names")
+}
+
+func TestPageTitle(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><head><title>MySite | Intro | MySite</title></head>
+<body><h1 class="article-title">Getting
+  started</h1><p class="subtitle"></p></body></html>`))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		converter Converter
+		title     string
+		filename  string
+	}{
+		{"reads <title> by default", Converter{}, "MySite | Intro | MySite", "mysite__intro__mysite"},
+		{"overrides with the selector", Converter{TitleSelector: ".article-title"}, "Getting started", "getting_started"},
+		{"falls back when the selector matches nothing", Converter{TitleSelector: ".missing"}, "MySite | Intro | MySite", "mysite__intro__mysite"},
+		{"falls back when the match is empty", Converter{TitleSelector: ".subtitle"}, "MySite | Intro | MySite", "mysite__intro__mysite"},
+		{"strips a suffix", Converter{TitleStrip: regexp.MustCompile(`\s*\|\s*MySite$`)}, "MySite | Intro", "mysite__intro"},
+		{"strips a prefix and suffix", Converter{TitleStrip: regexp.MustCompile(`^MySite \| | \| MySite$`)}, "Intro", "intro"},
+		{"leaves the selected title alone", Converter{TitleSelector: "h1", TitleStrip: regexp.MustCompile(`started`)}, "Getting started", "getting_started"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.title, tc.converter.getMetadata(doc, "https://example.com/intro")["title"])
+			assert.Equal(t, tc.filename, tc.converter.getSanitizedTitle(doc, "https://example.com/intro"))
+		})
+	}
+
+	stripped := Converter{TitleStrip: regexp.MustCompile(`.*`)}
+	assert.NotContains(t, stripped.getMetadata(doc, "https://example.com/intro"), "title", "a title stripped to nothing is left out")
+	assert.Equal(t, "intro", stripped.getSanitizedTitle(doc, "https://example.com/intro"))
+}
+
+func TestWriteSitemap(t *testing.T) {
+	retrieved := time.Date(2025, 6, 1, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	results := []Result{
+		{URL: "https://example.com/docs/intro", IsSuccess: true, Retrieved: retrieved},
+		{URL: "https://example.com/docs/gone", Error: "HTTP status 404"},
+		{URL: "https://example.com/search?q=a&page=2", IsSuccess: true, Retrieved: retrieved.Add(time.Minute)},
+		{URL: "https://example.com/docs/same", Skipped: true},
+	}
+	c := &Converter{OutputDir: t.TempDir(), FileMode: 0644}
+	require.NoError(t, c.writeSitemap(results))
+	data, err := os.ReadFile(filepath.Join(c.OutputDir, "sitemap.xml"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"))
+	assert.Contains(t, string(data), "<loc>https://example.com/search?q=a&amp;page=2</loc>", "locations are entity-escaped")
+
+	// The structure of the sitemap protocol's schema: a urlset in its namespace
+	// of url elements, each with an absolute loc and a W3C datetime lastmod
+	var set struct {
+		XMLName xml.Name
+		URLs    []struct {
+			XMLName  xml.Name
+			Loc      string `xml:"loc"`
+			LastMod  string `xml:"lastmod"`
+			Children []struct {
+				XMLName xml.Name
+			} `xml:",any"`
+		} `xml:"url"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &set))
+	assert.Equal(t, xml.Name{Space: "http://www.sitemaps.org/schemas/sitemap/0.9", Local: "urlset"}, set.XMLName)
+	require.Len(t, set.URLs, 2, "only converted pages are listed")
+	for i, expected := range []struct{ loc, lastmod string }{
+		{"https://example.com/docs/intro", "2025-06-01T12:30:00Z"},
+		{"https://example.com/search?q=a&page=2", "2025-06-01T12:31:00Z"},
+	} {
+		entry := set.URLs[i]
+		assert.Equal(t, "http://www.sitemaps.org/schemas/sitemap/0.9", entry.XMLName.Space)
+		assert.Equal(t, expected.loc, entry.Loc)
+		parsed, err := url.Parse(entry.Loc)
+		require.NoError(t, err)
+		assert.True(t, parsed.IsAbs())
+		assert.Less(t, len(entry.Loc), 2048)
+		assert.Equal(t, expected.lastmod, entry.LastMod)
+		_, err = time.Parse(time.RFC3339, entry.LastMod)
+		assert.NoError(t, err)
+		assert.Empty(t, entry.Children, "url holds only loc and lastmod")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.md")
+	require.NoError(t, os.WriteFile(path, []byte("old content"), 0600))
+
+	c := &Converter{FileMode: 0640}
+	require.NoError(t, c.writeFile(path, []byte("new content")))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new content", string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// A rename that cannot happen stands in for a run killed before the file is in place
+	blocked := filepath.Join(dir, "blocked.md")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "child"), 0755))
+	assert.Error(t, c.writeFile(blocked, []byte("never visible")))
+	info, err = os.Stat(blocked)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir(), "the target must not be replaced by a partial file")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"page.md", "blocked.md"}, names, "no temporary files should be left behind")
+}
+
+func TestTimestamp(t *testing.T) {
+	retrieved := time.Date(2025, 8, 10, 18, 58, 20, 0, time.FixedZone("GST", 4*60*60))
+
+	testCases := []struct {
+		format   string
+		utc      bool
+		expected string
+	}{
+		{"", false, "2025-08-10T18:58:20+04:00"},
+		{"rfc3339", true, "2025-08-10T14:58:20Z"},
+		{"ISO8601", false, "2025-08-10T18:58:20+0400"},
+		{"date", false, "2025-08-10"},
+		{"2006-01-02 15:04 MST", true, "2025-08-10 14:58 UTC"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			layout := ""
+			if tc.format != "" {
+				var err error
+				layout, err = TimestampLayout(tc.format)
+				require.NoError(t, err)
+			}
+			c := &Converter{TimestampFormat: layout, UTC: tc.utc}
+			assert.Equal(t, tc.expected, c.timestamp(retrieved))
+		})
+	}
+
+	_, err := TimestampLayout("yesterday")
+	assert.EqualError(t, err, `invalid timestamp format "yesterday"`)
+}
+
+func TestParseByteSize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected int64
+	}{
+		{"1048576", 1 << 20},
+		{"512kb", 512 << 10},
+		{" 5 MB ", 5 << 20},
+		{"8589934591GB", 8589934591 << 30},
+		{"9223372036854775807B", math.MaxInt64},
+	}
+	for _, tc := range testCases {
+		size, err := ParseByteSize(tc.input)
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, size, tc.input)
+	}
+
+	for _, input := range []string{"", "0", "-5MB", "5TB", "ten"} {
+		_, err := ParseByteSize(input)
+		assert.EqualError(t, err, fmt.Sprintf("invalid size %q", input))
+	}
+	for _, input := range []string{"10000000000GB", "8589934592GB", "9223372036854775807KB"} {
+		_, err := ParseByteSize(input)
+		assert.EqualError(t, err, fmt.Sprintf("size %q is too large", input), "the limit must not wrap around")
+	}
+}
+
+func TestExtractContent_SectionHeading(t *testing.T) {
+	doc := loadFixture(t, "sections.html")
+
+	testCases := []struct {
+		name     string
+		pattern  string
+		selector string
+		expected string
+	}{
+		{"case-insensitive text", "(?i)" + regexp.QuoteMeta("installation"), "main",
+			"## Installation\n\nInstall the binary.\n\n### From source\n\nBuild it with go build."},
+		{"regex on the whole page", `^From\s+source$`, "",
+			"### From source\n\nBuild it with go build."},
+		{"stops at a wrapped heading", "Overview", "main",
+			"## Overview\n\nWhat the tool does."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Converter{SectionHeading: regexp.MustCompile(tc.pattern)}
+			content, err := c.extractContent(doc, "https://example.com/guide", tc.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, c.render(content))
+		})
+	}
+
+	c := &Converter{SectionHeading: regexp.MustCompile("Troubleshooting")}
+	_, err := c.extractContent(doc, "https://example.com/guide", "main")
+	assert.ErrorIs(t, err, ErrSelectorNoMatch)
+	assert.ErrorContains(t, err, "no heading matching /Troubleshooting/")
+}
+
+// readZIM parses a ZIM archive as zimArchive writes it, checking its layout,
+// and returns the content of its entries by namespace and path, as "C/a.html".
+// A redirect maps to "-> " and the path of its target.
+func readZIM(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	le := binary.LittleEndian
+	require.GreaterOrEqual(t, len(data), zimHeaderSize+md5.Size)
+	require.Equal(t, uint32(zimMagic), le.Uint32(data))
+	assert.Equal(t, uint16(6), le.Uint16(data[4:]))
+	entryCount := int(le.Uint32(data[24:]))
+	pathPtrPos := le.Uint64(data[32:])
+	titlePtrPos := le.Uint64(data[40:])
+	clusterPtrPos := le.Uint64(data[48:])
+	mainPage := le.Uint32(data[64:])
+	checksumPos := le.Uint64(data[72:])
+	require.Equal(t, uint64(len(data)-md5.Size), checksumPos)
+	sum := md5.Sum(data[:checksumPos])
+	require.Equal(t, sum[:], data[checksumPos:], "checksum")
+
+	cString := func(pos int) (string, int) {
+		end := bytes.IndexByte(data[pos:], 0)
+		require.GreaterOrEqual(t, end, 0)
+		return string(data[pos : pos+end]), pos + end + 1
+	}
+	blob := func(cluster, n uint32) string {
+		pos := le.Uint64(data[clusterPtrPos+8*uint64(cluster):])
+		require.Equal(t, byte(zimUncompressed), data[pos])
+		offsets := data[pos+1:]
+		start, end := le.Uint32(offsets[4*n:]), le.Uint32(offsets[4*n+4:])
+		return string(offsets[start:end])
+	}
+
+	type dirent struct {
+		key, title, value string
+		redirect          int // The index of the target of a redirect, or -1
+	}
+	dirents := make([]dirent, entryCount)
+	paths := make([]string, entryCount)
+	for i := range dirents {
+		pos := int(le.Uint64(data[pathPtrPos+8*uint64(i):]))
+		mime := le.Uint16(data[pos:])
+		namespace := data[pos+3]
+		redirect, value := -1, ""
+		if mime == zimRedirect {
+			redirect = int(le.Uint32(data[pos+8:]))
+			pos += 12
+		} else {
+			value = blob(le.Uint32(data[pos+8:]), le.Uint32(data[pos+12:]))
+			pos += 16
+		}
+		path, next := cString(pos)
+		title, _ := cString(next)
+		paths[i] = string(namespace) + "/" + path
+		dirents[i] = dirent{key: paths[i], title: title, value: value, redirect: redirect}
+		if title == "" {
+			dirents[i].title = path
+		}
+	}
+	assert.True(t, sort.StringsAreSorted(paths), "entries are sorted by path")
+	var titles []string
+	for i := 0; i < entryCount; i++ {
+		d := dirents[le.Uint32(data[titlePtrPos+4*uint64(i):])]
+		titles = append(titles, d.key[:2]+d.title)
+	}
+	assert.True(t, sort.StringsAreSorted(titles), "entries are sorted by title: %v", titles)
+
+	entries := make(map[string]string, entryCount)
+	for _, d := range dirents {
+		if d.redirect >= 0 {
+			d.value = "-> " + paths[d.redirect]
+		}
+		entries[d.key] = d.value
+	}
+	require.Less(t, int(mainPage), entryCount)
+	entries["mainPage"] = paths[mainPage]
+	return entries
+}
+
+func TestConvert_ZIM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/guide":
+			fmt.Fprint(w, `<html><head><title>Guide</title></head><body><main>
+<p>See <a href="/docs/api#auth">the API</a>, <a href="https://example.com/x">elsewhere</a> and <a href="#top">the top</a>.</p>
+<img src="/logo.png" alt="Logo"></main></body></html>`)
+		case "/docs/api":
+			fmt.Fprint(w, `<html><head><title>API</title></head><body><main><p>Back to <a href="../guide">the guide</a>.</p></main></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var archive bytes.Buffer
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, zim: newZIMArchive(&archive, "Test docs")}
+	urls := []string{server.URL + "/guide", server.URL + "/docs/api", server.URL + "/missing"}
+	for _, u := range []string{urls[1], urls[2], urls[0]} {
+		c.convertPage(u, "main")
+	}
+	require.NoError(t, c.zim.close(urls, time.Now()))
+
+	entries := readZIM(t, archive.Bytes())
+	assert.Equal(t, "C/index.html", entries["mainPage"])
+	assert.Equal(t, "-> C/index.html", entries["W/mainPage"])
+	assert.Equal(t, "Test docs", entries["M/Title"])
+	assert.Equal(t, time.Now().Format("2006-01-02"), entries["M/Date"])
+
+	guide, api := entries["C/guide.html"], entries["C/api.html"]
+	require.NotEmpty(t, guide)
+	require.NotEmpty(t, api)
+	assert.Contains(t, guide, "<title>Guide</title>")
+	assert.Contains(t, guide, `<a href="api.html#auth">the API</a>`, "links between archived pages stay in the archive")
+	assert.Contains(t, guide, `<a href="https://example.com/x">elsewhere</a>`)
+	assert.Contains(t, guide, `<a href="#top">the top</a>`)
+	assert.Contains(t, guide, `src="`+server.URL+`/logo.png"`, "images lead to the web")
+	assert.Contains(t, guide, `Source: <a href="`+server.URL+`/guide">`)
+	assert.Contains(t, api, `<a href="guide.html">the guide</a>`)
+
+	index := entries["C/index.html"]
+	assert.Contains(t, index, "<h1>Test docs</h1>")
+	assert.Less(t, strings.Index(index, `<a href="guide.html">Guide</a>`), strings.Index(index, `<a href="api.html">API</a>`), "pages are listed in input order")
+	assert.Greater(t, strings.Index(index, `<a href="guide.html">Guide</a>`), 0)
+	assert.NotContains(t, index, "missing")
+}
+
+func TestRelativeZIMPath(t *testing.T) {
+	assert.Equal(t, "b.html", relativeZIMPath("a.html", "b.html"))
+	assert.Equal(t, "../b.html", relativeZIMPath("x/a.html", "b.html"))
+	assert.Equal(t, "y/b.html", relativeZIMPath("x/a.html", "x/y/b.html"))
+	assert.Equal(t, "../z/b%20c.html", relativeZIMPath("x/a.html", "z/b c.html"))
+}
+
+func TestRender_LinkBase(t *testing.T) {
+	const fetched = "https://mirror.example.net/copy/page"
+	head := map[string]string{
+		"both":      `<base href="https://cdn.example.com/docs/"><link rel="canonical" href="https://example.com/original/page">`,
+		"canonical": `<link rel="canonical" href="/original/page">`,
+		"none":      ``,
+	}
+	body := `<main><p><a href="guide/intro">Intro</a>, <a href="/about">About</a>, <a href="#top">Top</a> and <a href="https://other.example.org/x">Other</a>.</p></main>`
+
+	testCases := []struct {
+		name, base, head, intro, about string
+	}{
+		{"kept as written", LinkBaseNone, "both", "guide/intro", "/about"},
+		{"request", LinkBaseRequest, "both", "https://mirror.example.net/copy/guide/intro", "https://mirror.example.net/about"},
+		{"canonical", LinkBaseCanonical, "both", "https://example.com/original/guide/intro", "https://example.com/about"},
+		{"relative canonical", LinkBaseCanonical, "canonical", "https://mirror.example.net/original/guide/intro", "https://mirror.example.net/about"},
+		{"canonical falls back to the request", LinkBaseCanonical, "none", "https://mirror.example.net/copy/guide/intro", "https://mirror.example.net/about"},
+		{"base href", LinkBaseDocument, "both", "https://cdn.example.com/docs/guide/intro", "https://cdn.example.com/about"},
+		{"base href falls back to the request", LinkBaseDocument, "canonical", "https://mirror.example.net/copy/guide/intro", "https://mirror.example.net/about"},
+		{"auto prefers the base href", LinkBaseAuto, "both", "https://cdn.example.com/docs/guide/intro", "https://cdn.example.com/about"},
+		{"auto then the canonical URL", LinkBaseAuto, "canonical", "https://mirror.example.net/original/guide/intro", "https://mirror.example.net/about"},
+		{"auto then the request", LinkBaseAuto, "none", "https://mirror.example.net/copy/guide/intro", "https://mirror.example.net/about"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + head[tc.head] + "</head><body>" + body + "</body></html>"))
+			require.NoError(t, err)
+			c := &Converter{LinkBase: tc.base, RichMarkdown: true}
+			content, err := c.extractContent(doc, fetched, "main")
+			require.NoError(t, err)
+			expected := fmt.Sprintf("[Intro](%s), [About](%s), [Top](#top) and [Other](https://other.example.org/x).", tc.intro, tc.about)
+			assert.Equal(t, expected, c.renderAt(content, c.linkBase(doc, fetched)))
+		})
+	}
+}
+
+func TestCheckLinks_ValidationFailure(t *testing.T) {
+	c := &Converter{Client: &http.Client{Timeout: time.Second}, OutputDir: t.TempDir(), FileMode: 0644}
+	if _, err := c.isPublicURL("http://doc-converter-test.invalid/x"); err == nil {
+		t.Skip("URL validation is mocked in this build")
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(c.OutputDir, "page.md"), []byte("[Gone](http://doc-converter-test.invalid/x)\n"), 0644))
+
+	report, err := c.CheckLinks([]string{"page.md"})
+	require.NoError(t, err)
+	require.Len(t, report.Broken, 1, "a link that fails validation is reported, not requested")
+	assert.Equal(t, "http://doc-converter-test.invalid/x", report.Broken[0].URL)
+	assert.Contains(t, report.Broken[0].Error, "URL validation failed")
+	assert.Zero(t, report.Skipped)
+}
+
+func TestCheckLink_WithoutCredentials(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Method+" "+r.Header.Get("Authorization"))
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: &http.Client{}}
+	c.UseBearerToken(func() (string, error) { return "secret", nil }, strings.TrimPrefix(server.URL, "http://"))
+	status, err := c.checkLink(server.URL + "/linked")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"HEAD ", "GET "}, authorization, "links are checked without the token, even on an allowed host")
+}
@@ -0,0 +1,16 @@
+package converter
+
+import (
+	"net/http/cookiejar"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// UseCookieJar gives the Converter's client a cookie jar, so cookies a site sets
+// during the run are sent with later requests to it, as a browser would. The
+// jar lives in memory for the lifetime of the Converter.
+func (c *Converter) UseCookieJar() {
+	// The public suffix list keeps a site from setting cookies for a whole TLD
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	c.Client.Jar = jar
+}
@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// credentialHosts are the hosts that the bearer token and Digest credentials
+// of a Converter are sent to: those of the pages it fetches, and those named
+// when the credentials were configured. Redirects to any other host, and the
+// third-party links probed by CheckLinks, go without them.
+type credentialHosts struct {
+	mu    sync.RWMutex
+	hosts map[string]bool // host:port, as pages are fetched from them
+	names map[string]bool // Configured hosts without a port, which match any port
+}
+
+// credentialHosts returns the hosts credentials are sent to, created with the
+// first credentials configured, adding hosts to them.
+func (c *Converter) credentialHosts(hosts []string) *credentialHosts {
+	if c.credentials == nil {
+		c.credentials = &credentialHosts{hosts: make(map[string]bool), names: make(map[string]bool)}
+	}
+	c.credentials.mu.Lock()
+	defer c.credentials.mu.Unlock()
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			c.credentials.hosts[host] = true
+		} else if host != "" {
+			c.credentials.names[strings.Trim(host, "[]")] = true
+		}
+	}
+	return c.credentials
+}
+
+// addPage records the host of the page at rawURL, one of the Converter's
+// input URLs, as one that credentials are sent to. A nil set records nothing.
+func (h *credentialHosts) addPage(rawURL string) {
+	if h == nil {
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	key := hostKey(u)
+	h.mu.RLock()
+	known := h.hosts[key]
+	h.mu.RUnlock()
+	if !known {
+		h.mu.Lock()
+		h.hosts[key] = true
+		h.mu.Unlock()
+	}
+}
+
+// allows reports whether req may carry credentials: it goes to one of the
+// hosts and was not sent withoutCredentials.
+func (h *credentialHosts) allows(req *http.Request) bool {
+	if h == nil || req.Context().Value(noCredentialsKey{}) != nil {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.hosts[hostKey(req.URL)] || h.names[strings.ToLower(req.URL.Hostname())]
+}
+
+// hostKey returns the host of u with its port, the scheme's default when it
+// has none, so that https://example.com and https://example.com:443 match.
+func hostKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(u.Scheme, "https") {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// noCredentialsKey marks the context of requests sent without credentials.
+type noCredentialsKey struct{}
+
+// withoutCredentials returns a context whose requests, and the redirects they
+// follow, carry no bearer token or Digest credentials, whatever their host.
+func withoutCredentials(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCredentialsKey{}, true)
+}
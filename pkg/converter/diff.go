@@ -0,0 +1,386 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const diffContextLines = 3
+
+// PageChange describes how a single source page differs between two runs.
+// A page written in several files, by --split-tokens or --region, is compared
+// file by file, each identified by its region and part alongside the source.
+type PageChange struct {
+	Source string `json:"source"`
+	Region string `json:"region,omitempty"`
+	Part   int    `json:"part,omitempty"`
+	Status string `json:"status"` // "added", "removed" or "changed"
+	FileA  string `json:"fileA,omitempty"`
+	FileB  string `json:"fileB,omitempty"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// RunDiff is the result of comparing two run directories.
+type RunDiff struct {
+	Added     []PageChange `json:"added"`
+	Removed   []PageChange `json:"removed"`
+	Changed   []PageChange `json:"changed"`
+	Unchanged int          `json:"unchanged"`
+}
+
+// Name returns the source of the page, followed by its region and part if it has them.
+func (p PageChange) Name() string {
+	var details []string
+	if p.Region != "" {
+		details = append(details, "region "+p.Region)
+	}
+	if p.Part > 0 {
+		details = append(details, fmt.Sprintf("part %d", p.Part))
+	}
+	if len(details) == 0 {
+		return p.Source
+	}
+	return fmt.Sprintf("%s (%s)", p.Source, strings.Join(details, ", "))
+}
+
+// page is a converted markdown file split into its frontmatter and body.
+type page struct {
+	Path     string
+	Metadata map[string]interface{}
+	Body     string
+	Source   string
+	Region   string
+	Part     int
+}
+
+// key identifies the page among those of a run: its source, region and part,
+// the part zero-padded so that keys sort in part order.
+func (p page) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%08d", p.Source, p.Region, p.Part)
+}
+
+// change returns a PageChange for the page with the given status.
+func (p page) change(status string) PageChange {
+	return PageChange{Source: p.Source, Region: p.Region, Part: p.Part, Status: status}
+}
+
+// DiffRuns compares the markdown bodies of two run directories. Pages are
+// paired by the `source`, `region` and `part` fields of their frontmatter
+// rather than by filename.
+func DiffRuns(dirA, dirB string) (*RunDiff, error) {
+	pagesA, err := loadRunPages(dirA)
+	if err != nil {
+		return nil, err
+	}
+	pagesB, err := loadRunPages(dirB)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RunDiff{}
+	for _, key := range sortedKeys(pagesA) {
+		a := pagesA[key]
+		b, ok := pagesB[key]
+		if !ok {
+			removed := a.change("removed")
+			removed.FileA = a.Path
+			result.Removed = append(result.Removed, removed)
+			continue
+		}
+		if a.Body == b.Body {
+			result.Unchanged++
+			continue
+		}
+		changed := a.change("changed")
+		changed.FileA, changed.FileB = a.Path, b.Path
+		changed.Diff = UnifiedDiff(a.Body, b.Body, a.Path, b.Path)
+		result.Changed = append(result.Changed, changed)
+	}
+	for _, key := range sortedKeys(pagesB) {
+		if _, ok := pagesA[key]; !ok {
+			added := pagesB[key].change("added")
+			added.FileB = pagesB[key].Path
+			result.Added = append(result.Added, added)
+		}
+	}
+	return result, nil
+}
+
+// loadRunPages reads every markdown file under dir and indexes it by page key.
+// Files without a `source` in their frontmatter are ignored.
+func loadRunPages(dir string) (map[string]page, error) {
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		return nil, fmt.Errorf("run directory not found at '%s'", dir)
+	}
+
+	pages := make(map[string]page)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		p, err := readPage(path)
+		if err != nil {
+			return err
+		}
+		if p.Source != "" {
+			pages[p.key()] = p
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run directory %s: %w", dir, err)
+	}
+	return pages, nil
+}
+
+// readPage reads a converted markdown file and splits it into frontmatter and body.
+func readPage(path string) (page, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return page{}, err
+	}
+	metadata, body, err := splitFrontmatter(data)
+	if err != nil {
+		return page{}, fmt.Errorf("failed to parse frontmatter in %s: %w", path, err)
+	}
+	p := page{Path: path, Metadata: metadata, Body: body}
+	p.Source, _ = metadata["source"].(string)
+	p.Region, _ = metadata["region"].(string)
+	p.Part, _ = metadata["part"].(int)
+	return p, nil
+}
+
+// splitFrontmatter separates a leading YAML frontmatter block from the body.
+// Content without frontmatter is returned as the body with nil metadata.
+func splitFrontmatter(data []byte) (map[string]interface{}, string, error) {
+	if !bytes.HasPrefix(data, []byte("---\n")) {
+		return nil, string(data), nil
+	}
+	rest := data[len("---\n"):]
+	end := bytes.Index(rest, []byte("\n---\n"))
+	if end < 0 {
+		return nil, string(data), nil
+	}
+
+	metadata := make(map[string]interface{})
+	if err := yaml.Unmarshal(rest[:end+1], &metadata); err != nil {
+		return nil, "", err
+	}
+	body := strings.TrimLeft(string(rest[end+len("\n---\n"):]), "\n")
+	return metadata, body, nil
+}
+
+// UnifiedDiff returns a line-based unified diff between a and b.
+// An empty string is returned when both inputs are equal.
+func UnifiedDiff(a, b, nameA, nameB string) string {
+	if a == b {
+		return ""
+	}
+	linesA := splitLines(a)
+	linesB := splitLines(b)
+	ops := diffLines(linesA, linesB)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+
+	for start := 0; start < len(ops); {
+		// Skip to the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk until a run of unchanged lines longer than twice the context
+		hunkStart := max(start-diffContextLines, 0)
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContextLines {
+				end = min(end+diffContextLines, len(ops))
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&out, ops[hunkStart:end])
+		start = end
+	}
+	return out.String()
+}
+
+// writeHunk writes a single hunk with its header.
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	lineA, lineB := ops[0].lineA, ops[0].lineB
+	var countA, countB int
+	for _, op := range ops {
+		if op.kind != '+' {
+			countA++
+		}
+		if op.kind != '-' {
+			countB++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(lineA, countA), hunkRange(lineB, countB))
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.text)
+		out.WriteByte('\n')
+	}
+}
+
+// hunkRange formats a hunk range the way diff -u does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffOp is a single line of an edit script. lineA and lineB are the
+// zero-based positions in each input at which the operation applies.
+type diffOp struct {
+	kind  byte // ' ', '-' or '+'
+	text  string
+	lineA int
+	lineB int
+}
+
+// maxDiffEdits caps the edit distance that diffLines searches. The trace it
+// keeps grows with the square of the distance, so more changed lines than this
+// are reported as every line of a removed and every line of b added instead.
+const maxDiffEdits = 1000
+
+// diffLines computes a shortest edit script between a and b using Myers' algorithm.
+// Inputs further apart than maxDiffEdits get the script replacing all of a by b.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int // trace[d] holds diagonals -d..d of v before step d
+
+	done := false
+	for d := 0; d <= maxD && !done; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+	}
+	if !done {
+		return replaceLines(a, b)
+	}
+
+	// Walk the trace backwards to recover the edit script
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prevX, prevY := 0, 0 // Step 0 starts from the beginning of both
+		if d > 0 {
+			vd := trace[d]
+			k := x - y
+			var prevK int
+			if k == -d || (k != d && vd[d+k-1] < vd[d+k+1]) {
+				prevK = k + 1
+			} else {
+				prevK = k - 1
+			}
+			prevX = vd[d+prevK]
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: ' ', text: a[x], lineA: x, lineB: y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{kind: '+', text: b[y], lineA: x, lineB: y})
+		} else {
+			x--
+			ops = append(ops, diffOp{kind: '-', text: a[x], lineA: x, lineB: y})
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceLines returns the edit script removing every line of a, then adding
+// every line of b.
+func replaceLines(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, diffOp{kind: '-', text: line, lineA: i, lineB: 0})
+	}
+	for j, line := range b {
+		ops = append(ops, diffOp{kind: '+', text: line, lineA: len(a), lineB: j})
+	}
+	return ops
+}
+
+// splitLines splits s into lines, ignoring a single trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// sortedKeys returns the keys of m in lexical order.
+func sortedKeys(m map[string]page) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
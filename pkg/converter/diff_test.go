@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "# Title\n\none\n\ntwo\n\nthree"
+	b := "# Title\n\none\n\n2\n\nthree\n\nfour"
+
+	expected := "--- a.md\n+++ b.md\n" +
+		"@@ -2,6 +2,8 @@\n" +
+		" \n one\n \n-two\n+2\n \n three\n+\n+four\n"
+	assert.Equal(t, expected, UnifiedDiff(a, b, "a.md", "b.md"))
+	assert.Empty(t, UnifiedDiff(a, a, "a.md", "b.md"))
+}
+
+func TestDiffRuns_PairsBySource(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+
+	writePage := func(dir, name, source, body string) {
+		content := "---\nsource: " + source + "\n---\n\n" + body
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	writePage(dirA, "same.md", "https://example.com/same", "unchanged")
+	writePage(dirA, "old_name.md", "https://example.com/changed", "before")
+	writePage(dirA, "gone.md", "https://example.com/gone", "bye")
+	writePage(dirB, "same.md", "https://example.com/same", "unchanged")
+	writePage(dirB, "new_name.md", "https://example.com/changed", "after")
+	writePage(dirB, "new.md", "https://example.com/new", "hello")
+
+	result, err := DiffRuns(dirA, dirB)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Unchanged)
+	require.Len(t, result.Added, 1)
+	assert.Equal(t, "https://example.com/new", result.Added[0].Source)
+	require.Len(t, result.Removed, 1)
+	assert.Equal(t, "https://example.com/gone", result.Removed[0].Source)
+	require.Len(t, result.Changed, 1)
+	assert.Equal(t, "https://example.com/changed", result.Changed[0].Source)
+	assert.Contains(t, result.Changed[0].Diff, "-before\n+after\n")
+}
+
+func TestDiffRuns_PairsSplitPagesByPart(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+
+	writePart := func(dir, name, extra, body string) {
+		content := "---\nsource: https://example.com/long\n" + extra + "---\n\n" + body
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	writePart(dirA, "long-part1.md", "part: 1\nparts: 2\n", "first")
+	writePart(dirA, "long-part2.md", "part: 2\nparts: 2\n", "second")
+	writePart(dirA, "long-nav.md", "region: nav\n", "menu")
+	writePart(dirB, "long-part1.md", "part: 1\nparts: 2\n", "first")
+	writePart(dirB, "long-part2.md", "part: 2\nparts: 2\n", "second, edited")
+	writePart(dirB, "long-nav.md", "region: nav\n", "menu")
+
+	result, err := DiffRuns(dirA, dirB)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Unchanged)
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Removed)
+	require.Len(t, result.Changed, 1)
+	assert.Equal(t, 2, result.Changed[0].Part)
+	assert.Equal(t, "https://example.com/long (part 2)", result.Changed[0].Name())
+	assert.Contains(t, result.Changed[0].Diff, "-second\n+second, edited\n")
+}
+
+func TestDiffLines_ReplacesBeyondMaxEdits(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, fmt.Sprintf("a%d", i))
+		b = append(b, fmt.Sprintf("b%d", i))
+	}
+
+	ops := diffLines(a, b)
+	require.Len(t, ops, 2*maxDiffEdits)
+	assert.Equal(t, diffOp{kind: '-', text: "a0", lineA: 0, lineB: 0}, ops[0])
+	assert.Equal(t, diffOp{kind: '+', text: "b0", lineA: maxDiffEdits, lineB: 0}, ops[maxDiffEdits])
+	assert.Equal(t, float64(100), changePercent(strings.Join(a, "\n"), strings.Join(b, "\n")))
+}
@@ -0,0 +1,223 @@
+package converter
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// UseDigestAuth makes the Converter's client answer HTTP Digest challenges
+// (RFC 7616) with the given credentials from the hosts of the pages it fetches
+// and from hosts, given as host or host:port. Credentials are never logged.
+func (c *Converter) UseDigestAuth(username, password string, hosts ...string) {
+	c.Client.Transport = &digestTransport{
+		username:   username,
+		password:   password,
+		hosts:      c.credentialHosts(hosts),
+		next:       transportOrDefault(c.Client.Transport),
+		challenges: make(map[string]*digestChallenge),
+	}
+}
+
+// transportOrDefault returns rt, or http.DefaultTransport when rt is nil.
+func transportOrDefault(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
+
+// digestChallenge is a parsed WWW-Authenticate: Digest challenge.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	count     int // Requests sent with this nonce
+}
+
+// digestTransport retries requests to hosts rejected with a Digest challenge
+// and reuses the challenge for later requests to the same host. Challenges from
+// other hosts, such as those redirected to, are left unanswered.
+type digestTransport struct {
+	username string
+	password string
+	hosts    *credentialHosts
+	next     http.RoundTripper
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge // Keyed by host
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hosts.allows(req) {
+		return t.next.RoundTrip(req)
+	}
+	if auth, ok := t.authorize(req); ok {
+		req = withHeader(req, "Authorization", auth)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, ok := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.mu.Lock()
+	t.challenges[req.URL.Host] = challenge
+	t.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	auth, _ := t.authorize(retry)
+	return t.next.RoundTrip(withHeader(retry, "Authorization", auth))
+}
+
+// authorize builds the Authorization header for req from the cached challenge of its host.
+func (t *digestTransport) authorize(req *http.Request) (string, bool) {
+	t.mu.Lock()
+	challenge, ok := t.challenges[req.URL.Host]
+	if !ok {
+		t.mu.Unlock()
+		return "", false
+	}
+	challenge.count++
+	nc := fmt.Sprintf("%08x", challenge.count)
+	ch := *challenge
+	t.mu.Unlock()
+
+	h := digestHash(ch.algorithm)
+	uri := req.URL.RequestURI()
+	cnonce := randomHex(8)
+
+	ha1 := h(t.username + ":" + ch.realm + ":" + t.password)
+	if strings.HasSuffix(strings.ToLower(ch.algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + ch.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	var response string
+	if ch.qop != "" {
+		response = h(strings.Join([]string{ha1, ch.nonce, nc, cnonce, ch.qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + ch.nonce + ":" + ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, t.username),
+		fmt.Sprintf(`realm="%s"`, ch.realm),
+		fmt.Sprintf(`nonce="%s"`, ch.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if ch.algorithm != "" {
+		fields = append(fields, "algorithm="+ch.algorithm)
+	}
+	if ch.qop != "" {
+		fields = append(fields, "qop="+ch.qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if ch.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, ch.opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), true
+}
+
+// parseDigestChallenge parses a WWW-Authenticate header carrying a Digest challenge.
+func parseDigestChallenge(header string) (*digestChallenge, bool) {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	values := parseAuthParams(params)
+	challenge := &digestChallenge{
+		realm:     values["realm"],
+		nonce:     values["nonce"],
+		opaque:    values["opaque"],
+		algorithm: values["algorithm"],
+	}
+	// Prefer plain "auth" when the server offers a choice of protection levels
+	for _, qop := range strings.Split(values["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			challenge.qop = "auth"
+		}
+	}
+	return challenge, challenge.nonce != ""
+}
+
+// parseAuthParams parses comma-separated key=value pairs whose values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	values := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\`, "")
+			rest = rest[min(end+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		values[key] = value
+		s = rest
+	}
+	return values
+}
+
+// digestHash returns the hex-encoding hash function for a Digest algorithm.
+func digestHash(algorithm string) func(string) string {
+	newHash := md5.New
+	if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+		newHash = sha256.New
+	}
+	return func(s string) string {
+		var h hash.Hash = newHash()
+		io.WriteString(h, s)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+// randomHex returns n random bytes, hex-encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withHeader returns a shallow copy of req with the header set, leaving req untouched
+// as RoundTripper implementations must.
+func withHeader(req *http.Request, key, value string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set(key, value)
+	return clone
+}
@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestServer serves "secret page" only to requests carrying a valid Digest response.
+func digestServer(t *testing.T, username, password string) *httptest.Server {
+	const realm, nonce = "docs", "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scheme, params, _ := strings.Cut(r.Header.Get("Authorization"), " "); scheme == "Digest" {
+			values := parseAuthParams(params)
+			ha1 := md5Hex(username + ":" + realm + ":" + password)
+			ha2 := md5Hex(r.Method + ":" + values["uri"])
+			expected := md5Hex(ha1 + ":" + nonce + ":" + values["nc"] + ":" + values["cnonce"] + ":" + values["qop"] + ":" + ha2)
+			if values["username"] == username && values["response"] == expected {
+				io.WriteString(w, "secret page")
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="`+realm+`", qop="auth,auth-int", nonce="`+nonce+`", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUseDigestAuth(t *testing.T) {
+	server := digestServer(t, "alice", "s3cret")
+
+	testCases := []struct {
+		name     string
+		password string
+		status   int
+	}{
+		{"valid credentials", "s3cret", http.StatusOK},
+		{"wrong password", "wrong", http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Converter{Client: &http.Client{}}
+			c.UseDigestAuth("alice", tc.password, strings.TrimPrefix(server.URL, "http://"))
+
+			// The second request reuses the cached challenge instead of being challenged again
+			for i := 0; i < 2; i++ {
+				resp, err := c.Client.Get(server.URL + "/docs/page?x=1")
+				require.NoError(t, err)
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				assert.Equal(t, tc.status, resp.StatusCode)
+				if tc.status == http.StatusOK {
+					assert.Equal(t, "secret page", string(body))
+				}
+			}
+		})
+	}
+}
+
+func TestUseDigestAuth_OnlyInputHosts(t *testing.T) {
+	protected := digestServer(t, "alice", "s3cret")
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, protected.URL+"/docs/page", http.StatusFound)
+	}))
+	defer site.Close()
+
+	c := &Converter{Client: &http.Client{}}
+	c.UseDigestAuth("alice", "s3cret")
+	resp, err := c.Client.Get(site.URL + "/start")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "a challenge from a host redirected to is not answered")
+
+	c = &Converter{Client: &http.Client{}}
+	c.UseDigestAuth("alice", "s3cret", strings.TrimPrefix(protected.URL, "http://"))
+	resp, err = c.Client.Get(site.URL + "/start")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "hosts can be allowed explicitly")
+}
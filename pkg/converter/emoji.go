@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Emoji styles supported by Converter.EmojiStyle.
+const (
+	EmojiKeep      = "keep"      // Emit emoji as literal Unicode characters (default)
+	EmojiShortcode = "shortcode" // Replace known emoji with their :shortcode: form
+)
+
+// emojiShortcodes maps common emoji to the shortcodes used by GitHub and Slack.
+// Emoji without an entry are left untouched.
+var emojiShortcodes = map[rune]string{
+	'😀': "grinning", '😃': "smiley", '😄': "smile", '😁': "grin", '😆': "laughing",
+	'😅': "sweat_smile", '😂': "joy", '🙂': "slightly_smiling_face", '😉': "wink",
+	'😊': "blush", '😍': "heart_eyes", '😘': "kissing_heart", '😎': "sunglasses",
+	'🤔': "thinking", '😐': "neutral_face", '😑': "expressionless", '🙄': "roll_eyes",
+	'😏': "smirk", '😢': "cry", '😭': "sob", '😡': "rage", '😱': "scream",
+	'😴': "sleeping", '🤯': "exploding_head", '🥳': "partying_face", '🙃': "upside_down_face",
+	'👍': "+1", '👎': "-1", '👏': "clap", '🙌': "raised_hands", '🙏': "pray",
+	'👋': "wave", '💪': "muscle", '👀': "eyes", '🤝': "handshake", '✋': "hand",
+	'❤': "heart", '💔': "broken_heart", '💯': "100", '🔥': "fire", '✨': "sparkles",
+	'⭐': "star", '🌟': "star2", '⚡': "zap", '💡': "bulb", '🎉': "tada",
+	'🚀': "rocket", '✅': "white_check_mark", '❌': "x", '❗': "exclamation",
+	'❓': "question", '⚠': "warning", '🚧': "construction", '🐛': "bug",
+	'🔒': "lock", '🔓': "unlock", '🔑': "key", '🔧': "wrench", '🔨': "hammer",
+	'⚙': "gear", '📦': "package", '📝': "memo", '📚': "books", '📖': "book",
+	'📌': "pushpin", '📎': "paperclip", '🔗': "link", '📈': "chart_with_upwards_trend",
+	'📉': "chart_with_downwards_trend", '🗑': "wastebasket", '💻': "computer",
+	'🖥': "desktop_computer", '📱': "iphone", '☁': "cloud", '🌐': "globe_with_meridians",
+	'🏠': "house", '⏰': "alarm_clock", '⏳': "hourglass_flowing_sand", '✏': "pencil2",
+	'👉': "point_right", '👈': "point_left", '👆': "point_up_2", '👇': "point_down",
+	'🎯': "dart", '🏆': "trophy", '☕': "coffee", '🍺': "beer", '🐳': "whale",
+	'🐧': "penguin", '🐍': "snake", '🦀': "crab", '🐹': "hamster",
+}
+
+// applyEmojiStyle rewrites emoji in s according to style.
+func applyEmojiStyle(s, style string) string {
+	if style != EmojiShortcode {
+		return s
+	}
+
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		code, ok := emojiShortcodes[runes[i]]
+		if !ok {
+			b.WriteRune(runes[i])
+			continue
+		}
+		b.WriteString(":" + code + ":")
+		// Drop the variation selector that often follows emoji presentation
+		if i+1 < len(runes) && runes[i+1] == '\uFE0F' {
+			i++
+		}
+	}
+	return b.String()
+}
+
+// unescapeYAMLRunes restores printable characters outside the Basic Multilingual
+// Plane (such as emoji) that the YAML emitter writes as \UXXXXXXXX escapes inside
+// double-quoted scalars. Escaped backslashes are left untouched.
+func unescapeYAMLRunes(data []byte) []byte {
+	if !bytes.Contains(data, []byte(`\U`)) {
+		return data
+	}
+
+	var out bytes.Buffer
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' || i+1 >= len(data) {
+			out.WriteByte(data[i])
+			continue
+		}
+		if data[i+1] == 'U' && i+10 <= len(data) {
+			if code, err := strconv.ParseUint(string(data[i+2:i+10]), 16, 32); err == nil && unicode.IsPrint(rune(code)) {
+				out.WriteRune(rune(code))
+				i += 9
+				continue
+			}
+		}
+		// Copy the escape pair verbatim so an escaped backslash can't start a new escape
+		out.WriteByte(data[i])
+		out.WriteByte(data[i+1])
+		i++
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Failure categories reported as the Kind of an *Error. Match them with
+// errors.Is on Result.Err, or switch on Error.Kind.
+var (
+	ErrInvalidURL        = errors.New("invalid URL")
+	ErrBlocked           = errors.New("URL blocked")
+	ErrFetch             = errors.New("fetch failed")
+	ErrDNS               = errors.New("host not found")
+	ErrNotModified       = errors.New("not modified")
+	ErrSkipSignal        = errors.New("skip signal found")
+	ErrTimeout           = errors.New("request timed out")
+	ErrTooLarge          = errors.New("response too large")
+	ErrCircuitOpen       = errors.New("host circuit open")
+	ErrNotHTML           = errors.New("not an HTML page")
+	ErrSelectorNoMatch   = errors.New("selector matched nothing")
+	ErrSliceNoMatch      = errors.New("slice start not found")
+	ErrRender            = errors.New("render failed")
+	ErrRenderUnavailable = errors.New("JavaScript renderer unavailable")
+	ErrInvalidMarkdown   = errors.New("invalid markdown")
+	ErrWrite             = errors.New("write failed")
+)
+
+// Error is a failed conversion of a single URL. Its message is the underlying
+// error's, unchanged, so logs stay readable.
+type Error struct {
+	Kind       error  // One of the Err* categories
+	URL        string // The URL being converted
+	StatusCode int    // HTTP status of a non-200 response, otherwise zero
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+// Unwrap makes errors.Is match both the Kind and the underlying error.
+func (e *Error) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// newError returns an *Error of the given kind for the URL u.
+func newError(kind error, u string, err error) *Error {
+	return &Error{Kind: kind, URL: u, Err: err}
+}
+
+// fetchErrorKind classifies an error from requesting or reading a page.
+func fetchErrorKind(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrTooLarge
+	}
+	if isHostNotFound(err) {
+		return ErrDNS
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+	return ErrFetch
+}
+
+// validationErrorKind classifies an error from checking a URL before it is
+// fetched, which includes resolving its host.
+func validationErrorKind(err error) error {
+	if isHostNotFound(err) {
+		return ErrDNS
+	}
+	return ErrInvalidURL
+}
+
+// isHostNotFound reports whether err is a DNS answer that the host does not
+// exist. Resolver timeouts and server failures may pass, so they are not.
+func isHostNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// failure returns the failed Result for u. A page that was not modified, or
+// that asks not to be converted, is skipped rather than failed.
+func failure(u string, err error) Result {
+	return Result{URL: u, Error: err.Error(), Err: err, IsSuccess: false, Skipped: isSkip(err)}
+}
+
+// isSkip reports whether err leaves a page skipped rather than failed.
+func isSkip(err error) bool {
+	return errors.Is(err, ErrNotModified) || errors.Is(err, ErrSkipSignal)
+}
+
+// logFailure logs why the page at u was not converted.
+func (c *Converter) logFailure(u string, err error) {
+	if isSkip(err) {
+		c.logf(u, "INFO: Skipped %s: %v", u, err)
+		return
+	}
+	c.logf(u, "ERROR: Failed to process %s: %v", u, err)
+}
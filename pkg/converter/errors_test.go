@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorKinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/large":
+			w.Write([]byte("<html><body>" + strings.Repeat("x", 2048) + "</body></html>"))
+		}
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: &http.Client{Timeout: 50 * time.Millisecond}, MaxBodySize: 1024}
+
+	testCases := []struct {
+		path       string
+		kind       error
+		statusCode int
+	}{
+		{"/missing", ErrFetch, http.StatusNotFound},
+		{"/slow", ErrTimeout, 0},
+		{"/large", ErrTooLarge, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			_, err := c.fetchDocument(server.URL + tc.path)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tc.kind)
+
+			var convErr *Error
+			require.True(t, errors.As(err, &convErr))
+			assert.Equal(t, tc.kind, convErr.Kind)
+			assert.Equal(t, server.URL+tc.path, convErr.URL)
+			assert.Equal(t, tc.statusCode, convErr.StatusCode)
+		})
+	}
+}
+
+func TestErrorKinds_SelectorNoMatch(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(`<p>text</p>`)))
+	require.NoError(t, err)
+
+	_, err = (&Converter{}).extractContent(doc, "https://example.com", "#missing")
+	assert.ErrorIs(t, err, ErrSelectorNoMatch)
+	assert.Equal(t, "could not find content in https://example.com using selector '#missing'", err.Error(),
+		"the message stays human-readable")
+}
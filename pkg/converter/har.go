@@ -0,0 +1,126 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// HAR holds the HTML pages recorded in a HAR (HTTP Archive) capture, such as
+// one saved from a browser's developer tools.
+type HAR struct {
+	urls  []string                // In the order they were first recorded
+	pages map[string]recordedPage // By request URL
+}
+
+// recordedPage is a captured response: its body as recorded and its type.
+type recordedPage struct {
+	contentType string
+	body        []byte
+}
+
+// harFile is the part of the HAR 1.2 format that is read.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// LoadHAR reads the HAR capture at path. Only successful GET responses with an
+// HTML body are kept; the other entries are counted in skipped. A URL recorded
+// more than once keeps its last response.
+func LoadHAR(path string) (h *HAR, skipped int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read HAR file %s: %w", path, err)
+	}
+	var file harFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse HAR file %s: %w", path, err)
+	}
+
+	h = &HAR{pages: make(map[string]recordedPage)}
+	for i, entry := range file.Log.Entries {
+		content := entry.Response.Content
+		if entry.Request.Method != http.MethodGet || entry.Response.Status != http.StatusOK ||
+			content.MimeType == "" || !isHTMLContentType(content.MimeType) || content.Text == "" {
+			skipped++
+			continue
+		}
+		body := []byte(content.Text)
+		if content.Encoding == "base64" {
+			if body, err = base64.StdEncoding.DecodeString(content.Text); err != nil {
+				return nil, 0, fmt.Errorf("failed to decode the body of entry %d (%s) in %s: %w", i+1, entry.Request.URL, path, err)
+			}
+		}
+		if _, seen := h.pages[entry.Request.URL]; !seen {
+			h.urls = append(h.urls, entry.Request.URL)
+		}
+		h.pages[entry.Request.URL] = recordedPage{contentType: content.MimeType, body: body}
+	}
+	return h, skipped, nil
+}
+
+// URLs returns the URLs of the recorded pages, in capture order.
+func (h *HAR) URLs() []string {
+	return h.urls
+}
+
+// UseHAR makes the Converter read pages from the capture h instead of fetching
+// them: each response is the recorded body, and a URL that was not recorded
+// fails with HTTP status 404. Nothing is requested from the network, so pages
+// are not checked for public addresses either. It replaces the transport, so
+// it must be called before TraceRequests and UseDigestAuth.
+func (c *Converter) UseHAR(h *HAR) {
+	c.Client.Transport = h
+	c.recorded = h
+}
+
+// RoundTrip serves the recorded response for the request's URL.
+func (h *HAR) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	page, ok := h.pages[req.URL.String()]
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Body = http.NoBody
+		return resp, nil
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.Header.Set("Content-Type", page.contentType)
+	resp.Header.Set("Content-Length", strconv.Itoa(len(page.body)))
+	resp.ContentLength = int64(len(page.body))
+	resp.Body = io.NopCloser(bytes.NewReader(page.body))
+	if req.Method == http.MethodHead {
+		resp.Body = http.NoBody
+	}
+	return resp, nil
+}
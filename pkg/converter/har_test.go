@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capture is a HAR of an authenticated session: one HTML page along with a
+// stylesheet, an image and a redirect, none of which are pages.
+const capture = `{"log": {"version": "1.2", "entries": [
+  {"request": {"method": "GET", "url": "https://intranet.example.internal/login"},
+   "response": {"status": 302, "content": {"mimeType": "text/html", "text": ""}}},
+  {"request": {"method": "GET", "url": "https://intranet.example.internal/docs/intro"},
+   "response": {"status": 200, "content": {"mimeType": "text/html; charset=utf-8",
+     "text": "<html><head><title>Intro</title></head><body><nav>Menu</nav><main><h1>Welcome</h1><p>Members only.</p></main></body></html>"}}},
+  {"request": {"method": "GET", "url": "https://intranet.example.internal/site.css"},
+   "response": {"status": 200, "content": {"mimeType": "text/css", "text": "main { color: red; }"}}},
+  {"request": {"method": "GET", "url": "https://intranet.example.internal/logo.png"},
+   "response": {"status": 200, "content": {"mimeType": "image/png", "text": "iVBORw0KGgo=", "encoding": "base64"}}}
+]}}`
+
+func TestConvert_HAR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.har")
+	require.NoError(t, os.WriteFile(path, []byte(capture), 0644))
+	har, skipped, err := LoadHAR(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://intranet.example.internal/docs/intro"}, har.URLs())
+	assert.Equal(t, 3, skipped)
+
+	// The host does not resolve; the page can only come from the capture
+	c := &Converter{Client: &http.Client{Timeout: time.Second}, OutputDir: t.TempDir(), FileMode: 0644, Concurrency: 1}
+	c.UseHAR(har)
+	resultsChan, summaryChan := c.Convert(append(har.URLs(), "https://intranet.example.internal/docs/unrecorded"), "main")
+	var failed []Result
+	for result := range resultsChan {
+		if !result.IsSuccess {
+			failed = append(failed, result)
+		}
+	}
+	summary := <-summaryChan
+	assert.Equal(t, 1, summary.Successful)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "https://intranet.example.internal/docs/unrecorded", failed[0].URL)
+	assert.Contains(t, failed[0].Error, "HTTP status 404")
+
+	data, err := os.ReadFile(filepath.Join(c.OutputDir, "intro.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "source: https://intranet.example.internal/docs/intro")
+	assert.Contains(t, string(data), "# Welcome\n\nMembers only.")
+	assert.NotContains(t, string(data), "Menu")
+}
+
+func TestLoadHAR_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.har")
+	require.NoError(t, os.WriteFile(path, []byte(`{"log": {"entries": [`), 0644))
+	_, _, err := LoadHAR(path)
+	assert.ErrorContains(t, err, "failed to parse HAR file")
+}
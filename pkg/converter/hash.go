@@ -0,0 +1,52 @@
+package converter
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+)
+
+// Algorithms for Converter.ContentHash.
+const (
+	HashNone   = ""       // No content_hash field (default)
+	HashSHA256 = "sha256" // The default when a hash is asked for
+	HashSHA512 = "sha512"
+	HashSHA1   = "sha1"
+	HashMD5    = "md5"
+)
+
+// IsValidHashAlgorithm reports whether algorithm names a supported content hash.
+func IsValidHashAlgorithm(algorithm string) bool {
+	return algorithm == HashNone || newHash(algorithm) != nil
+}
+
+// newHash returns a new hash.Hash for algorithm, or nil when it is not supported.
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case HashSHA256:
+		return sha256.New()
+	case HashSHA512:
+		return sha512.New()
+	case HashSHA1:
+		return sha1.New()
+	case HashMD5:
+		return md5.New()
+	}
+	return nil
+}
+
+// addContentHash adds the content_hash field to metadata when ContentHash is
+// set: the digest of body, the page as written without its frontmatter, with
+// the algorithm as prefix, as in sha256:9f86d0…. The frontmatter is left out
+// because retrieved_at changes on every run.
+func (c *Converter) addContentHash(metadata map[string]interface{}, body string) {
+	h := newHash(c.ContentHash)
+	if h == nil {
+		return
+	}
+	h.Write([]byte(body))
+	metadata["content_hash"] = c.ContentHash + ":" + hex.EncodeToString(h.Sum(nil))
+}
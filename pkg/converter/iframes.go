@@ -0,0 +1,65 @@
+package converter
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// inlineIframes replaces each same-origin <iframe> of the page at u with the
+// content of its source, extracted with selector (or the whole frame body when
+// the selector matches nothing in it), so the content selector and the
+// renderer see it in place. Cross-origin frames are left alone, and frames
+// inside frames are not followed. A frame that cannot be fetched is logged and
+// left in place, which renders as nothing.
+func (c *Converter) inlineIframes(doc *goquery.Document, u string, selector string) {
+	base, err := url.Parse(u)
+	if err != nil {
+		return
+	}
+	doc.Find("iframe[src]").Each(func(_ int, frame *goquery.Selection) {
+		src, _ := frame.Attr("src")
+		ref, err := base.Parse(strings.TrimSpace(src))
+		if err != nil || !sameOrigin(base, ref) {
+			return
+		}
+		ref.Fragment = ""
+		frameURL := ref.String()
+
+		content, err := c.frameContent(frameURL, selector)
+		if err != nil {
+			c.logf(u, "WARNING: Skipping iframe %s in %s: %v", frameURL, u, err)
+			return
+		}
+		frame.ReplaceWithHtml("<div>" + content + "</div>")
+	})
+}
+
+// frameContent fetches the frame at frameURL and extracts its content.
+func (c *Converter) frameContent(frameURL, selector string) (string, error) {
+	if c.recorded == nil { // A recorded frame is not fetched
+		isPublic, err := c.isPublicURL(frameURL)
+		if err != nil {
+			return "", newError(ErrInvalidURL, frameURL, err)
+		}
+		if !isPublic {
+			return "", newError(ErrBlocked, frameURL, errors.New("iframe resolves to a non-public IP"))
+		}
+	}
+	frameDoc, err := c.fetchDocument(frameURL)
+	if err != nil {
+		return "", err
+	}
+	content, err := c.extractContent(frameDoc, frameURL, selector)
+	if errors.Is(err, ErrSelectorNoMatch) {
+		return c.extractContent(frameDoc, frameURL, "")
+	}
+	return content, err
+}
+
+// sameOrigin reports whether a and b share scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
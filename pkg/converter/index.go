@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// indexFileName is the name of the browsable listing written by EmitIndex.
+const indexFileName = "index.html"
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Converted pages</title>
+</head>
+<body>
+<h1>Converted pages</h1>
+<ul>
+{{- range .}}
+<li><a href="{{.Href}}">{{.Title}}</a> <small>({{.Source}})</small></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// indexEntry is a single link in the index page.
+type indexEntry struct {
+	Href   string
+	Title  string
+	Source string
+}
+
+// writeIndex writes index.html into the output directory, linking every
+// successfully converted page in results by its title. Titles are escaped by
+// html/template and links are relative, so the run directory can be moved.
+func (c *Converter) writeIndex(results []Result) error {
+	var entries []indexEntry
+	for _, r := range results {
+		if !r.IsSuccess {
+			continue
+		}
+		title := r.Title
+		if title == "" {
+			title = r.FileName
+		}
+		entries = append(entries, indexEntry{Href: relativeHref(r.FileName), Title: title, Source: r.URL})
+	}
+
+	var buf bytes.Buffer
+	if err := indexTemplate.Execute(&buf, entries); err != nil {
+		return fmt.Errorf("failed to render index: %w", err)
+	}
+	if err := c.writeFile(filepath.Join(c.OutputDir, indexFileName), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// relativeHref turns a path relative to the output directory into a relative URL.
+func relativeHref(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return "./" + strings.Join(segments, "/")
+}
@@ -0,0 +1,38 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelativeHref(t *testing.T) {
+	assert.Equal(t, "./page.md", relativeHref("page.md"))
+	assert.Equal(t, "./example.com/my%20page.md", relativeHref("example.com/my page.md"))
+	assert.Equal(t, "./docs/part%231.md", relativeHref("docs/part#1.md"), "a # does not start a fragment")
+	assert.Equal(t, "./a%3Fb/c%25d.md", relativeHref("a?b/c%d.md"))
+	assert.Equal(t, "./host/page.md", relativeHref(filepath.Join("host", "page.md")))
+}
+
+func TestWriteIndex(t *testing.T) {
+	dir := t.TempDir()
+	c := &Converter{OutputDir: dir}
+	results := []Result{
+		{URL: "https://example.com/a", FileName: "example.com/my page#1.md", Title: "<script>alert(1)</script>", IsSuccess: true},
+		{URL: "https://example.com/b", FileName: "b.md", IsSuccess: true},
+		{URL: "https://example.com/c", FileName: "c.md", Title: "Failed", Error: "boom"},
+	}
+	require.NoError(t, c.writeIndex(results))
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	require.NoError(t, err)
+	index := string(data)
+
+	assert.Contains(t, index, `<a href="./example.com/my%20page%231.md">&lt;script&gt;alert(1)&lt;/script&gt;</a>`)
+	assert.NotContains(t, index, "<script>")
+	assert.Contains(t, index, `<a href="./b.md">b.md</a>`, "a page without a title is listed by its file name")
+	assert.NotContains(t, index, "c.md", "failed pages are not listed")
+}
@@ -0,0 +1,175 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// SelectorCandidate is a suggested content selector for a page.
+type SelectorCandidate struct {
+	Selector   string  `json:"selector"`
+	Score      float64 `json:"score"`
+	TextLength int     `json:"textLength"` // Characters of readable text in the match
+	Sample     string  `json:"sample"`     // The start of that text
+}
+
+const (
+	// sampleLength is the number of characters of text kept in SelectorCandidate.Sample.
+	sampleLength = 120
+	// maxCandidates bounds the elements scored on a very large page.
+	maxCandidates = 500
+)
+
+var (
+	// contentNames and chromeNames match ids and classes that usually mark the
+	// main content, or the navigation and boilerplate around it.
+	contentNames = regexp.MustCompile(`(?i)content|article|post|entry|main|body|text|prose|markdown|doc`)
+	chromeNames  = regexp.MustCompile(`(?i)nav|menu|footer|header|sidebar|comment|banner|breadcrumb|share|social|ad-|related|cookie`)
+)
+
+// Inspect fetches the page at u and returns up to limit candidate content
+// selectors, best first. See SuggestSelectors.
+func (c *Converter) Inspect(u string, limit int) ([]SelectorCandidate, error) {
+	isPublic, err := c.isPublicURL(u)
+	if err != nil {
+		return nil, newError(validationErrorKind(err), u, fmt.Errorf("URL validation failed: %w", err))
+	}
+	if !isPublic {
+		return nil, newError(ErrBlocked, u, fmt.Errorf("SSRF attack suspected: URL resolves to a non-public IP"))
+	}
+	doc, err := c.fetchDocument(u)
+	if err != nil {
+		return nil, err
+	}
+	return SuggestSelectors(doc, limit), nil
+}
+
+// SuggestSelectors ranks the elements of doc that could hold its main content.
+// Elements score by the amount of text outside links, with a bonus for
+// semantic tags (main, article) and content-like class names, and a penalty
+// for navigation-like ones. An element whose text is almost all inside a
+// smaller candidate ranks below it.
+func SuggestSelectors(doc *goquery.Document, limit int) []SelectorCandidate {
+	type scored struct {
+		node *goquery.Selection
+		SelectorCandidate
+	}
+	var candidates []scored
+	doc.Find("main, article, section, div, [role='main']").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		selector := candidateSelector(s)
+		if selector == "" {
+			return true
+		}
+		text := readableText(s, "")
+		length := utf8.RuneCountInString(text)
+		if length == 0 {
+			return true
+		}
+		score := float64(utf8.RuneCountInString(readableText(s, "a"))) * candidateWeight(s)
+
+		sample := text
+		if utf8.RuneCountInString(sample) > sampleLength {
+			sample = string([]rune(sample)[:sampleLength]) + "…"
+		}
+		candidates = append(candidates, scored{s, SelectorCandidate{selector, score, length, sample}})
+		return len(candidates) < maxCandidates
+	})
+
+	// Prefer the innermost element that holds the content over its wrappers
+	for i := range candidates {
+		for j := range candidates {
+			if i != j && containsNode(candidates[i].node, candidates[j].node) &&
+				float64(candidates[j].TextLength) >= 0.9*float64(candidates[i].TextLength) {
+				candidates[i].Score *= 0.8
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+
+	var ranked []SelectorCandidate
+	seen := make(map[string]bool)
+	for _, cand := range candidates {
+		if seen[cand.Selector] || cand.Score <= 0 {
+			continue
+		}
+		seen[cand.Selector] = true
+		cand.Score = float64(int(cand.Score*10)) / 10
+		ranked = append(ranked, cand.SelectorCandidate)
+		if limit > 0 && len(ranked) == limit {
+			break
+		}
+	}
+	return ranked
+}
+
+// containsNode reports whether inner is a descendant of outer.
+func containsNode(outer, inner *goquery.Selection) bool {
+	for p := inner.Get(0).Parent; p != nil; p = p.Parent {
+		if p == outer.Get(0) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateSelector returns a selector for s from its tag, id and classes, or
+// "" for an anonymous <div> or <section> too vague to suggest.
+func candidateSelector(s *goquery.Selection) string {
+	tag := goquery.NodeName(s)
+	if id, _ := s.Attr("id"); id != "" && !strings.ContainsAny(id, " .#:[]") {
+		return tag + "#" + id
+	}
+	class, _ := s.Attr("class")
+	var classes []string
+	for _, name := range strings.Fields(class) {
+		if !strings.ContainsAny(name, ".#:[]/") {
+			classes = append(classes, name)
+		}
+	}
+	if len(classes) > 0 {
+		return tag + "." + strings.Join(classes, ".")
+	}
+	if role, _ := s.Attr("role"); role == "main" {
+		return tag + "[role='main']"
+	}
+	if tag == "main" || tag == "article" {
+		return tag
+	}
+	return ""
+}
+
+// candidateWeight returns the multiplier for the kind of element s is.
+func candidateWeight(s *goquery.Selection) float64 {
+	weight := 1.0
+	tag := goquery.NodeName(s)
+	if role, _ := s.Attr("role"); tag == "main" || tag == "article" || role == "main" {
+		weight *= 1.5
+	}
+	id, _ := s.Attr("id")
+	class, _ := s.Attr("class")
+	names := id + " " + class
+	if chromeNames.MatchString(names) {
+		weight *= 0.3
+	} else if contentNames.MatchString(names) {
+		weight *= 1.25
+	}
+	return weight
+}
+
+// readableText returns the text of s without scripts, styles and navigation,
+// and without the elements matching exclude when it is set.
+func readableText(s *goquery.Selection, exclude string) string {
+	clone := s.Clone()
+	clone.Find(pageChromeSelector).Remove()
+	if exclude != "" {
+		clone.Find(exclude).Remove()
+	}
+	return collapseWhitespace(clone.Text())
+}
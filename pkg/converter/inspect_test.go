@@ -0,0 +1,30 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestSelectors(t *testing.T) {
+	candidates := SuggestSelectors(loadFixture(t, "inspect.html"), 0)
+	require.NotEmpty(t, candidates)
+
+	best := candidates[0]
+	assert.Equal(t, "article.post-content", best.Selector, "the article outranks its wrappers and the page chrome")
+	assert.Contains(t, best.Sample, "Getting started This guide walks through")
+	assert.LessOrEqual(t, len([]rune(best.Sample)), sampleLength+1)
+
+	var selectors []string
+	for i, cand := range candidates {
+		selectors = append(selectors, cand.Selector)
+		if i > 0 {
+			assert.LessOrEqual(t, cand.Score, candidates[i-1].Score, "ranked best first")
+		}
+	}
+	assert.Contains(t, selectors, "div.wrapper")
+	assert.NotContains(t, selectors, "div.sidebar", "link lists score nothing")
+
+	assert.Len(t, SuggestSelectors(loadFixture(t, "inspect.html"), 2), 2)
+}
@@ -0,0 +1,140 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Rendering modes for Converter.Render.
+const (
+	RenderStatic = "static" // Parse the HTML as served (default)
+	RenderJS     = "js"     // Run the page in a headless browser and parse the resulting DOM
+)
+
+const (
+	// renderTimeout bounds a single headless browser run; pages that execute
+	// JavaScript take far longer than httpTimeout allows for a plain fetch.
+	renderTimeout = 30 * time.Second
+
+	// DefaultWaitTimeout is how long WaitFor waits when WaitTimeout is unset.
+	DefaultWaitTimeout = 10 * time.Second
+	// firstWaitBudget is the virtual time granted to the page before the first
+	// check for WaitFor; it doubles with each later check.
+	firstWaitBudget = 500 * time.Millisecond
+)
+
+// browserNames are the executables tried, in order, when BrowserPath is unset.
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless_shell"}
+
+// FindBrowser returns the path of the headless browser used by RenderJS: path
+// itself when set, otherwise the first Chrome or Chromium found in PATH.
+func FindBrowser(path string) (string, error) {
+	if path != "" {
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return "", fmt.Errorf("%w: browser %s not found: %v", ErrRenderUnavailable, path, err)
+		}
+		return resolved, nil
+	}
+	for _, name := range browserNames {
+		if resolved, err := exec.LookPath(name); err == nil {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no Chrome or Chromium found in PATH", ErrRenderUnavailable)
+}
+
+// fetchRendered loads urlStr in a headless browser and returns the serialized
+// DOM once the page has loaded, and once WaitFor matches when it is set. The
+// browser does not report the HTTP status, so error pages are returned like
+// any other.
+func (c *Converter) fetchRendered(urlStr string) ([]byte, *goquery.Document, error) {
+	browser, err := FindBrowser(c.BrowserPath)
+	if err != nil {
+		return nil, nil, newError(ErrRenderUnavailable, urlStr, err)
+	}
+	if c.WaitFor == "" {
+		return c.renderDocument(browser, urlStr, "--dump-dom", urlStr)
+	}
+
+	// Chrome offers no way to wait for an element from the command line, so the
+	// page is rendered again with more virtual time until the element is there.
+	// Virtual time runs the page's timers without waiting for them in real time.
+	timeout := c.WaitTimeout
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for budget := firstWaitBudget; ; budget *= 2 {
+		budget = min(budget, timeout)
+		dom, doc, err := c.renderDocument(browser, urlStr,
+			fmt.Sprintf("--virtual-time-budget=%d", budget.Milliseconds()), "--dump-dom", urlStr)
+		if err != nil || doc.Find(c.WaitFor).Length() > 0 {
+			return dom, doc, err
+		}
+		if budget >= timeout || time.Now().After(deadline) {
+			c.logf(urlStr, "WARNING: %s did not appear in %s within %s; converting the page as it is", c.WaitFor, urlStr, timeout)
+			return dom, doc, nil
+		}
+	}
+}
+
+// renderDocument runs the browser with args and parses the DOM it prints.
+func (c *Converter) renderDocument(browser, urlStr string, args ...string) ([]byte, *goquery.Document, error) {
+	dom, err := c.dumpDOM(browser, urlStr, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(dom))
+	if err != nil {
+		return nil, nil, newError(ErrFetch, urlStr, fmt.Errorf("failed to read rendered HTML for %s: %w", urlStr, err))
+	}
+	return dom, doc, nil
+}
+
+// dumpDOM runs the browser with args and returns what it prints, reading no
+// more than MaxBodySize bytes.
+func (c *Converter) dumpDOM(browser, urlStr string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), renderTimeout)
+	defer cancel()
+
+	flags := []string{"--headless=new", "--disable-gpu"}
+	if c.userAgents != nil {
+		flags = append(flags, "--user-agent="+c.userAgents.pick())
+	}
+	cmd := exec.CommandContext(ctx, browser, append(flags, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, newError(ErrRenderUnavailable, urlStr, fmt.Errorf("failed to start browser for %s: %w", urlStr, err))
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, newError(ErrRenderUnavailable, urlStr, fmt.Errorf("failed to start browser for %s: %w", urlStr, err))
+	}
+
+	dom, readErr := io.ReadAll(io.LimitReader(stdout, c.maxBodySize()+1))
+	if int64(len(dom)) > c.maxBodySize() {
+		cancel() // Stop the browser instead of waiting for the rest of the page
+		cmd.Wait()
+		return nil, newError(ErrTooLarge, urlStr, fmt.Errorf("rendered page %s exceeds %d bytes", urlStr, c.maxBodySize()))
+	}
+	waitErr := cmd.Wait()
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, newError(ErrTimeout, urlStr, fmt.Errorf("rendering %s took longer than %s", urlStr, renderTimeout))
+	case readErr != nil:
+		return nil, newError(ErrFetch, urlStr, fmt.Errorf("failed to read rendered page %s: %w", urlStr, readErr))
+	case waitErr != nil:
+		return nil, newError(ErrFetch, urlStr, fmt.Errorf("browser failed to render %s: %w: %s", urlStr, waitErr, bytes.TrimSpace(stderr.Bytes())))
+	}
+	return dom, nil
+}
@@ -0,0 +1,103 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBrowser writes a shell script standing in for headless Chrome: it prints
+// the given DOM for whatever URL it is asked to dump.
+func fakeBrowser(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fake-chrome")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755))
+	return path
+}
+
+func TestRenderJS_UsesBrowserDOM(t *testing.T) {
+	// The last argument is the URL, as with chrome --dump-dom
+	browser := fakeBrowser(t, `for url; do :; done
+echo "<html><head><title>App</title></head><body><div id=\"root\"><h1>Rendered</h1><p>From $url</p></div></body></html>"
+`)
+	c := &Converter{Render: RenderJS, BrowserPath: browser}
+
+	doc, err := c.fetchDocument("https://example.com/app")
+	require.NoError(t, err)
+	content, err := c.extractContent(doc, "https://example.com/app", "#root")
+	require.NoError(t, err)
+	assert.Equal(t, "# Rendered\n\nFrom https://example.com/app", c.render(content))
+}
+
+func TestRenderJS_BrowserUnavailable(t *testing.T) {
+	c := &Converter{Render: RenderJS, BrowserPath: filepath.Join(t.TempDir(), "missing-chrome")}
+
+	_, err := c.fetchDocument("https://example.com/app")
+	assert.ErrorIs(t, err, ErrRenderUnavailable)
+}
+
+func TestRenderJS_BrowserFails(t *testing.T) {
+	browser := fakeBrowser(t, "echo 'net::ERR_NAME_NOT_RESOLVED' >&2\nexit 1\n")
+	c := &Converter{Render: RenderJS, BrowserPath: browser}
+
+	_, err := c.fetchDocument("https://example.invalid/")
+	assert.ErrorIs(t, err, ErrFetch)
+	assert.ErrorContains(t, err, "ERR_NAME_NOT_RESOLVED")
+}
+
+func TestRenderJS_TooLarge(t *testing.T) {
+	browser := fakeBrowser(t, "head -c 4096 /dev/zero\n")
+	c := &Converter{Render: RenderJS, BrowserPath: browser, MaxBodySize: 1024}
+
+	_, err := c.fetchDocument("https://example.com/huge")
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+// asyncBrowser stands in for Chrome rendering a page whose content appears
+// after 2 seconds of page time: only a virtual time budget of at least 2000ms
+// gets the content. Each run is recorded in the returned log file.
+func asyncBrowser(t *testing.T) (browser, runLog string) {
+	runLog = filepath.Join(t.TempDir(), "runs")
+	browser = fakeBrowser(t, `budget=0
+for arg; do
+  case "$arg" in --virtual-time-budget=*) budget="${arg#*=}";; esac
+done
+echo "$budget" >> "`+runLog+`"
+if [ "$budget" -ge 2000 ]; then
+  echo '<html><body><div id="root"><article><p>Loaded</p></article></div></body></html>'
+else
+  echo '<html><body><div id="root"><p>Loading...</p></div></body></html>'
+fi
+`)
+	return browser, runLog
+}
+
+func TestRenderJS_WaitFor(t *testing.T) {
+	browser, runLog := asyncBrowser(t)
+	c := &Converter{Render: RenderJS, BrowserPath: browser, WaitFor: "article", WaitTimeout: 10 * time.Second}
+
+	doc, err := c.fetchDocument("https://example.com/app")
+	require.NoError(t, err)
+	assert.Equal(t, "Loaded", doc.Find("#root").Text())
+
+	runs, err := os.ReadFile(runLog)
+	require.NoError(t, err)
+	assert.Equal(t, "500\n1000\n2000\n", string(runs), "stops as soon as the element appears")
+}
+
+func TestRenderJS_WaitForTimeout(t *testing.T) {
+	browser, runLog := asyncBrowser(t)
+	c := &Converter{Render: RenderJS, BrowserPath: browser, WaitFor: "article", WaitTimeout: time.Second}
+
+	doc, err := c.fetchDocument("https://example.com/app")
+	require.NoError(t, err, "a timeout converts whatever is present")
+	assert.Equal(t, "Loading...", doc.Find("#root").Text())
+
+	runs, err := os.ReadFile(runLog)
+	require.NoError(t, err)
+	assert.Equal(t, "500\n1000\n", string(runs), "the budget never exceeds the timeout")
+}
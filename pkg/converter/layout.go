@@ -0,0 +1,74 @@
+package converter
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Static site layouts for Converter.Layout.
+const (
+	LayoutFlat   = ""       // Every page a file named after its title (default)
+	LayoutHugo   = "hugo"   // A page bundle per page: <name>/index.md
+	LayoutJekyll = "jekyll" // Posts named by date: _posts/YYYY-MM-DD-<name>.md
+)
+
+// jekyllDateLayout is the date format of Jekyll's frontmatter.
+const jekyllDateLayout = "2006-01-02 15:04:05 -0700"
+
+// IsValidLayout reports whether layout names a supported output layout.
+func IsValidLayout(layout string) bool {
+	switch layout {
+	case LayoutFlat, LayoutHugo, LayoutJekyll:
+		return true
+	}
+	return false
+}
+
+// pageDate returns the publication date of the page in doc, from its
+// article:published_time meta tag, or retrieved when it has none.
+func pageDate(doc *goquery.Document, retrieved time.Time) time.Time {
+	if published, ok := doc.Find("meta[property='article:published_time']").First().Attr("content"); ok {
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(published)); err == nil {
+				return t
+			}
+		}
+	}
+	return retrieved
+}
+
+// addLayoutMetadata adds the frontmatter fields the Layout's site generator
+// expects of a page dated date.
+func (c *Converter) addLayoutMetadata(metadata map[string]interface{}, date time.Time) {
+	if c.UTC {
+		date = date.UTC()
+	}
+	switch c.Layout {
+	case LayoutHugo:
+		metadata["date"] = date.Format(time.RFC3339)
+	case LayoutJekyll:
+		metadata["layout"] = "post"
+		metadata["date"] = date.Format(jekyllDateLayout)
+	}
+}
+
+// layoutFileName returns the path the Layout gives a page that would otherwise
+// be written to name, when it is dated date.
+func (c *Converter) layoutFileName(name string, date time.Time) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	switch c.Layout {
+	case LayoutHugo:
+		return filepath.Join(stem, "index"+ext)
+	case LayoutJekyll:
+		if c.UTC {
+			date = date.UTC()
+		}
+		// Jekyll reads the title part of the name as the slug, words joined by hyphens
+		return filepath.Join("_posts", date.Format("2006-01-02")+"-"+strings.ReplaceAll(stem, "_", "-")+ext)
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Bases for Converter.LinkBase, the URL that relative links are resolved against.
+const (
+	LinkBaseNone      = ""          // Relative links are written as they are (default)
+	LinkBaseAuto      = "auto"      // <base href>, else the canonical URL, else the request URL
+	LinkBaseRequest   = "request"   // The URL the page was fetched from
+	LinkBaseCanonical = "canonical" // The <link rel="canonical"> URL, else the request URL
+	LinkBaseDocument  = "base"      // The <base href> URL, else the request URL
+)
+
+// IsValidLinkBase reports whether base names a supported link base.
+func IsValidLinkBase(base string) bool {
+	switch base {
+	case LinkBaseNone, LinkBaseAuto, LinkBaseRequest, LinkBaseCanonical, LinkBaseDocument:
+		return true
+	}
+	return false
+}
+
+// linkBase returns the URL that the relative links of doc, fetched from u,
+// resolve against under LinkBase, or nil when they are kept as written. The
+// <base href> and canonical URLs may be relative themselves, to u.
+func (c *Converter) linkBase(doc *goquery.Document, u string) *url.URL {
+	if c.LinkBase == LinkBaseNone {
+		return nil
+	}
+	request, err := url.Parse(u)
+	if err != nil {
+		return nil
+	}
+	declared := func(selector, attr string) *url.URL {
+		href := strings.TrimSpace(doc.Find(selector).First().AttrOr(attr, ""))
+		if href == "" {
+			return nil
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return nil
+		}
+		return request.ResolveReference(ref)
+	}
+	var candidates []func() *url.URL
+	document := func() *url.URL { return declared("base[href]", "href") }
+	canonical := func() *url.URL { return declared("link[rel='canonical'][href]", "href") }
+	switch c.LinkBase {
+	case LinkBaseAuto:
+		candidates = append(candidates, document, canonical)
+	case LinkBaseCanonical:
+		candidates = append(candidates, canonical)
+	case LinkBaseDocument:
+		candidates = append(candidates, document)
+	}
+	for _, candidate := range candidates {
+		if base := candidate(); base != nil {
+			return base
+		}
+	}
+	return request
+}
+
+// resolvingRenderer writes links resolved against base. Links to a fragment
+// of the page itself are kept, as the fragment is in the output too.
+type resolvingRenderer struct {
+	renderer
+	base *url.URL
+}
+
+func (r resolvingRenderer) link(text, href string) string {
+	if ref, err := url.Parse(strings.TrimSpace(href)); err == nil && !strings.HasPrefix(href, "#") {
+		href = r.base.ResolveReference(ref).String()
+	}
+	return r.renderer.link(text, href)
+}
@@ -0,0 +1,155 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// LinkReportFileName is the name of the report written by WriteLinkReport.
+const LinkReportFileName = "link-report.json"
+
+// linkPatterns find the absolute link targets in each output format. The
+// metadata headers hold the source URL as plain text, so it is not matched.
+var linkPatterns = map[string]*regexp.Regexp{
+	FormatMarkdown: regexp.MustCompile(`\]\((https?://[^)\s]+)\)`),
+	FormatAsciiDoc: regexp.MustCompile(`link:(https?://[^\[\s]+)\[`),
+	FormatRST:      regexp.MustCompile("<(https?://[^>\\s]+)>`__"),
+}
+
+// rawLinkPattern finds absolute links in pages saved with FetchOnly.
+var rawLinkPattern = regexp.MustCompile(`href=["'](https?://[^"'\s]+)["']`)
+
+// BrokenLink is a link in an output file that did not resolve.
+type BrokenLink struct {
+	URL        string   `json:"url"`
+	Files      []string `json:"files"`                // Output files containing the link
+	StatusCode int      `json:"statusCode,omitempty"` // Zero when the request itself failed
+	Error      string   `json:"error"`
+}
+
+// LinkReport is the outcome of CheckLinks.
+type LinkReport struct {
+	Checked int          `json:"checked"`
+	Skipped int          `json:"skipped"` // Links to private addresses, never requested
+	Broken  []BrokenLink `json:"broken"`
+}
+
+// CheckLinks requests every distinct absolute link found in the given output
+// files, at most Concurrency at a time, and reports those that fail or answer
+// with an error status. Each link is checked with HEAD, falling back to GET
+// for servers that reject HEAD.
+func (c *Converter) CheckLinks(fileNames []string) (*LinkReport, error) {
+	pattern := linkPatterns[c.Format]
+	if pattern == nil {
+		pattern = linkPatterns[FormatMarkdown]
+	}
+	if c.FetchOnly {
+		pattern = rawLinkPattern
+	}
+
+	var links []string
+	files := make(map[string][]string) // Output files by link
+	for _, name := range fileNames {
+		data, err := os.ReadFile(filepath.Join(c.OutputDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s for link checking: %w", name, err)
+		}
+		for _, match := range pattern.FindAllStringSubmatch(string(data), -1) {
+			link := match[1]
+			if _, seen := files[link]; !seen {
+				links = append(links, link)
+			}
+			if f := files[link]; len(f) == 0 || f[len(f)-1] != name {
+				files[link] = append(f, name)
+			}
+		}
+	}
+
+	report := &LinkReport{Broken: []BrokenLink{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for i := 0; i < c.concurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range jobs {
+				// A link that cannot be validated is never requested either
+				isPublic, err := c.isPublicURL(link)
+				if err == nil && !isPublic {
+					mu.Lock()
+					report.Skipped++
+					mu.Unlock()
+					continue
+				}
+				status := 0
+				if err != nil {
+					err = fmt.Errorf("URL validation failed: %w", err)
+				} else {
+					status, err = c.checkLink(link)
+				}
+
+				mu.Lock()
+				report.Checked++
+				if err != nil {
+					report.Broken = append(report.Broken, BrokenLink{URL: link, Files: files[link], Error: err.Error()})
+				} else if status >= 400 {
+					report.Broken = append(report.Broken, BrokenLink{URL: link, Files: files[link], StatusCode: status, Error: http.StatusText(status)})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, link := range links {
+		jobs <- link
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(report.Broken, func(i, j int) bool { return report.Broken[i].URL < report.Broken[j].URL })
+	return report, nil
+}
+
+// checkLink returns the final HTTP status of link. Links lead to third
+// parties, so they are requested without the bearer token or Digest
+// credentials, whatever their host.
+func (c *Converter) checkLink(link string) (int, error) {
+	status, err := c.probeLink(http.MethodHead, link)
+	if err != nil || (status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented) {
+		return status, err
+	}
+	return c.probeLink(http.MethodGet, link)
+}
+
+// probeLink sends a method request for link without credentials and returns its status.
+func (c *Converter) probeLink(method, link string) (int, error) {
+	req, err := http.NewRequestWithContext(withoutCredentials(context.Background()), method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// WriteLinkReport writes report into the output directory as link-report.json.
+func (c *Converter) WriteLinkReport(report *LinkReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode link report: %w", err)
+	}
+	if err := c.writeFile(filepath.Join(c.OutputDir, LinkReportFileName), append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write link report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// listBlock is one rendered block of a list item. nested marks a list nested
+// in the item, which renderers attach to the item more tightly than a paragraph.
+type listBlock struct {
+	text   string
+	nested bool
+}
+
+// blockElements are the elements that end a run of inline content in a list
+// item or a table cell.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true,
+	"div": true, "dl": true, "figure": true, "footer": true, "form": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "ul": true,
+}
+
+// renderList renders the <ul> or <ol> list, the depth-th list it is nested in
+// counting itself, with r. A list without items renders as "".
+func renderList(list *goquery.Selection, r renderer, depth int) string {
+	var items [][]listBlock
+	list.ChildrenFiltered("li").Each(func(_ int, li *goquery.Selection) {
+		items = append(items, itemBlocks(li, r, depth))
+	})
+	if len(items) == 0 {
+		return ""
+	}
+	return r.list(items, goquery.NodeName(list) == "ol", depth)
+}
+
+// itemBlocks renders the content of the list item li: runs of inline content
+// as paragraphs, nested lists, and the blocks of its other block elements.
+func itemBlocks(li *goquery.Selection, r renderer, depth int) []listBlock {
+	var blocks []listBlock
+	var run []*html.Node
+	flush := func() {
+		if text := inlineText(&goquery.Selection{Nodes: run}, r); text != "" {
+			blocks = append(blocks, listBlock{text: r.paragraph(text)})
+		}
+		run = nil
+	}
+	li.Contents().Each(func(_ int, child *goquery.Selection) {
+		n := child.Get(0)
+		if n.Type != html.ElementNode || !blockElements[n.Data] {
+			run = append(run, n)
+			return
+		}
+		flush()
+		if n.Data == "ul" || n.Data == "ol" {
+			if list := renderList(child, r, depth+1); list != "" {
+				blocks = append(blocks, listBlock{text: list, nested: true})
+			}
+			return
+		}
+		var rendered []string
+		walkBlock(child, r, &rendered, depth)
+		for _, text := range rendered {
+			blocks = append(blocks, listBlock{text: text})
+		}
+	})
+	flush()
+	return blocks
+}
+
+// renderTable renders the rows of the <table>, not those of tables nested in
+// its cells, with r. The first row is the header, as Markdown tables need one.
+// A table without cells renders as "".
+func renderTable(table *goquery.Selection, r renderer) string {
+	var rows [][][]string
+	table.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+		if tr.Closest("table").Get(0) != table.Get(0) {
+			return
+		}
+		var row [][]string
+		tr.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+			row = append(row, cellLines(cell, r, 0))
+		})
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+	return r.table(rows)
+}
+
+// cellLines renders the content of a table cell, or of an element in one, as
+// lines of inline text, since a cell holds no blocks: paragraphs and <br>
+// separate lines, each list item is a line of its own with a marker, and a
+// nested table gives a line per row. depth is the number of lists the content
+// is nested in.
+func cellLines(s *goquery.Selection, r renderer, depth int) []string {
+	var lines []string
+	var run []*html.Node
+	flush := func() {
+		if text := inlineText(&goquery.Selection{Nodes: run}, r); text != "" {
+			lines = append(lines, text)
+		}
+		run = nil
+	}
+	s.Contents().Each(func(_ int, child *goquery.Selection) {
+		n := child.Get(0)
+		switch {
+		case n.Type == html.ElementNode && n.Data == "br":
+			flush()
+		case n.Type != html.ElementNode || !blockElements[n.Data]:
+			run = append(run, n)
+		case n.Data == "ul" || n.Data == "ol":
+			flush()
+			child.ChildrenFiltered("li").Each(func(i int, li *goquery.Selection) {
+				marker := "• "
+				if n.Data == "ol" {
+					marker = fmt.Sprintf("%d. ", i+1)
+				} else if depth > 0 {
+					marker = "◦ "
+				}
+				item := cellLines(li, r, depth+1)
+				if len(item) == 0 {
+					return
+				}
+				item[0] = strings.Repeat("  ", depth) + marker + item[0]
+				lines = append(lines, item...)
+			})
+		case n.Data == "table":
+			flush()
+			child.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+				if tr.Closest("table").Get(0) != n {
+					return
+				}
+				var cells []string
+				tr.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+					if text := strings.Join(cellLines(cell, r, depth), " "); text != "" {
+						cells = append(cells, text)
+					}
+				})
+				if len(cells) > 0 {
+					lines = append(lines, strings.Join(cells, "; "))
+				}
+			})
+		case n.Data == "pre":
+			flush()
+			if code := collapseWhitespace(preText(child)); code != "" {
+				lines = append(lines, r.code(code))
+			}
+		default:
+			flush()
+			lines = append(lines, cellLines(child, r, depth)...)
+		}
+	})
+	flush()
+	return lines
+}
+
+// tableWidth returns the number of columns of rows, that of its longest row.
+func tableWidth(rows [][][]string) int {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	return width
+}
+
+// indentedItem renders a list item as its marker and its blocks, the lines
+// after the first indented to the width of the marker so that they stay in the
+// item. Nested lists follow the block before them after nestedSep, other
+// blocks after a blank line.
+func indentedItem(marker string, blocks []listBlock, nestedSep string) string {
+	if len(blocks) == 0 {
+		return strings.TrimSpace(marker)
+	}
+	var b strings.Builder
+	for i, block := range blocks {
+		switch {
+		case i == 0:
+		case block.nested:
+			b.WriteString(nestedSep)
+		default:
+			b.WriteString("\n\n")
+		}
+		b.WriteString(block.text)
+	}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(marker))
+	lines := strings.Split(b.String(), "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return marker + strings.Join(lines, "\n")
+}
+
+// listMarker returns the marker of item i of a list: "-", or its number.
+func listMarker(i int, ordered bool) string {
+	if ordered {
+		return fmt.Sprintf("%d. ", i+1)
+	}
+	return "- "
+}
+
+func (markdownRenderer) list(items [][]listBlock, ordered bool, _ int) string {
+	// The list is tight, its items one line apart, unless an item holds more
+	// than one paragraph
+	separator := "\n"
+	rendered := make([]string, len(items))
+	for i, item := range items {
+		for _, block := range item[min(1, len(item)):] {
+			if !block.nested {
+				separator = "\n\n"
+			}
+		}
+		rendered[i] = indentedItem(listMarker(i, ordered), item, "\n")
+	}
+	return strings.Join(rendered, separator)
+}
+
+func (markdownRenderer) table(rows [][][]string) string {
+	width := tableWidth(rows)
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		cells := make([]string, width)
+		for j := range row {
+			// A cell is one line: its lines are joined with HTML line breaks
+			cells[j] = strings.ReplaceAll(strings.Join(row[j], "<br>"), "|", `\|`)
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (asciidocRenderer) list(items [][]listBlock, ordered bool, depth int) string {
+	// AsciiDoc nests lists by the length of the marker, not by indentation
+	marker := strings.Repeat("*", depth)
+	if ordered {
+		marker = strings.Repeat(".", depth)
+	}
+	rendered := make([]string, len(items))
+	for i, item := range items {
+		var b strings.Builder
+		b.WriteString(marker)
+		for j, block := range item {
+			switch {
+			case j == 0:
+				b.WriteString(" ")
+			case block.nested:
+				b.WriteString("\n")
+			default:
+				// A list continuation attaches the block to the item
+				b.WriteString("\n+\n")
+			}
+			b.WriteString(block.text)
+		}
+		rendered[i] = b.String()
+	}
+	return strings.Join(rendered, "\n")
+}
+
+func (asciidocRenderer) table(rows [][][]string) string {
+	width := tableWidth(rows)
+	lines := []string{fmt.Sprintf(`[%%header,cols="%d*"]`, width), "|==="}
+	for _, row := range rows {
+		cells := make([]string, width)
+		for j := range row {
+			cells[j] = strings.ReplaceAll(strings.Join(row[j], " +\n"), "|", `\|`)
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | "))
+	}
+	return strings.Join(append(lines, "|==="), "\n")
+}
+
+func (rstRenderer) list(items [][]listBlock, ordered bool, _ int) string {
+	// Nested lists, like paragraphs, need blank lines around them, and so a
+	// blank line between the items
+	separator := "\n"
+	rendered := make([]string, len(items))
+	for i, item := range items {
+		if len(item) > 1 {
+			separator = "\n\n"
+		}
+		rendered[i] = indentedItem(listMarker(i, ordered), item, "\n\n")
+	}
+	return strings.Join(rendered, separator)
+}
+
+func (rstRenderer) table(rows [][][]string) string {
+	// A list table, since the cells of grid tables must be drawn to width
+	width := tableWidth(rows)
+	var b strings.Builder
+	b.WriteString(".. list-table::\n   :header-rows: 1\n")
+	for i, row := range rows {
+		if i == 0 {
+			b.WriteString("\n")
+		}
+		for j := 0; j < width; j++ {
+			prefix := "     - "
+			if j == 0 {
+				prefix = "   * - "
+			}
+			var cell []string
+			if j < len(row) {
+				cell = row[j]
+			}
+			switch len(cell) {
+			case 0:
+				b.WriteString(strings.TrimRight(prefix, " ") + "\n")
+			case 1:
+				b.WriteString(prefix + cell[0] + "\n")
+			default:
+				// A line block keeps the lines of the cell apart
+				for k, line := range cell {
+					if k > 0 {
+						prefix = "       "
+					}
+					b.WriteString(prefix + "| " + line + "\n")
+				}
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
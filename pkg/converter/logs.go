@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Levels of a LogEntry.
+const (
+	LogDebug   = "debug"
+	LogInfo    = "info"
+	LogWarning = "warn"
+	LogError   = "error"
+)
+
+// logPrefixes maps the prefixes of log lines to their level.
+var logPrefixes = map[string]string{
+	"DEBUG":   LogDebug,
+	"INFO":    LogInfo,
+	"WARNING": LogWarning,
+	"ERROR":   LogError,
+}
+
+// LogEntry is a line logged about one page of a run.
+type LogEntry struct {
+	Level   string `json:"level"`         // LogDebug, LogInfo, LogWarning or LogError
+	Message string `json:"message"`       // The line without its level prefix
+	URL     string `json:"url,omitempty"` // The page it is about
+}
+
+// logf logs a line about the page at u, like log.Printf with a level prefix
+// such as "WARNING: ", and passes it to OnLog when set.
+func (c *Converter) logf(u string, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	log.Print(line)
+	if c.OnLog == nil {
+		return
+	}
+	entry := LogEntry{Level: LogInfo, Message: line, URL: u}
+	if prefix, message, ok := strings.Cut(line, ": "); ok {
+		if level, known := logPrefixes[prefix]; known {
+			entry.Level, entry.Message = level, message
+		}
+	}
+	c.OnLog(entry)
+}
@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// ManifestFileName is the name of the run record written when Manifest is set.
+const ManifestFileName = "manifest.json"
+
+// Manifest records how a run was made and the outcome of every URL, so that a
+// later command can pick the run up again, e.g. to retry its failures.
+type Manifest struct {
+	Selector       string            `json:"selector"`
+	SelectorRules  []SelectorRule    `json:"selectorRules,omitempty"`
+	SelectorIndex  int               `json:"selectorIndex,omitempty"`
+	SelectorAttr   string            `json:"selectorAttr,omitempty"`
+	SectionHeading string            `json:"sectionHeading,omitempty"` // The --contains-heading text as a pattern, quoted unless given with --heading-regex
+	Regions        []Region          `json:"regions,omitempty"`
+	Format         string            `json:"format,omitempty"`
+	RichMarkdown   bool              `json:"richMarkdown,omitempty"`
+	InputFormat    string            `json:"inputFormat,omitempty"`
+	XMLElements    map[string]string `json:"xmlElements,omitempty"`
+	FetchOnly      bool              `json:"fetchOnly,omitempty"`
+	Combined       bool              `json:"combinedByHost,omitempty"`
+	Shard          string            `json:"shard,omitempty"` // Result file names then include their shard directory
+	Layout         string            `json:"layout,omitempty"`
+	SplitTokens    int               `json:"splitTokens,omitempty"`
+	Summary        Summary           `json:"summary"`
+	Results        []Result          `json:"results"`
+}
+
+// ReadManifest reads the manifest of the run in runDir.
+func ReadManifest(runDir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, ManifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", filepath.Join(runDir, ManifestFileName), err)
+	}
+	return &m, nil
+}
+
+// WriteManifest writes m into runDir, replacing any previous manifest. An
+// existing manifest keeps its permissions.
+func WriteManifest(runDir string, m *Manifest) error {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(runDir, ManifestFileName)
+	mode := DefaultFileMode
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := writeFileAtomic(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// writeManifest writes m into the output directory with the Converter's FileMode.
+func (c *Converter) writeManifest(m *Manifest) error {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+	if err := c.writeFile(filepath.Join(c.OutputDir, ManifestFileName), data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// encodeManifest renders m as indented JSON.
+func encodeManifest(m *Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Merge replaces the results of the URLs in retried with their newer outcome
+// and recomputes the summary counts. ProcessingTime is left as recorded.
+func (m *Manifest) Merge(retried []Result) {
+	latest := make(map[string]Result, len(retried))
+	for _, r := range retried {
+		latest[r.URL] = r
+	}
+	for i, r := range m.Results {
+		if newer, ok := latest[r.URL]; ok {
+			m.Results[i] = newer
+		}
+	}
+
+	m.Summary.Successful, m.Summary.Failed, m.Summary.Skipped, m.Summary.FailedURLs = 0, 0, 0, nil
+	for _, r := range m.Results {
+		if r.IsSuccess {
+			m.Summary.Successful++
+		} else if r.Skipped {
+			m.Summary.Skipped++
+		} else {
+			m.Summary.Failed++
+			m.Summary.FailedURLs = append(m.Summary.FailedURLs, r.URL)
+		}
+	}
+}
+
+// sectionPattern returns the pattern of re, empty when it is nil.
+func sectionPattern(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return re.String()
+}
@@ -0,0 +1,351 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MarkdownProblem is a construct in rendered Markdown that CheckMarkdown
+// expects a CommonMark parser not to read back as it was written.
+type MarkdownProblem struct {
+	Line    int // 1-based, in the checked text
+	Message string
+}
+
+func (p MarkdownProblem) String() string { return fmt.Sprintf("line %d: %s", p.Line, p.Message) }
+
+// tableDelimiterRow matches the row below a table header, e.g. "|---|:-:|".
+var tableDelimiterRow = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+
+// CheckMarkdown is a heuristic lint, not a CommonMark parser. It splits text
+// into code fences, indented code, headings, pipe tables and paragraphs, and
+// applies CommonMark's delimiter rules within them to report what does not
+// balance: code fences left open, emphasis delimiters without a partner, link
+// destinations without a closing parenthesis and table rows that do not fit
+// the header. A leading YAML frontmatter block is skipped.
+//
+// It does not catch problems in what it does not model: HTML blocks and
+// inline HTML, setext heading underlines, lists and block quotes (their lines
+// are read as paragraphs), reference links and definitions, autolinks, entity
+// references, and tables whose rows do not start with a pipe.
+func CheckMarkdown(text string) []MarkdownProblem {
+	lines := strings.Split(text, "\n")
+	var problems []MarkdownProblem
+	start := 0
+	if len(lines) > 0 && lines[0] == "---" {
+		for i := 1; i < len(lines); i++ {
+			if lines[i] == "---" {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	var para []string // The lines of the paragraph being read
+	paraLine := 0
+	flush := func() {
+		if len(para) > 0 {
+			problems = append(problems, checkInlines(para, paraLine)...)
+		}
+		para = nil
+	}
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if fence, ok := codeFence(trimmed); ok && indent < 4 {
+			flush()
+			closed := false
+			for j := i + 1; j < len(lines); j++ {
+				if closing, ok := codeFence(strings.TrimLeft(lines[j], " ")); ok && closing[0] == fence[0] && len(closing) >= len(fence) &&
+					strings.TrimSpace(strings.TrimLeft(lines[j], " ")[len(closing):]) == "" {
+					i, closed = j, true
+					break
+				}
+			}
+			if !closed {
+				problems = append(problems, MarkdownProblem{Line: i + 1, Message: fmt.Sprintf("code fence %s is never closed", fence)})
+				return problems
+			}
+			continue
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case indent >= 4 && len(para) == 0:
+			// An indented code block
+		case strings.HasPrefix(trimmed, "|"):
+			flush()
+			j := i
+			for j < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[j]), "|") {
+				j++
+			}
+			problems = append(problems, checkTable(lines[i:j], i+1)...)
+			i = j - 1
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			problems = append(problems, checkInlines([]string{strings.TrimLeft(trimmed, "#")}, i+1)...)
+		default:
+			if len(para) == 0 {
+				paraLine = i + 1
+			}
+			para = append(para, line)
+		}
+	}
+	flush()
+	return problems
+}
+
+// codeFence returns the fence that opens a code block on line, a run of three
+// or more backticks or tildes.
+func codeFence(line string) (string, bool) {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return "", false
+	}
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 || (line[0] == '`' && strings.Contains(line[n:], "`")) {
+		return "", false
+	}
+	return line[:n], true
+}
+
+// checkTable checks that the rows of a table, starting at line first, have a
+// delimiter row and as many cells as the header.
+func checkTable(rows []string, first int) []MarkdownProblem {
+	if len(rows) < 2 || !tableDelimiterRow.MatchString(strings.TrimSpace(rows[1])) {
+		return []MarkdownProblem{{Line: first, Message: "table has no delimiter row below its header"}}
+	}
+	var problems []MarkdownProblem
+	header := tableCells(rows[0])
+	for i, row := range rows {
+		if cells := tableCells(row); cells != header {
+			problems = append(problems, MarkdownProblem{Line: first + i, Message: fmt.Sprintf("table row has %d cells, the header has %d", cells, header)})
+		}
+	}
+	return problems
+}
+
+// tableCells counts the cells of a table row, not counting escaped pipes or
+// pipes in code spans.
+func tableCells(row string) int {
+	row = strings.TrimSpace(maskCode(maskEscapes(row)))
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	return strings.Count(row, "|") + 1
+}
+
+// asciiPunctuation are the characters a backslash escapes.
+const asciiPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// maskEscapes replaces each backslash escape with two letters; escaped
+// characters are literal, and letters neither delimit nor flank.
+func maskEscapes(s string) string {
+	b := []byte(s)
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] == '\\' && strings.IndexByte(asciiPunctuation, b[i+1]) >= 0 {
+			b[i], b[i+1] = 'x', 'x'
+			i++
+		}
+	}
+	return string(b)
+}
+
+// maskCode replaces the content and backticks of code spans with letters, so
+// that what they hold is not read as markup. A backtick run without a closing
+// run of the same length is literal, as in CommonMark.
+func maskCode(s string) string {
+	b := []byte(s)
+	for i := 0; i < len(b); {
+		if b[i] != '`' {
+			i++
+			continue
+		}
+		n := 0
+		for i+n < len(b) && b[i+n] == '`' {
+			n++
+		}
+		end := -1
+		for j := i + n; j < len(b); {
+			if b[j] != '`' {
+				j++
+				continue
+			}
+			m := 0
+			for j+m < len(b) && b[j+m] == '`' {
+				m++
+			}
+			if m == n {
+				end = j + m
+				break
+			}
+			j += m
+		}
+		if end < 0 {
+			i += n
+			continue
+		}
+		for k := i; k < end; k++ {
+			if b[k] != '\n' {
+				b[k] = 'x'
+			}
+		}
+		i = end
+	}
+	return string(b)
+}
+
+// delimiterRun is a run of * or _ in a paragraph that may open or close emphasis.
+type delimiterRun struct {
+	char      byte
+	pos       int
+	length    int
+	remaining int
+	canOpen   bool
+	canClose  bool
+}
+
+// checkInlines checks the emphasis and links of a paragraph whose lines start
+// at line first.
+func checkInlines(lines []string, first int) []MarkdownProblem {
+	b := []byte(maskCode(maskEscapes(strings.Join(lines, "\n"))))
+	lineOf := func(pos int) int { return first + strings.Count(string(b[:pos]), "\n") }
+	var problems []MarkdownProblem
+
+	// Link destinations: "](" must be followed by a balanced ")". The
+	// destination is masked, as URLs are not read for emphasis.
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] != ']' || b[i+1] != '(' {
+			continue
+		}
+		depth, end := 0, -1
+		for j := i + 2; j < len(b) && end < 0; j++ {
+			switch b[j] {
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					end = j
+				}
+				depth--
+			}
+		}
+		if end < 0 {
+			problems = append(problems, MarkdownProblem{Line: lineOf(i), Message: "link destination is missing its closing )"})
+			break
+		}
+		for k := i + 2; k < end; k++ {
+			if b[k] != '\n' {
+				b[k] = 'x'
+			}
+		}
+		i = end
+	}
+	text := string(b)
+
+	var runs []*delimiterRun
+	for i := 0; i < len(text); {
+		c := text[i]
+		if c != '*' && c != '_' {
+			i++
+			continue
+		}
+		n := 0
+		for i+n < len(text) && text[i+n] == c {
+			n++
+		}
+		before, after := ' ', ' '
+		if i > 0 {
+			before, _ = utf8.DecodeLastRuneInString(text[:i])
+		}
+		if i+n < len(text) {
+			after, _ = utf8.DecodeRuneInString(text[i+n:])
+		}
+		left := !unicode.IsSpace(after) && (!isPunctuation(after) || unicode.IsSpace(before) || isPunctuation(before))
+		right := !unicode.IsSpace(before) && (!isPunctuation(before) || unicode.IsSpace(after) || isPunctuation(after))
+		run := &delimiterRun{char: c, pos: i, length: n, remaining: n, canOpen: left, canClose: right}
+		if c == '_' {
+			run.canOpen = left && (!right || isPunctuation(before))
+			run.canClose = right && (!left || isPunctuation(after))
+		}
+		if run.canOpen || run.canClose {
+			runs = append(runs, run)
+		}
+		i += n
+	}
+
+	// Match closers with openers as CommonMark's "process emphasis" does
+	var openers []*delimiterRun
+	for _, closer := range runs {
+		if closer.canClose {
+			for k := len(openers) - 1; k >= 0 && closer.remaining > 0; k-- {
+				opener := openers[k]
+				if opener.char != closer.char || opener.remaining == 0 {
+					continue
+				}
+				if (opener.canClose || closer.canOpen) && (opener.length+closer.length)%3 == 0 && (opener.length%3 != 0 || closer.length%3 != 0) {
+					continue
+				}
+				use := 1
+				if opener.remaining >= 2 && closer.remaining >= 2 {
+					use = 2
+				}
+				opener.remaining -= use
+				closer.remaining -= use
+				openers = openers[:k+1] // Openers in between can no longer match
+				k++
+			}
+		}
+		if closer.canOpen && closer.remaining > 0 {
+			openers = append(openers, closer)
+		}
+	}
+	for _, run := range runs {
+		if run.remaining == 0 {
+			continue
+		}
+		delim := strings.Repeat(string(run.char), run.remaining)
+		if run.canOpen {
+			problems = append(problems, MarkdownProblem{Line: lineOf(run.pos), Message: fmt.Sprintf("emphasis %s is never closed", delim)})
+		} else {
+			problems = append(problems, MarkdownProblem{Line: lineOf(run.pos), Message: fmt.Sprintf("emphasis %s closes nothing", delim)})
+		}
+	}
+	return problems
+}
+
+// isPunctuation reports whether r is punctuation in CommonMark's sense.
+func isPunctuation(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// validateMarkdown checks the rendered Markdown of the page at u when
+// ValidateMarkdown is set. Problems are logged as warnings, or fail the page
+// with ErrInvalidMarkdown under StrictMarkdown.
+func (c *Converter) validateMarkdown(u string, rendered string) error {
+	if !c.ValidateMarkdown || (c.Format != "" && c.Format != FormatMarkdown) || c.SelectorAttr != "" {
+		return nil
+	}
+	problems := CheckMarkdown(rendered)
+	if len(problems) == 0 {
+		return nil
+	}
+	if !c.StrictMarkdown {
+		for _, p := range problems {
+			c.logf(u, "WARNING: Malformed markdown for %s, %s", u, p)
+		}
+		return nil
+	}
+	descriptions := make([]string, len(problems))
+	for i, p := range problems {
+		descriptions[i] = p.String()
+	}
+	return newError(ErrInvalidMarkdown, u, fmt.Errorf("rendered markdown of %s is malformed: %s", u, strings.Join(descriptions, "; ")))
+}
@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMarkdown(t *testing.T) {
+	testCases := []struct {
+		name     string
+		markdown string
+		problems []string
+	}{
+		{"well formed", "---\ntitle: *x\n---\n\n# A **bold** start\n\nSee [the docs](https://example.com/a_(b)) and `*ptr`.\n\n" +
+			"Edit file_name.go, or 2 * 3.\n\n\\*literal\\*\n\n```go\nx := *p\n```\n\n| a | b |\n|---|:-:|\n| 1 | `x|y` |", nil},
+		{"unclosed strong", "Some **bold text.", []string{"line 1: emphasis ** is never closed"}},
+		{"stray closer", "Intro.\n\nA word** here.", []string{"line 3: emphasis ** closes nothing"}},
+		{"unclosed emphasis across lines", "one _two\nthree", []string{"line 1: emphasis _ is never closed"}},
+		{"unclosed fence", "Text\n\n```python\ndef f():\n    pass", []string{"line 3: code fence ``` is never closed"}},
+		{"unclosed link", "See [docs](https://example.com for more.", []string{"line 1: link destination is missing its closing )"}},
+		{"table without delimiter", "| a | b |\n| 1 | 2 |", []string{"line 1: table has no delimiter row below its header"}},
+		{"ragged table", "| a | b |\n|---|---|\n| 1 | 2 | 3 |", []string{"line 3: table row has 3 cells, the header has 2"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var problems []string
+			for _, p := range CheckMarkdown(tc.markdown) {
+				problems = append(problems, p.String())
+			}
+			assert.Equal(t, tc.problems, problems)
+		})
+	}
+}
+
+func TestCheckMarkdown_RendererOutput(t *testing.T) {
+	for _, name := range []string{"code.html", "escaping.html", "entities.html", "sections.html"} {
+		doc := loadFixture(t, name)
+		content, err := doc.Find("body").Html()
+		require.NoError(t, err)
+		c := &Converter{RichMarkdown: true}
+		assert.Empty(t, CheckMarkdown(c.render(content)), name)
+	}
+}
+
+func TestConvertPage_StrictMarkdown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		// Rendered as it is written, the text opens emphasis it never closes
+		fmt.Fprint(w, `<html><head><title>Stars</title></head><body><p>Rated **five stars by readers.</p></body></html>`)
+	}))
+	defer server.Close()
+
+	c := &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, ValidateMarkdown: true}
+	result := c.convertPage(server.URL+"/stars", "")
+	require.True(t, result.IsSuccess, "problems are only warnings without StrictMarkdown")
+	assert.FileExists(t, filepath.Join(c.OutputDir, "stars.md"))
+
+	c = &Converter{Client: server.Client(), OutputDir: t.TempDir(), FileMode: 0644, ValidateMarkdown: true, StrictMarkdown: true}
+	result = c.convertPage(server.URL+"/stars", "")
+	assert.ErrorIs(t, result.Err, ErrInvalidMarkdown)
+	assert.Contains(t, result.Error, "line 1: emphasis ** is never closed")
+	files, err := os.ReadDir(c.OutputDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// nameRegistry gives each page of a run a file of its own. Pages whose names
+// collide get a numbered suffix, as in guide-2.md, but a page converted again,
+// as a repeated URL or by a retry, gets the file it was given before.
+type nameRegistry struct {
+	mu     sync.Mutex
+	owners map[string]string // File name to the canonical URL of its page
+}
+
+func newNameRegistry() *nameRegistry {
+	return &nameRegistry{owners: make(map[string]string)}
+}
+
+// claim returns the file name for the page at u that would be named name,
+// placed by place when it is not nil: name itself, unless another page holds
+// it, in which case the first numbered variant that is free or already the
+// page's own. A nil registry returns the name unchanged.
+func (r *nameRegistry) claim(u, name string, place func(string) string) string {
+	if place == nil {
+		place = func(name string) string { return name }
+	}
+	if r == nil {
+		return place(name)
+	}
+	key := canonicalURL(u)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	candidate := place(name)
+	for n := 2; ; n++ {
+		if owner, taken := r.owners[candidate]; !taken || owner == key {
+			r.owners[candidate] = key
+			return candidate
+		}
+		candidate = place(fmt.Sprintf("%s-%d%s", stem, n, ext))
+	}
+}
+
+// ReserveFileNames records the files of results, such as the successful pages
+// of an earlier run read from its manifest, as taken by their pages, so that
+// converting into the same directory again never overwrites another page's
+// file and gives a page converted again its earlier file.
+func (c *Converter) ReserveFileNames(results []Result) {
+	if c.names == nil {
+		return
+	}
+	c.names.mu.Lock()
+	defer c.names.mu.Unlock()
+	for _, r := range results {
+		if r.IsSuccess && r.FileName != "" {
+			c.names.owners[pageFileName(r)] = canonicalURL(r.URL)
+		}
+	}
+}
+
+// pageFileName returns the file name the page of r was given before it was
+// split into parts or regions.
+func pageFileName(r Result) string {
+	ext := filepath.Ext(r.FileName)
+	stem := strings.TrimSuffix(r.FileName, ext)
+	switch {
+	case len(r.Parts) > 0:
+		stem = strings.TrimSuffix(stem, "-part1")
+	case len(r.Regions) > 0:
+		stem = strings.TrimSuffix(stem, "-"+r.Regions[0].Name)
+	}
+	return stem + ext
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Region is a named part of each page that is written to a file of its own.
+type Region struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+}
+
+// RegionFile is the file written for one Region of a page.
+type RegionFile struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	FileName string `json:"fileName"`
+}
+
+// ParseRegion parses a region written as "name=selector", such as
+// "tutorial=.tutorial". The name becomes part of file names, so it may only
+// hold characters that SanitizeFilename keeps.
+func ParseRegion(s string) (Region, error) {
+	name, sel, ok := strings.Cut(s, "=")
+	region := Region{Name: strings.TrimSpace(name), Selector: strings.TrimSpace(sel)}
+	if !ok || region.Name == "" || region.Selector == "" {
+		return Region{}, fmt.Errorf("'%s' is not name=selector", s)
+	}
+	if SanitizeFilename(region.Name) != region.Name {
+		return Region{}, fmt.Errorf("region name '%s' may only hold lowercase letters, digits and '_'", region.Name)
+	}
+	if err := ValidateSelector(region.Selector); err != nil {
+		return Region{}, err
+	}
+	return region, nil
+}
+
+// regionFileName returns the file name for a region of the page written to
+// name: the region name is appended to its stem, as in guide-tutorial.md.
+func regionFileName(name, region string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + region + ext
+}
+
+// convertRegions writes each of the Regions of the page in doc to its own file.
+// Every region is extracted before any is written, so a page missing one
+// leaves no files behind.
+func (c *Converter) convertRegions(doc *goquery.Document, u string) Result {
+	contents := make([]string, len(c.Regions))
+	for i, region := range c.Regions {
+		content, err := c.extractContent(doc, u, region.Selector)
+		if err != nil {
+			c.logf(u, "ERROR: Failed to process region '%s' of %s: %v", region.Name, u, err)
+			return failure(u, err)
+		}
+		contents[i] = content
+	}
+
+	var result Result
+	for i := range c.Regions {
+		region := &c.Regions[i]
+		r := c.writeContent(doc, u, contents[i], region)
+		if !r.IsSuccess {
+			return r
+		}
+		if i == 0 {
+			result = r
+		}
+		result.Regions = append(result.Regions, RegionFile{Name: region.Name, Selector: region.Selector, FileName: r.FileName})
+	}
+	result.Content = nil // Each region has its own file
+	return result
+}
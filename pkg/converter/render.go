@@ -0,0 +1,634 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats supported by Converter.Format.
+const (
+	FormatMarkdown = "markdown"
+	FormatAsciiDoc = "adoc"
+	FormatRST      = "rst"
+)
+
+// Markdown heading styles for Converter.HeadingStyle.
+const (
+	HeadingATX    = "atx"    // "# Title" at every level (default)
+	HeadingSetext = "setext" // Underlined <h1> and <h2>; deeper levels stay ATX, as Setext has only two
+)
+
+// What Converter.HeadingDemotion does with headings deeper than MaxHeadingDepth.
+const (
+	HeadingDemoteBold  = "bold"  // A paragraph of bold text (default)
+	HeadingDemoteClamp = "clamp" // A heading at MaxHeadingDepth
+)
+
+// How Converter.AnchorStyle keeps the id of a heading, so links to it still work.
+const (
+	AnchorNone      = ""          // Dropped (default)
+	AnchorHTML      = "html"      // An <a id="..."></a> before the heading
+	AnchorAttribute = "attribute" // A {#...} attribute after the heading text, read by Pandoc, Hugo and kramdown
+)
+
+// IsValidAnchorStyle reports whether style names a supported anchor style.
+func IsValidAnchorStyle(style string) bool {
+	switch style {
+	case AnchorNone, AnchorHTML, AnchorAttribute:
+		return true
+	}
+	return false
+}
+
+// IsValidFormat reports whether format names a supported output format.
+// An empty format selects markdown.
+func IsValidFormat(format string) bool {
+	switch format {
+	case "", FormatMarkdown, FormatAsciiDoc, FormatRST:
+		return true
+	}
+	return false
+}
+
+// renderer produces the markup for one output format. The walker in renderHTML
+// decides the document structure; renderers only format individual blocks.
+type renderer interface {
+	heading(level int, text string) string
+	anchor(block, id string, level int) string // Anchors a heading of level, or a paragraph at level 0
+	paragraph(text string) string
+	link(text, href string) string
+	code(text string) string
+	strong(text string) string
+	codeBlock(code, lang string) string
+	list(items [][]listBlock, ordered bool, depth int) string // depth is 1 for a list in no other
+	table(rows [][][]string) string                           // Rows of cells, each cell its lines; the first row is the header
+	frontmatter(metadata map[string]interface{}) ([]byte, error)
+	extension() string
+}
+
+// renderer returns the renderer for the configured output format.
+func (c *Converter) renderer() renderer {
+	var r renderer
+	switch c.Format {
+	case FormatAsciiDoc:
+		r = asciidocRenderer{anchors: c.AnchorStyle != AnchorNone}
+	case FormatRST:
+		r = rstRenderer{anchors: c.AnchorStyle != AnchorNone}
+	default:
+		r = markdownRenderer{setext: c.HeadingStyle == HeadingSetext, anchors: c.AnchorStyle}
+	}
+	if c.MaxHeadingDepth > 0 {
+		r = cappedRenderer{renderer: r, depth: c.MaxHeadingDepth, clamp: c.HeadingDemotion == HeadingDemoteClamp}
+	}
+	return r
+}
+
+// cappedRenderer renders headings deeper than depth as bold paragraphs, or as
+// headings at depth when clamp is set. Everything else is left to the format's
+// renderer.
+type cappedRenderer struct {
+	renderer
+	depth int
+	clamp bool
+}
+
+func (r cappedRenderer) heading(level int, text string) string {
+	switch {
+	case level <= r.depth:
+		return r.renderer.heading(level, text)
+	case r.clamp:
+		return r.renderer.heading(r.depth, text)
+	default:
+		return r.paragraph(r.strong(text))
+	}
+}
+
+func (r cappedRenderer) anchor(block, id string, level int) string {
+	switch {
+	case level <= r.depth:
+	case r.clamp:
+		level = r.depth
+	default:
+		level = 0 // Demoted to a paragraph
+	}
+	return r.renderer.anchor(block, id, level)
+}
+
+// render converts extracted HTML into the configured output format.
+func (c *Converter) render(htmlContent string) string {
+	return c.renderAt(htmlContent, nil)
+}
+
+// renderAt converts extracted HTML into the configured output format, with
+// its relative links resolved against base unless it is nil.
+func (c *Converter) renderAt(htmlContent string, base *url.URL) string {
+	r := c.renderer()
+	if base != nil {
+		r = resolvingRenderer{renderer: r, base: base}
+	}
+	if c.classicMarkdown() {
+		return applyEmojiStyle(renderClassicMarkdown(htmlContent, r), c.EmojiStyle)
+	}
+	return applyEmojiStyle(renderHTML(htmlContent, r), c.EmojiStyle)
+}
+
+// slice trims rendered text to the region between the SliceStart and SliceEnd
+// matches, exclusive of the matches themselves. Without SliceEnd, or when it
+// does not match, the region runs to the end of the text.
+func (c *Converter) slice(text string, u string) (string, error) {
+	if c.SliceStart != nil {
+		loc := c.SliceStart.FindStringIndex(text)
+		if loc == nil {
+			return "", newError(ErrSliceNoMatch, u, fmt.Errorf("slice start /%s/ not found in the rendered text of %s", c.SliceStart, u))
+		}
+		text = text[loc[1]:]
+	}
+	if c.SliceEnd != nil {
+		if loc := c.SliceEnd.FindStringIndex(text); loc != nil {
+			text = text[:loc[0]]
+		}
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// frontmatter renders page metadata as the header block of the configured output format.
+func (c *Converter) frontmatter(metadata map[string]interface{}) ([]byte, error) {
+	for key, value := range metadata {
+		switch v := value.(type) {
+		case string:
+			metadata[key] = applyEmojiStyle(v, c.EmojiStyle)
+		case []string:
+			for i := range v {
+				v[i] = applyEmojiStyle(v[i], c.EmojiStyle)
+			}
+		}
+	}
+	return c.renderer().frontmatter(metadata)
+}
+
+// renderHTML walks an HTML fragment and renders headings, paragraphs, links,
+// code blocks, lists and tables with r. This is a simplified conversion: other
+// elements are descended into, but not rendered themselves.
+func renderHTML(htmlContent string, r renderer) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		log.Printf("ERROR: Failed to parse HTML for conversion: %v", err)
+		return ""
+	}
+
+	// Create a selection from the document
+	var selection *goquery.Selection
+	body := doc.Find("body")
+	if body.Length() > 0 {
+		selection = body
+	} else {
+		selection = doc.Selection
+	}
+
+	var blocks []string
+	walkBlocks(selection, r, &blocks, 0)
+
+	// If no specific tags found, just use the text content
+	if len(blocks) == 0 {
+		return strings.TrimSpace(selection.Text())
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// classicMarkdown reports whether pages are rendered by renderClassicMarkdown:
+// as Markdown, without RichMarkdown. XML pages, which the classic conversion
+// never read, are always rendered in full.
+func (c *Converter) classicMarkdown() bool {
+	return (c.Format == "" || c.Format == FormatMarkdown) && !c.RichMarkdown && c.InputFormat != InputXML
+}
+
+// renderClassicMarkdown converts an HTML fragment to Markdown the way the
+// converter always has, unless RichMarkdown is set: the text of each heading,
+// paragraph and link in document order, a link after the paragraph holding
+// it. Code blocks, lists and tables are not rendered, except for the
+// paragraphs and links in them. Headings and links are formatted by r, so the
+// heading and link options still apply.
+func renderClassicMarkdown(htmlContent string, r renderer) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		log.Printf("ERROR: Failed to parse HTML for markdown conversion: %v", err)
+		return ""
+	}
+
+	var markdownBuilder strings.Builder
+	selection := doc.Find("body")
+	if selection.Length() == 0 {
+		selection = doc.Selection
+	}
+	selection.Find("h1, h2, h3, h4, h5, h6, p, a").Each(func(i int, s *goquery.Selection) {
+		tagName := goquery.NodeName(s)
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			return
+		}
+
+		switch tagName {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			level := int(tagName[1] - '0')
+			block := r.heading(level, text)
+			if id := strings.TrimSpace(s.AttrOr("id", "")); id != "" {
+				block = r.anchor(block, id, level)
+			}
+			markdownBuilder.WriteString(block + "\n\n")
+		case "p":
+			markdownBuilder.WriteString(r.paragraph(text) + "\n\n")
+		case "a":
+			if href, exists := s.Attr("href"); exists {
+				markdownBuilder.WriteString(r.link(text, href))
+			} else {
+				markdownBuilder.WriteString(text)
+			}
+		}
+	})
+
+	// If no specific tags found, just use the text content
+	if markdownBuilder.Len() == 0 {
+		markdownBuilder.WriteString(strings.TrimSpace(selection.Text()))
+	}
+
+	// Clean up multiple newlines and trim overall whitespace
+	result := blankLines.ReplaceAllString(markdownBuilder.String(), "\n\n")
+	return strings.TrimSpace(result)
+}
+
+// blankLines matches the newlines between two classic Markdown blocks.
+var blankLines = regexp.MustCompile(`\n\n+`)
+
+// walkBlocks appends the rendered block-level elements found below s to blocks.
+// depth is the number of lists s is nested in.
+func walkBlocks(s *goquery.Selection, r renderer, blocks *[]string, depth int) {
+	s.Contents().Each(func(i int, child *goquery.Selection) {
+		if child.Get(0).Type == html.ElementNode {
+			walkBlock(child, r, blocks, depth)
+		}
+	})
+}
+
+// walkBlock appends the element s to blocks when it is a block walkBlocks
+// renders, or the blocks found below it otherwise.
+func walkBlock(s *goquery.Selection, r renderer, blocks *[]string, depth int) {
+	switch tagName := goquery.NodeName(s); tagName {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if text := collapseWhitespace(s.Text()); text != "" {
+			block := r.heading(int(tagName[1]-'0'), text)
+			if id := strings.TrimSpace(s.AttrOr("id", "")); id != "" {
+				block = r.anchor(block, id, int(tagName[1]-'0'))
+			}
+			*blocks = append(*blocks, block)
+		}
+	case "p":
+		if text := inlineText(s, r); text != "" {
+			*blocks = append(*blocks, r.paragraph(text))
+		}
+	case "a":
+		if text := inlineText(s, r); text != "" {
+			*blocks = append(*blocks, r.paragraph(text))
+		}
+	case "pre":
+		if code := preText(s); strings.TrimSpace(code) != "" {
+			*blocks = append(*blocks, r.codeBlock(code, codeLanguage(s)))
+		}
+	case "ul", "ol":
+		if list := renderList(s, r, depth+1); list != "" {
+			*blocks = append(*blocks, list)
+		}
+	case "table":
+		if table := renderTable(s, r); table != "" {
+			*blocks = append(*blocks, table)
+		}
+	case "script", "style", "noscript", "template":
+		// Never part of the readable content
+	default:
+		walkBlocks(s, r, blocks, depth)
+	}
+}
+
+// inlineText renders the inline content of s, keeping links and collapsing whitespace.
+func inlineText(s *goquery.Selection, r renderer) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "a":
+			text := collapseWhitespace(goquery.NewDocumentFromNode(n).Text())
+			href, exists := goquery.NewDocumentFromNode(n).Attr("href")
+			if text == "" {
+				return
+			}
+			if exists {
+				b.WriteString(r.link(text, href))
+			} else {
+				b.WriteString(text)
+			}
+		case n.Type == html.ElementNode && n.Data == "code":
+			// Rendered as a code span, so its text needs no escaping
+			if text := collapseWhitespace(goquery.NewDocumentFromNode(n).Text()); text != "" {
+				b.WriteString(r.code(text))
+			}
+		case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style"):
+			return
+		default:
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+		}
+	}
+	for _, n := range s.Nodes {
+		walk(n)
+	}
+	return collapseWhitespace(b.String())
+}
+
+// preText returns the text of a <pre> block as written, with its indentation
+// and inner blank lines, and <br> elements as line breaks. Only the newlines
+// around it are trimmed, like the one after a <code> that opens the block.
+func preText(pre *goquery.Selection) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "br":
+			b.WriteString("\n")
+		default:
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+		}
+	}
+	for _, n := range pre.Nodes {
+		walk(n)
+	}
+	return strings.Trim(b.String(), "\n")
+}
+
+// collapseWhitespace replaces runs of whitespace with single spaces and trims the result.
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// codeLanguage detects the language of a code block from a "language-*" or
+// "lang-*" class on the <pre> element or its <code> child.
+func codeLanguage(pre *goquery.Selection) string {
+	for _, s := range []*goquery.Selection{pre, pre.ChildrenFiltered("code").First()} {
+		class, _ := s.Attr("class")
+		for _, name := range strings.Fields(class) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				if strings.HasPrefix(name, prefix) {
+					return strings.TrimPrefix(name, prefix)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// sortedMetadataKeys returns the metadata keys in lexical order.
+func sortedMetadataKeys(metadata map[string]interface{}) []string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// attributeValue renders a metadata value on a single line for the formats whose
+// metadata are key-value attributes. Lists are joined with commas.
+func attributeValue(value interface{}) string {
+	if list, ok := value.([]string); ok {
+		return collapseWhitespace(strings.Join(list, ", "))
+	}
+	return collapseWhitespace(fmt.Sprint(value))
+}
+
+// marshalYAML renders metadata as YAML, keeping emoji and other printable
+// characters literal instead of escaped.
+func marshalYAML(metadata map[string]interface{}) ([]byte, error) {
+	yamlBytes, err := yaml.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return unescapeYAMLRunes(yamlBytes), nil
+}
+
+// markdownRenderer renders Markdown with a YAML frontmatter block.
+type markdownRenderer struct {
+	setext  bool   // Underline <h1> and <h2> instead of prefixing them with #
+	anchors string // The AnchorStyle of headings with an id
+}
+
+func (r markdownRenderer) heading(level int, text string) string {
+	if r.setext && level <= 2 {
+		underline := "="
+		if level == 2 {
+			underline = "-"
+		}
+		return text + "\n" + strings.Repeat(underline, utf8.RuneCountInString(text))
+	}
+	return strings.Repeat("#", level) + " " + text
+}
+
+// attributeID matches the ids that a {#...} attribute can hold.
+var attributeID = regexp.MustCompile(`^[A-Za-z][\w:.-]*$`)
+
+func (r markdownRenderer) anchor(block, id string, level int) string {
+	switch {
+	case r.anchors == AnchorNone:
+		return block
+	case r.anchors == AnchorAttribute && level > 0 && attributeID.MatchString(id):
+		// On the line of the heading text, which a Setext underline follows
+		title, underline, _ := strings.Cut(block, "\n")
+		if underline != "" {
+			underline = "\n" + underline
+		}
+		return title + " {#" + id + "}" + underline
+	}
+	// Paragraphs take no attributes, so they and ids an attribute cannot hold get an HTML anchor
+	return `<a id="` + html.EscapeString(id) + `"></a>` + "\n\n" + block
+}
+
+func (markdownRenderer) paragraph(text string) string { return text }
+
+func (markdownRenderer) link(text, href string) string {
+	return fmt.Sprintf("[%s](%s)", text, href)
+}
+
+func (markdownRenderer) code(text string) string {
+	// The delimiter must be a backtick run that does not occur in the text
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+func (markdownRenderer) strong(text string) string { return "**" + text + "**" }
+
+func (markdownRenderer) codeBlock(code, lang string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+func (markdownRenderer) frontmatter(metadata map[string]interface{}) ([]byte, error) {
+	yamlBytes, err := marshalYAML(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("---\n" + string(yamlBytes) + "---\n\n"), nil
+}
+
+func (markdownRenderer) extension() string { return ".md" }
+
+// asciidocRenderer renders AsciiDoc with the metadata as document header attributes.
+type asciidocRenderer struct {
+	anchors bool // Keep the ids of headings as block anchors
+}
+
+// asciidocID matches the ids that an AsciiDoc block anchor can hold.
+var asciidocID = regexp.MustCompile(`^[A-Za-z_][\w.-]*$`)
+
+func (r asciidocRenderer) anchor(block, id string, _ int) string {
+	if !r.anchors || !asciidocID.MatchString(id) {
+		return block
+	}
+	return "[[" + id + "]]\n" + block
+}
+
+func (asciidocRenderer) heading(level int, text string) string {
+	// Level 0 (=) is reserved for the document title, so <h1> becomes a level 1 section
+	return strings.Repeat("=", min(level+1, 6)) + " " + text
+}
+
+func (asciidocRenderer) paragraph(text string) string { return text }
+
+func (asciidocRenderer) link(text, href string) string {
+	return "link:" + href + "[" + strings.ReplaceAll(text, "]", `\]`) + "]"
+}
+
+func (asciidocRenderer) code(text string) string {
+	// Literal monospace: the passthrough keeps * and _ from being read as formatting
+	return "`+" + text + "+`"
+}
+
+func (asciidocRenderer) strong(text string) string { return "*" + text + "*" }
+
+func (asciidocRenderer) codeBlock(code, lang string) string {
+	if lang == "" {
+		return "----\n" + code + "\n----"
+	}
+	return "[source," + lang + "]\n----\n" + code + "\n----"
+}
+
+func (asciidocRenderer) frontmatter(metadata map[string]interface{}) ([]byte, error) {
+	var b strings.Builder
+	if title, ok := metadata["title"].(string); ok {
+		b.WriteString("= " + collapseWhitespace(title) + "\n")
+	}
+	for _, key := range sortedMetadataKeys(metadata) {
+		if key == "title" {
+			continue
+		}
+		b.WriteString(":" + key + ": " + attributeValue(metadata[key]) + "\n")
+	}
+	b.WriteString("\n")
+	return []byte(b.String()), nil
+}
+
+func (asciidocRenderer) extension() string { return ".adoc" }
+
+// rstUnderlines are the section adornment characters for <h1> to <h6>, following
+// the order recommended by the Python documentation style guide.
+var rstUnderlines = []string{"=", "-", "~", "^", `"`, "'"}
+
+// rstRenderer renders reStructuredText with the metadata as a leading field list,
+// which Sphinx reads as file-wide metadata.
+type rstRenderer struct {
+	anchors bool // Keep the ids of headings as hyperlink targets
+}
+
+// rstName matches the target names that need no quoting.
+var rstName = regexp.MustCompile(`^[A-Za-z0-9]+([-_.+][A-Za-z0-9]+)*$`)
+
+func (r rstRenderer) anchor(block, id string, _ int) string {
+	if !r.anchors {
+		return block
+	}
+	if !rstName.MatchString(id) {
+		// A quoted target name may hold any character but a backquote
+		id = "`" + strings.ReplaceAll(id, "`", "") + "`"
+	}
+	return ".. _" + id + ":\n\n" + block
+}
+
+func (rstRenderer) heading(level int, text string) string {
+	return text + "\n" + strings.Repeat(rstUnderlines[level-1], utf8.RuneCountInString(text))
+}
+
+func (rstRenderer) paragraph(text string) string { return text }
+
+func (rstRenderer) link(text, href string) string {
+	// Anonymous references (__) avoid "duplicate target name" warnings for repeated link text
+	text = strings.NewReplacer("`", "\\`", "<", "\\<").Replace(text)
+	return "`" + text + " <" + href + ">`__"
+}
+
+func (rstRenderer) code(text string) string { return "``" + text + "``" }
+
+func (rstRenderer) strong(text string) string { return "**" + text + "**" }
+
+func (rstRenderer) codeBlock(code, lang string) string {
+	directive := "::"
+	if lang != "" {
+		directive = ".. code-block:: " + lang
+	}
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "   " + line
+		}
+	}
+	return directive + "\n\n" + strings.Join(lines, "\n")
+}
+
+func (rstRenderer) frontmatter(metadata map[string]interface{}) ([]byte, error) {
+	var b strings.Builder
+	for _, key := range sortedMetadataKeys(metadata) {
+		if key == "title" {
+			continue
+		}
+		b.WriteString(":" + key + ": " + attributeValue(metadata[key]) + "\n")
+	}
+	b.WriteString("\n")
+	if title, ok := metadata["title"].(string); ok {
+		title = collapseWhitespace(title)
+		adornment := strings.Repeat("=", utf8.RuneCountInString(title))
+		b.WriteString(adornment + "\n" + title + "\n" + adornment + "\n\n")
+	}
+	return []byte(b.String()), nil
+}
+
+func (rstRenderer) extension() string { return ".rst" }
@@ -0,0 +1,130 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolverTimeout bounds a query to a custom DNS server.
+const resolverTimeout = 5 * time.Second
+
+// hostResolver resolves host names for both the URL validation and the
+// connections. The addresses the validation approves for a host are pinned, and
+// connections to it are made to them alone rather than to a fresh answer, so
+// a name that is rebound to a private address after the check is not followed.
+type hostResolver struct {
+	hosts    map[string]net.IP // Static overrides, consulted first
+	resolver *net.Resolver
+
+	mu       sync.Mutex
+	approved map[string][]net.IP // The addresses last approved for each host
+}
+
+// UseResolver makes the Converter resolve host names with the DNS server at
+// server (host:port), or the system resolver when server is empty, except for
+// the names in hosts, which resolve to the given IP addresses. The URL
+// validation uses the same answers, and pages are fetched from the addresses
+// it approved. NewConverter sets up the system resolver. It must be called
+// before TraceRequests and UseDigestAuth, which wrap the transport it configures.
+func (c *Converter) UseResolver(server string, hosts map[string]string) error {
+	r := &hostResolver{hosts: make(map[string]net.IP), resolver: net.DefaultResolver, approved: make(map[string][]net.IP)}
+	for host, addr := range hosts {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q for host %s", addr, host)
+		}
+		r.hosts[strings.ToLower(host)] = ip
+	}
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("invalid DNS server address %q: %w", server, err)
+		}
+		dialer := &net.Dialer{Timeout: resolverTimeout}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	var transport *http.Transport
+	switch t := c.Client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return errors.New("the resolver must be configured before the transport is wrapped")
+	}
+	dialer := &net.Dialer{Timeout: httpTimeout}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := r.dialIPs(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var dialErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+	c.Client.Transport = transport
+	c.resolver = r
+	return nil
+}
+
+// lookupIP returns the addresses of host.
+func (r *hostResolver) lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip, ok := r.hosts[strings.ToLower(host)]; ok {
+		return []net.IP{ip}, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return r.resolver.LookupIP(ctx, "ip", host)
+}
+
+// approve pins ips, which passed the URL validation, as the addresses that
+// connections to host are made to.
+func (r *hostResolver) approve(host string, ips []net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approved[strings.ToLower(host)] = ips
+}
+
+// dialIPs returns the addresses to connect to for host: those approved for it,
+// or a fresh answer for a host that was never checked.
+func (r *hostResolver) dialIPs(ctx context.Context, host string) ([]net.IP, error) {
+	r.mu.Lock()
+	ips, ok := r.approved[strings.ToLower(host)]
+	r.mu.Unlock()
+	if ok {
+		return ips, nil
+	}
+	return r.lookupIP(ctx, host)
+}
+
+// lookupIP resolves host as the Converter's connections do.
+func (c *Converter) lookupIP(host string) ([]net.IP, error) {
+	if c.resolver == nil {
+		return net.LookupIP(host)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolverTimeout)
+	defer cancel()
+	return c.resolver.lookupIP(ctx, host)
+}
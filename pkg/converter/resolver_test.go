@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseResolver_HostOverride(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "served for %s", r.Host)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	c := &Converter{Client: &http.Client{}}
+	require.NoError(t, c.UseResolver("", map[string]string{"docs.staging.internal": "127.0.0.1"}))
+
+	resp, err := c.Client.Get("http://docs.staging.internal:" + port + "/guide")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "served for docs.staging.internal:"+port, string(body), "the name should reach the server and keep its Host header")
+
+	// The URL validation sees the same address as the connection
+	ips, err := c.lookupIP("docs.staging.internal")
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("127.0.0.1")}, ips)
+
+	assert.ErrorContains(t, c.UseResolver("", map[string]string{"docs.example.com": "not-an-ip"}), `invalid IP address "not-an-ip"`)
+	assert.ErrorContains(t, (&Converter{Client: &http.Client{}}).UseResolver("8.8.8.8", nil), "invalid DNS server address")
+
+	wrapped := &Converter{Client: &http.Client{}}
+	wrapped.TraceRequests(nil)
+	assert.Error(t, wrapped.UseResolver("", nil), "a wrapped transport can't be given a resolver")
+}
+
+func TestHostResolver_DialsApprovedAddresses(t *testing.T) {
+	c := &Converter{Client: &http.Client{}}
+	require.NoError(t, c.UseResolver("", map[string]string{"docs.example.com": "93.184.216.34"}))
+
+	ips, err := c.resolver.dialIPs(context.Background(), "docs.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34")}, ips, "an unchecked host is resolved as usual")
+
+	c.resolver.approve("docs.example.com", ips)
+	c.resolver.hosts["docs.example.com"] = net.ParseIP("127.0.0.1") // Rebound after the check
+	ips, err = c.resolver.dialIPs(context.Background(), "DOCS.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34")}, ips, "the connection goes to the approved address")
+
+	fresh, err := NewConverter(t.TempDir())
+	require.NoError(t, err)
+	assert.NotNil(t, fresh.resolver, "pages are pinned to their approved addresses by default")
+}
@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// selectorRuleArrow separates the condition of a selector rule from its selector.
+const selectorRuleArrow = "=>"
+
+// SelectorRule routes pages of one type to their own content selector: a page
+// in which When matches anything is converted with Selector.
+type SelectorRule struct {
+	When     string `json:"when"`
+	Selector string `json:"selector"`
+}
+
+// ParseSelectorRule parses a rule written as "condition => selector", such as
+// "body.article => article .post-body". Both sides must be valid CSS selectors;
+// the selector may also be a whole-page selector.
+func ParseSelectorRule(s string) (SelectorRule, error) {
+	when, sel, ok := strings.Cut(s, selectorRuleArrow)
+	rule := SelectorRule{When: strings.TrimSpace(when), Selector: strings.TrimSpace(sel)}
+	if !ok || rule.When == "" {
+		return SelectorRule{}, fmt.Errorf("'%s' is not 'condition %s selector'", s, selectorRuleArrow)
+	}
+	if err := ValidateSelector(rule.When); err != nil {
+		return SelectorRule{}, err
+	}
+	if !IsWholePageSelector(rule.Selector) {
+		if err := ValidateSelector(rule.Selector); err != nil {
+			return SelectorRule{}, err
+		}
+	}
+	return rule, nil
+}
+
+// pageSelector returns the selector of the first SelectorRule whose condition
+// matches in doc, or selector when none does.
+func (c *Converter) pageSelector(doc *goquery.Document, selector string) string {
+	for _, rule := range c.SelectorRules {
+		if doc.Find(rule.When).Length() > 0 {
+			return rule.Selector
+		}
+	}
+	return selector
+}
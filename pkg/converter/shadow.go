@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxNamedElements is the number of custom elements named in a shadow DOM hint.
+const maxNamedElements = 3
+
+// shadowDOMHint explains why a page parsed as served may show no content: it
+// has declarative shadow roots (<template shadowrootmode>), or custom elements
+// that render their content with JavaScript. It returns "" when the page has
+// neither, or was already rendered in a browser.
+func (c *Converter) shadowDOMHint(doc *goquery.Document) string {
+	if c.Render == RenderJS {
+		return ""
+	}
+	var signs []string
+	if roots := doc.Find("template[shadowrootmode], template[shadowroot]").Length(); roots > 0 {
+		signs = append(signs, fmt.Sprintf("%d declarative shadow roots", roots))
+	}
+	var names []string
+	seen := make(map[string]bool)
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		// Custom element names are the only ones with a hyphen
+		name := goquery.NodeName(s)
+		if strings.Contains(name, "-") && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	})
+	if len(names) > 0 {
+		listed := names[:min(len(names), maxNamedElements)]
+		elements := "<" + strings.Join(listed, ">, <") + ">"
+		if len(names) > len(listed) {
+			elements += fmt.Sprintf(" and %d more", len(names)-len(listed))
+		}
+		signs = append(signs, "custom elements "+elements)
+	}
+	if len(signs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("the page has %s, so its content is likely rendered in shadow DOM, which static parsing cannot see; try rendering it with JavaScript (--render js)",
+		strings.Join(signs, " and "))
+}
+
+// warnIfShadowed logs the shadow DOM hint of the page at urlStr when the content
+// selected from it holds no text.
+func (c *Converter) warnIfShadowed(doc *goquery.Document, content *goquery.Selection, urlStr string, selector string) {
+	if strings.TrimSpace(content.Text()) != "" || content.Find("img").Length() > 0 {
+		return
+	}
+	if hint := c.shadowDOMHint(doc); hint != "" {
+		c.logf(urlStr, "WARNING: Selector '%s' matched only empty content in %s: %s", selector, urlStr, hint)
+	}
+}
@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sharding schemes for Converter.Shard.
+const (
+	ShardNone = ""     // Every file directly in OutputDir (default)
+	ShardHash = "hash" // By the first two hex digits of the SHA-256 of the page URL: 256 directories
+	ShardHost = "host" // By host, e.g. docs.example.com/
+)
+
+// IsValidShard reports whether shard names a supported sharding scheme.
+func IsValidShard(shard string) bool {
+	switch shard {
+	case ShardNone, ShardHash, ShardHost:
+		return true
+	}
+	return false
+}
+
+// shardDir returns the subdirectory of OutputDir that the page at u is written
+// to, or "" when output is not sharded.
+func (c *Converter) shardDir(u string) string {
+	switch c.Shard {
+	case ShardHash:
+		sum := sha256.Sum256([]byte(u))
+		return hex.EncodeToString(sum[:1])
+	case ShardHost:
+		return safeHostName(u)
+	}
+	return ""
+}
+
+// DistinctHosts returns the number of different hosts among urls, ignoring
+// those without one.
+func DistinctHosts(urls []string) int {
+	hosts := make(map[string]bool)
+	for _, u := range urls {
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			hosts[strings.ToLower(parsed.Host)] = true
+		}
+	}
+	return len(hosts)
+}
+
+// makeParentDir creates the directory holding path, with DirMode, when it does
+// not exist yet.
+func (c *Converter) makeParentDir(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	mode := c.DirMode
+	if mode == 0 {
+		mode = DefaultDirMode
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	// As for files, the mode is set explicitly to bypass the umask
+	return os.Chmod(dir, mode)
+}
@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// PageRecord is one converted page as written to SingleJSON.
+type PageRecord struct {
+	Source   string                 `json:"source"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Body     string                 `json:"body"` // The rendered content, or the raw HTML with FetchOnly
+}
+
+// jsonArray writes values to w as the elements of one JSON array, each as soon
+// as it is added, so that a run never holds more than one page in memory for it.
+//
+// When ordered, it keeps the order of the run's URLs instead: the element of a
+// URL is held back until every URL before it has completed. The held elements are
+// what a run then buffers, at worst all but the first when the first URL is
+// the slowest.
+type jsonArray struct {
+	mu  sync.Mutex
+	w   io.Writer
+	n   int
+	err error // The first write error; later writes are skipped
+
+	ordered bool
+	urls    []string // In input order, from the first URL that has not completed
+	done    []bool
+	base    int // The position of urls[0] in the run
+	pending map[string][]byte
+}
+
+func newJSONArray(w io.Writer, ordered bool) *jsonArray {
+	a := &jsonArray{w: w, ordered: ordered}
+	if ordered {
+		a.pending = make(map[string][]byte)
+	}
+	return a
+}
+
+// expect records u as the next URL of the run, before its conversion starts.
+func (a *jsonArray) expect(u string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ordered {
+		a.urls = append(a.urls, u)
+		a.done = append(a.done, false)
+	}
+}
+
+// add writes v, the element of the URL u, as the next element of the array,
+// or holds it until the URLs before u have completed.
+func (a *jsonArray) add(u string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ordered {
+		a.pending[u] = data
+		return a.err
+	}
+	return a.write(data)
+}
+
+// complete records that the i-th URL has finished, with or without an
+// element, and writes the held elements that no longer wait on an earlier URL.
+func (a *jsonArray) complete(i int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.ordered {
+		return a.err
+	}
+	a.done[i-a.base] = true
+	for len(a.urls) > 0 && a.done[0] {
+		u := a.urls[0]
+		a.urls, a.done, a.base = a.urls[1:], a.done[1:], a.base+1
+		if data, ok := a.pending[u]; ok {
+			delete(a.pending, u)
+			if err := a.write(data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write writes data as the next element. The caller holds a.mu.
+func (a *jsonArray) write(data []byte) error {
+	if a.err != nil {
+		return a.err
+	}
+	sep := ",\n"
+	if a.n == 0 {
+		sep = "[\n"
+	}
+	if _, a.err = fmt.Fprintf(a.w, "%s%s", sep, data); a.err != nil {
+		return a.err
+	}
+	a.n++
+	return nil
+}
+
+// close ends the array; an array without elements is written as [].
+func (a *jsonArray) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	end := "\n]\n"
+	if a.n == 0 {
+		end = "[]\n"
+	}
+	_, a.err = io.WriteString(a.w, end)
+	return a.err
+}
+
+// recordPage adds the page at u to SingleJSON, when it is set.
+func (c *Converter) recordPage(u string, metadata map[string]interface{}, body string) error {
+	if c.pages == nil {
+		return nil
+	}
+	if err := c.pages.add(u, PageRecord{Source: u, Metadata: metadata, Body: body}); err != nil {
+		return newError(ErrWrite, u, fmt.Errorf("failed to write %s to the JSON output: %w", u, err))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// sitemapFileName is the name of the sitemap written by EmitSitemap.
+const sitemapFileName = "sitemap.xml"
+
+// sitemapNamespace is the XML namespace of the sitemap protocol.
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// maxSitemapURLs is the most URLs the sitemap protocol allows in one file.
+const maxSitemapURLs = 50000
+
+// sitemapURLSet is the root element of a sitemap.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapURL is the entry of one page in a sitemap.
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// writeSitemap writes sitemap.xml into the output directory, listing the
+// source URL of every successfully converted page in results once, in order,
+// with the time it was retrieved as its lastmod.
+func (c *Converter) writeSitemap(results []Result) error {
+	set := sitemapURLSet{Xmlns: sitemapNamespace}
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if !r.IsSuccess || seen[r.URL] {
+			continue
+		}
+		seen[r.URL] = true
+		entry := sitemapURL{Loc: r.URL}
+		if !r.Retrieved.IsZero() {
+			entry.LastMod = r.Retrieved.UTC().Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+	if len(set.URLs) > maxSitemapURLs {
+		log.Printf("WARNING: The sitemap lists %d URLs; search engines read at most %d from one file", len(set.URLs), maxSitemapURLs)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		return fmt.Errorf("failed to render sitemap: %w", err)
+	}
+	buf.WriteString("\n")
+	if err := c.writeFile(filepath.Join(c.OutputDir, sitemapFileName), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write sitemap: %w", err)
+	}
+	return nil
+}
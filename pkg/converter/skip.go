@@ -0,0 +1,41 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// skipSignal returns an ErrSkipSignal error when the page at u asks not to
+// be converted: it has an element matched by SkipSelector, or, with
+// SkipNoindex, a robots meta tag with noindex. It returns nil otherwise.
+func (c *Converter) skipSignal(doc *goquery.Document, u string) error {
+	if c.SkipSelector != "" && doc.Find(c.SkipSelector).Length() > 0 {
+		return newError(ErrSkipSignal, u, fmt.Errorf("%s matches skip selector '%s'", u, c.SkipSelector))
+	}
+	if c.SkipNoindex && isNoindex(doc) {
+		return newError(ErrSkipSignal, u, fmt.Errorf("%s is marked noindex", u))
+	}
+	return nil
+}
+
+// isNoindex reports whether doc has a <meta name="robots"> whose content
+// includes noindex, or none, which implies it.
+func isNoindex(doc *goquery.Document) bool {
+	noindex := false
+	doc.Find("meta[name]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if !strings.EqualFold(strings.TrimSpace(s.AttrOr("name", "")), "robots") {
+			return true
+		}
+		for _, directive := range strings.Split(s.AttrOr("content", ""), ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "noindex", "none":
+				noindex = true
+				return false
+			}
+		}
+		return true
+	})
+	return noindex
+}
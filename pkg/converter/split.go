@@ -0,0 +1,96 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// estimateTokens estimates the number of LLM tokens in text: about four
+// characters or three quarters of a word each, whichever gives more.
+func estimateTokens(text string) int {
+	return max(len(strings.Fields(text))*4/3, utf8.RuneCountInString(text)/4)
+}
+
+// splitTokens splits rendered Markdown into parts of at most limit estimated
+// tokens each, at paragraph boundaries. A fenced code block is never split,
+// and a paragraph longer than limit becomes a part of its own. Text within the
+// limit is returned as a single part.
+func splitTokens(text string, limit int) []string {
+	if estimateTokens(text) <= limit {
+		return []string{text}
+	}
+	var parts []string
+	var current []string
+	for _, block := range markdownBlocks(text) {
+		candidate := strings.Join(append(current, block), "\n\n")
+		if len(current) > 0 && estimateTokens(candidate) > limit {
+			parts = append(parts, strings.Join(current, "\n\n"))
+			current = nil
+		}
+		current = append(current, block)
+	}
+	return append(parts, strings.Join(current, "\n\n"))
+}
+
+// markdownBlocks splits Markdown into its blocks, the text between blank
+// lines, keeping each fenced code block whole however many blank lines it holds.
+func markdownBlocks(text string) []string {
+	var blocks []string
+	var lines []string
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			// The run of backticks or tildes that opens the block; one at least as long closes it
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+		case fence != "" && strings.HasPrefix(trimmed, fence) && strings.TrimLeft(trimmed, fence[:1]) == "":
+			fence = ""
+		case fence == "" && trimmed == "":
+			if len(lines) > 0 {
+				blocks = append(blocks, strings.Join(lines, "\n"))
+				lines = nil
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+	return blocks
+}
+
+// partFileName returns the name of part n of the page written to name.
+func partFileName(name string, n int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-part%d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// writeParts writes the parts of the page at u that SplitTokens split, each to
+// its own file named after filename, with the page metadata, its place
+// among the parts and, with ContentHash, the hash of the part itself. It
+// returns the names of the files written.
+func (c *Converter) writeParts(u, filename string, metadata map[string]interface{}, parts []string) ([]string, error) {
+	names := make([]string, len(parts))
+	for i, part := range parts {
+		partMetadata := make(map[string]interface{}, len(metadata)+2)
+		for key, value := range metadata {
+			partMetadata[key] = value
+		}
+		partMetadata["part"] = i + 1
+		partMetadata["parts"] = len(parts)
+		c.addContentHash(partMetadata, part)
+		header, err := c.frontmatter(partMetadata)
+		if err != nil {
+			return nil, newError(ErrRender, u, fmt.Errorf("failed to render frontmatter: %w", err))
+		}
+		names[i] = partFileName(filename, i+1)
+		if err := c.writeFile(filepath.Join(c.OutputDir, names[i]), append(header, part...)); err != nil {
+			return nil, newError(ErrWrite, u, fmt.Errorf("failed to write file: %w", err))
+		}
+	}
+	return names, nil
+}
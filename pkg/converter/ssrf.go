@@ -3,7 +3,6 @@
 package converter
 
 import (
-	"net"
 	"net/url"
 )
 
@@ -14,7 +13,7 @@ func (c *Converter) isPublicURL(urlStr string) (bool, error) {
 		return false, err
 	}
 
-	ips, err := net.LookupIP(parsedURL.Hostname())
+	ips, err := c.lookupIP(parsedURL.Hostname())
 	if err != nil {
 		return false, err
 	}
@@ -25,5 +24,9 @@ func (c *Converter) isPublicURL(urlStr string) (bool, error) {
 		}
 	}
 
+	if c.resolver != nil {
+		// The page is then fetched from these addresses, not from a new answer
+		c.resolver.approve(parsedURL.Hostname(), ips)
+	}
 	return true, nil
 }
@@ -0,0 +1,30 @@
+//go:build !integration
+
+package converter
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPublicURL_ApprovesCheckedAddresses(t *testing.T) {
+	c := &Converter{Client: &http.Client{}}
+	require.NoError(t, c.UseResolver("", map[string]string{
+		"docs.example.com":     "93.184.216.34",
+		"intranet.example.com": "10.0.0.5",
+	}))
+
+	public, err := c.isPublicURL("https://docs.example.com/guide")
+	require.NoError(t, err)
+	assert.True(t, public)
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34")}, c.resolver.approved["docs.example.com"])
+
+	public, err = c.isPublicURL("https://intranet.example.com/")
+	require.NoError(t, err)
+	assert.False(t, public)
+	assert.NotContains(t, c.resolver.approved, "intranet.example.com", "a blocked host is never approved")
+}
@@ -0,0 +1,68 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// redactedHeaders are traced with their values hidden.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// TraceRequests logs the request line and headers of every request the
+// Converter's client sends, and the status and headers of every response, to
+// logger. Credential and cookie headers are redacted. Call it before
+// UseDigestAuth so that the authenticated retries are traced too.
+func (c *Converter) TraceRequests(logger *log.Logger) {
+	c.Client.Transport = &traceTransport{logger: logger, next: transportOrDefault(c.Client.Transport)}
+}
+
+// traceTransport logs each exchange as two entries, so that lines from
+// concurrent requests don't interleave within an entry.
+type traceTransport struct {
+	logger *log.Logger
+	next   http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	t.logger.Printf("DEBUG: > %s %s %s\n> Host: %s%s", req.Method, req.URL, req.Proto, host, traceHeaders(">", req.Header))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logger.Printf("DEBUG: < %s %s failed: %v", req.Method, req.URL, err)
+		return nil, err
+	}
+	t.logger.Printf("DEBUG: < %s %s (%s %s)%s", resp.Proto, resp.Status, req.Method, req.URL, traceHeaders("<", resp.Header))
+	return resp, nil
+}
+
+// traceHeaders renders header as one prefixed line per value, sorted by name.
+func traceHeaders(prefix string, header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		for _, value := range header[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				value = "[REDACTED]"
+			}
+			fmt.Fprintf(&b, "\n%s %s: %s", prefix, name, value)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceRequests(t *testing.T) {
+	server := digestServer(t, "alice", "s3cret")
+
+	var trace bytes.Buffer
+	c := &Converter{Client: &http.Client{}}
+	c.TraceRequests(log.New(&trace, "", 0))
+	c.UseDigestAuth("alice", "s3cret", strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/docs/page", nil)
+	require.NoError(t, err)
+	req.Header.Set("Cookie", "session=abc123")
+	req.Header.Set("X-Request-Id", "42")
+	resp, err := c.Client.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	got := trace.String()
+	assert.Contains(t, got, "DEBUG: > GET "+server.URL+"/docs/page HTTP/1.1\n> Host: "+strings.TrimPrefix(server.URL, "http://"))
+	assert.Contains(t, got, "> X-Request-Id: 42")
+	assert.Contains(t, got, "DEBUG: < HTTP/1.1 401 Unauthorized (GET "+server.URL+"/docs/page)")
+	assert.Contains(t, got, "< Www-Authenticate: Digest realm=\"docs\"", "response headers should be traced")
+	assert.Contains(t, got, "DEBUG: < HTTP/1.1 200 OK", "the authenticated retry should be traced")
+
+	assert.Contains(t, got, "> Cookie: [REDACTED]")
+	assert.Contains(t, got, "> Authorization: [REDACTED]")
+	assert.NotContains(t, got, "abc123")
+	assert.NotContains(t, got, "Digest username", "credentials must never be traced")
+}
@@ -0,0 +1,46 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// How UseUserAgents picks the user agent of each request.
+const (
+	RotateRoundRobin = "round-robin"
+	RotateRandom     = "random"
+)
+
+// userAgentPool hands out user agents for requests.
+type userAgentPool struct {
+	agents []string
+	random bool
+	next   atomic.Uint64
+}
+
+// UseUserAgents sends every request with one of agents as its User-Agent
+// header: each in turn with RotateRoundRobin (the default for an empty
+// rotation), or one at random with RotateRandom. Pages rendered with RenderJS
+// get one for each browser run. Without it, Go's default user agent is sent.
+func (c *Converter) UseUserAgents(agents []string, rotation string) error {
+	if len(agents) == 0 {
+		return errors.New("no user agents given")
+	}
+	switch rotation {
+	case "", RotateRoundRobin, RotateRandom:
+	default:
+		return fmt.Errorf("invalid user-agent rotation '%s' (expected %s or %s)", rotation, RotateRoundRobin, RotateRandom)
+	}
+	c.userAgents = &userAgentPool{agents: agents, random: rotation == RotateRandom}
+	return nil
+}
+
+// pick returns the user agent for the next request.
+func (p *userAgentPool) pick() string {
+	if p.random {
+		return p.agents[rand.IntN(len(p.agents))]
+	}
+	return p.agents[(p.next.Add(1)-1)%uint64(len(p.agents))]
+}
@@ -1,8 +1,12 @@
 package converter
 
 import (
+	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // SanitizeFilename converts a string to a valid filename by:
@@ -22,3 +26,60 @@ func SanitizeFilename(s string) string {
 
 	return s
 }
+
+// byteSizeUnits maps the accepted size suffixes to their multipliers.
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "512KB", "5MB" or "1048576" into bytes.
+// Units are binary (1KB = 1024 bytes) and case-insensitive.
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * multiplier, nil
+}
+
+// timestampLayouts maps the named timestamp formats to Go time layouts.
+var timestampLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"iso8601":     "2006-01-02T15:04:05-0700",
+	"rfc1123":     time.RFC1123Z,
+	"date":        time.DateOnly,
+}
+
+// TimestampLayout resolves a timestamp format to a Go time layout. The format
+// is a name (rfc3339, rfc3339nano, iso8601, rfc1123 or date, case-insensitive)
+// or a layout such as "2006-01-02 15:04".
+func TimestampLayout(format string) (string, error) {
+	if layout, ok := timestampLayouts[strings.ToLower(format)]; ok {
+		return layout, nil
+	}
+	// A layout formats the reference time differently from its own text
+	if strings.TrimSpace(format) == "" || time.Unix(0, 0).Format(format) == format {
+		return "", fmt.Errorf("invalid timestamp format %q", format)
+	}
+	return format, nil
+}
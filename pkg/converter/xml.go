@@ -0,0 +1,465 @@
+package converter
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Input formats supported by Converter.InputFormat.
+const (
+	InputHTML = "html"
+	InputXML  = "xml"
+)
+
+// What an XML element is rendered as, in Converter.XMLElements. Elements
+// without a rule are not rendered themselves, but their content is.
+const (
+	XMLParagraph = "p"
+	XMLCodeBlock = "pre"
+	XMLCode      = "code"
+	XMLLink      = "a"       // Links to its url, href or linkend attribute
+	XMLHeading   = "heading" // A heading one level below the enclosing titled element's
+	XMLDrop      = "drop"    // Not rendered, nor its content
+)
+
+// IsValidInputFormat reports whether format names a supported input format.
+// An empty format selects HTML.
+func IsValidInputFormat(format string) bool {
+	switch format {
+	case "", InputHTML, InputXML:
+		return true
+	}
+	return false
+}
+
+// DocBookElements are the rendering rules for XML input, which XMLElements
+// can override or extend.
+var DocBookElements = map[string]string{
+	"para":           XMLParagraph,
+	"simpara":        XMLParagraph,
+	"title":          XMLHeading,
+	"programlisting": XMLCodeBlock,
+	"screen":         XMLCodeBlock,
+	"literallayout":  XMLCodeBlock,
+	"synopsis":       XMLCodeBlock,
+	"literal":        XMLCode,
+	"code":           XMLCode,
+	"command":        XMLCode,
+	"filename":       XMLCode,
+	"option":         XMLCode,
+	"varname":        XMLCode,
+	"function":       XMLCode,
+	"classname":      XMLCode,
+	"userinput":      XMLCode,
+	"computeroutput": XMLCode,
+	"ulink":          XMLLink,
+	"link":           XMLLink,
+	"remark":         XMLDrop,
+	"indexterm":      XMLDrop,
+	"titleabbrev":    XMLDrop,
+}
+
+// ParseXMLElement parses a rendering rule written as "element=target", such as
+// "note=p", where target is one of p, pre, code, a, heading or drop.
+func ParseXMLElement(s string) (name, target string, err error) {
+	name, target, ok := strings.Cut(s, "=")
+	name, target = strings.TrimSpace(name), strings.TrimSpace(target)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("'%s' is not element=target", s)
+	}
+	switch target {
+	case XMLParagraph, XMLCodeBlock, XMLCode, XMLLink, XMLHeading, XMLDrop:
+		return name, target, nil
+	}
+	return "", "", fmt.Errorf("invalid target '%s' for element '%s' (expected p, pre, code, a, heading or drop)", target, name)
+}
+
+// XMLPath selects elements of an XML document with a subset of XPath: element
+// names or *, each separated from the previous by / for a child or // for any
+// descendant, and optionally followed by [@attr], [@attr='value'] or a 1-based
+// position [n] among the elements its parent has that match so far. A path
+// without a leading slash matches anywhere in the document, as with //; an
+// empty path or / selects the root element.
+type XMLPath struct {
+	expr  string
+	steps []xmlStep
+}
+
+type xmlStep struct {
+	descendant bool
+	name       string // Local name, or * for any element
+	attr       string
+	value      string
+	hasValue   bool
+	position   int
+}
+
+// ParseXMLPath parses expr as an XMLPath.
+func ParseXMLPath(expr string) (*XMLPath, error) {
+	p := &XMLPath{expr: expr}
+	rest := strings.TrimSpace(expr)
+	if rest == "" || rest == "/" {
+		return p, nil
+	}
+	if !strings.HasPrefix(rest, "/") {
+		rest = "//" + rest // A relative path searches the whole document
+	}
+
+	for rest != "" {
+		var step xmlStep
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			step.descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			rest = rest[1:]
+		default:
+			return nil, fmt.Errorf("invalid XML path '%s': expected / before '%s'", expr, rest)
+		}
+
+		end := strings.IndexAny(rest, "/[")
+		if end < 0 {
+			end = len(rest)
+		}
+		step.name, rest = localName(rest[:end]), rest[end:]
+		if step.name == "" || (step.name != "*" && strings.ContainsAny(step.name, " \t*@='\"]")) {
+			return nil, fmt.Errorf("invalid XML path '%s': expected an element name or *", expr)
+		}
+
+		for strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid XML path '%s': unclosed [", expr)
+			}
+			if err := step.parsePredicate(strings.TrimSpace(rest[1:end])); err != nil {
+				return nil, fmt.Errorf("invalid XML path '%s': %w", expr, err)
+			}
+			rest = rest[end+1:]
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// parsePredicate adds the filter written between the brackets of a step.
+func (s *xmlStep) parsePredicate(pred string) error {
+	if n, err := strconv.Atoi(pred); err == nil {
+		if n < 1 {
+			return fmt.Errorf("position %d is not 1 or more", n)
+		}
+		s.position = n
+		return nil
+	}
+	attr, ok := strings.CutPrefix(pred, "@")
+	if !ok || s.attr != "" {
+		return fmt.Errorf("unsupported filter [%s]", pred)
+	}
+	if name, value, ok := strings.Cut(attr, "="); ok {
+		value = strings.TrimSpace(value)
+		if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+			return fmt.Errorf("the value in [%s] must be quoted", pred)
+		}
+		attr, s.value, s.hasValue = name, value[1:len(value)-1], true
+	}
+	s.attr = localName(strings.TrimSpace(attr))
+	if s.attr == "" {
+		return fmt.Errorf("unsupported filter [%s]", pred)
+	}
+	return nil
+}
+
+// String returns the path as it was parsed.
+func (p *XMLPath) String() string { return p.expr }
+
+// find returns the elements below doc that the path selects, in document order
+// for paths without a descendant step below another.
+func (p *XMLPath) find(doc *xmlNode) []*xmlNode {
+	if len(p.steps) == 0 {
+		return doc.elements()
+	}
+	nodes := []*xmlNode{doc}
+	for _, step := range p.steps {
+		var next []*xmlNode
+		seen := make(map[*xmlNode]bool)
+		for _, n := range nodes {
+			parents := []*xmlNode{n}
+			if step.descendant {
+				parents = n.descendantsOrSelf()
+			}
+			for _, parent := range parents {
+				position := 0
+				for _, child := range parent.elements() {
+					if !step.matches(child) {
+						continue
+					}
+					position++
+					if (step.position == 0 || position == step.position) && !seen[child] {
+						seen[child] = true
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (s *xmlStep) matches(n *xmlNode) bool {
+	if s.name != "*" && n.name != s.name {
+		return false
+	}
+	if s.attr == "" {
+		return true
+	}
+	value, ok := n.attr(s.attr)
+	return ok && (!s.hasValue || value == s.value)
+}
+
+// localName strips the namespace prefix of an element or attribute name.
+func localName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// xmlNode is an element of a parsed XML document, or the character data in
+// one when name is empty. The document itself is an unnamed node without text.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	parent   *xmlNode
+	children []*xmlNode
+}
+
+// parseXML reads an XML document. HTML entities, common in hand-written
+// DocBook, are understood; a malformed document is an error.
+func parseXML(r io.Reader) (*xmlNode, error) {
+	d := xml.NewDecoder(r)
+	d.Entity = xml.HTMLEntity
+
+	doc := &xmlNode{}
+	cur := doc
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := xml.CopyToken(tok).(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr, parent: cur}
+			cur.children = append(cur.children, n)
+			cur = n
+		case xml.EndElement:
+			cur = cur.parent
+		case xml.CharData:
+			if cur != doc {
+				cur.children = append(cur.children, &xmlNode{text: string(t), parent: cur})
+			}
+		}
+	}
+	if len(doc.elements()) == 0 {
+		return nil, errors.New("no root element")
+	}
+	return doc, nil
+}
+
+// elements returns the child elements of n.
+func (n *xmlNode) elements() []*xmlNode {
+	var elements []*xmlNode
+	for _, child := range n.children {
+		if child.name != "" {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// descendantsOrSelf returns n and every element below it, in document order.
+func (n *xmlNode) descendantsOrSelf() []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, child := range n.elements() {
+		nodes = append(nodes, child.descendantsOrSelf()...)
+	}
+	return nodes
+}
+
+// attr returns the value of the attribute of n with the given local name.
+func (n *xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// textContent returns the character data below n.
+func (n *xmlNode) textContent() string {
+	if n.name == "" {
+		return n.text
+	}
+	var b strings.Builder
+	for _, child := range n.children {
+		b.WriteString(child.textContent())
+	}
+	return b.String()
+}
+
+// title returns the title of n: a title child, or the title of its info
+// child, such as DocBook's <info> or <articleinfo>.
+func (n *xmlNode) title() (string, bool) {
+	for _, child := range n.elements() {
+		switch {
+		case child.name == "title":
+			return collapseWhitespace(child.textContent()), true
+		case strings.HasSuffix(child.name, "info"):
+			for _, info := range child.elements() {
+				if info.name == "title" {
+					return collapseWhitespace(info.textContent()), true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// isXMLContentType reports whether a Content-Type header value may be XML. A
+// missing or malformed header is given the benefit of the doubt.
+func isXMLContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return mediaType == "text/xml" || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// fetchXMLDocument fetches the XML document at urlStr and maps the element
+// selected by the XML path into an HTML document, titled after the element or
+// else the document root, which the rest of a conversion handles like a page.
+func (c *Converter) fetchXMLDocument(urlStr string, path string) (*goquery.Document, error) {
+	p, err := ParseXMLPath(path)
+	if err != nil {
+		return nil, newError(ErrSelectorNoMatch, urlStr, err)
+	}
+
+	resp, err := c.fetch(urlStr, c.ModifiedSince)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	root, err := parseXML(resp.Body)
+	if err != nil {
+		return nil, newError(fetchErrorKind(err), urlStr, fmt.Errorf("failed to read XML for %s: %w", urlStr, err))
+	}
+
+	matches := p.find(root)
+	if len(matches) == 0 {
+		return nil, newError(ErrSelectorNoMatch, urlStr, fmt.Errorf("could not find content in %s using XML path '%s'", urlStr, path))
+	}
+	i := 0
+	if c.SelectorIndex != 0 {
+		// 1-based from the start, or counting back from the end when negative
+		i = c.SelectorIndex - 1
+		if c.SelectorIndex < 0 {
+			i = len(matches) + c.SelectorIndex
+		}
+		if i < 0 || i >= len(matches) {
+			return nil, newError(ErrSelectorNoMatch, urlStr, fmt.Errorf("XML path '%s' matched %d elements in %s; index %d is out of range",
+				path, len(matches), urlStr, c.SelectorIndex))
+		}
+	}
+	selected := matches[i]
+
+	title, ok := selected.title()
+	if !ok {
+		title, _ = root.elements()[0].title()
+	}
+	var b strings.Builder
+	b.WriteString("<html><head><title>" + html.EscapeString(title) + "</title></head><body>")
+	c.writeXMLAsHTML(&b, selected, 0)
+	b.WriteString("</body></html>")
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(b.String()))
+	if err != nil {
+		return nil, newError(ErrRender, urlStr, fmt.Errorf("failed to map the XML of %s: %w", urlStr, err))
+	}
+	return doc, nil
+}
+
+// xmlElement returns the rendering rule for the element name: XMLElements,
+// then DocBookElements.
+func (c *Converter) xmlElement(name string) string {
+	if target, ok := c.XMLElements[name]; ok {
+		return target
+	}
+	return DocBookElements[name]
+}
+
+// writeXMLAsHTML writes n to b as the HTML its rendering rule maps it to.
+// depth is the number of titled elements n is in, which sets heading levels.
+func (c *Converter) writeXMLAsHTML(b *strings.Builder, n *xmlNode, depth int) {
+	if n.name == "" {
+		b.WriteString(html.EscapeString(n.text))
+		return
+	}
+
+	children := func(depth int) {
+		for _, child := range n.children {
+			c.writeXMLAsHTML(b, child, depth)
+		}
+	}
+	switch c.xmlElement(n.name) {
+	case XMLParagraph:
+		b.WriteString("<p>")
+		children(depth)
+		b.WriteString("</p>")
+	case XMLCodeBlock:
+		b.WriteString("<pre")
+		if lang, ok := n.attr("language"); ok && lang != "" {
+			b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+		}
+		b.WriteString(">" + html.EscapeString(n.textContent()) + "</pre>")
+	case XMLCode:
+		b.WriteString("<code>" + html.EscapeString(n.textContent()) + "</code>")
+	case XMLLink:
+		href, ok := n.attr("url")
+		if !ok {
+			href, ok = n.attr("href")
+		}
+		if linkend, found := n.attr("linkend"); !ok && found {
+			href, ok = "#"+linkend, true
+		}
+		if ok {
+			b.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+		}
+		children(depth)
+		if ok {
+			b.WriteString("</a>")
+		}
+	case XMLHeading:
+		level := min(max(depth, 1), 6)
+		fmt.Fprintf(b, "<h%d>%s</h%d>", level, html.EscapeString(n.textContent()), level)
+	case XMLDrop:
+	default:
+		if _, titled := n.title(); titled {
+			depth++
+		}
+		children(depth)
+	}
+}
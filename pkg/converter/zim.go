@@ -0,0 +1,538 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+)
+
+// The archive follows version 6.1 of the ZIM format, the one of offline
+// readers such as Kiwix, with its namespace scheme of that version: pages in
+// C, metadata in M and the main page in W. Clusters are stored uncompressed,
+// which every reader supports.
+const (
+	zimMagic        = 72173914
+	zimMajorVersion = 6
+	zimMinorVersion = 1
+	zimHeaderSize   = 80
+	zimNoPage       = 0xffffffff
+	zimRedirect     = 0xffff  // The MIME type index of a redirect entry
+	zimUncompressed = 1       // The compression byte of a cluster
+	zimClusterSize  = 1 << 20 // Blobs are grouped into clusters of about this size
+)
+
+// zimMimeTypes are the MIME types of the entries, which refer to them by index.
+var zimMimeTypes = []string{"text/html", "text/plain"}
+
+var zimPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+{{.Body}}
+<hr>
+<p><small>Source: <a href="{{.Source}}">{{.Source}}</a></small></p>
+</body>
+</html>
+`))
+
+var zimIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{- range .Entries}}
+<li><a href="{{.Href}}">{{.Title}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// zimPage is a page added to a zimArchive.
+type zimPage struct {
+	url   string
+	path  string // In the C namespace, e.g. guide.html
+	title string
+	blob  zimBlob
+}
+
+// zimBlob is the content of an entry: data, or size bytes at offset in the spool.
+type zimBlob struct {
+	data   []byte
+	offset int64
+	size   int64
+}
+
+// zimEntry is an entry of the archive: content, or a redirect to another entry.
+type zimEntry struct {
+	namespace byte
+	path      string
+	title     string
+	mime      uint16 // An index into zimMimeTypes, or zimRedirect
+	target    string // The C path a redirect points to
+	blob      zimBlob
+	cluster   uint32
+	blobIndex uint32
+}
+
+// key orders the entries of the archive by namespace and path.
+func (e *zimEntry) key() string { return string(e.namespace) + "/" + e.path }
+
+// titleKey orders the entries of the archive by namespace and title, which
+// defaults to the path.
+func (e *zimEntry) titleKey() string {
+	if e.title == "" {
+		return e.key()
+	}
+	return string(e.namespace) + "/" + e.title
+}
+
+// zimArchive collects the pages of a run into a ZIM archive written to w.
+// An archive lists its entries, sorted, ahead of their content, so it can
+// only be written once the run is done: until then the pages are spooled to a
+// temporary file and never held in memory.
+type zimArchive struct {
+	mu    sync.Mutex
+	w     io.Writer
+	title string
+	spool *os.File
+	end   int64 // The size of the spool
+	pages []zimPage
+	err   error // The first spooling error; later pages are skipped
+}
+
+func newZIMArchive(w io.Writer, title string) *zimArchive {
+	return &zimArchive{w: w, title: title}
+}
+
+// add spools the extracted HTML content of the page at u, written to the
+// output file name with its title, as an entry of the archive.
+func (a *zimArchive) add(u, name, title, content string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	if a.spool == nil {
+		if a.spool, a.err = os.CreateTemp("", "doc-converter-zim-*"); a.err != nil {
+			return a.err
+		}
+	}
+	if _, a.err = a.spool.WriteAt([]byte(content), a.end); a.err != nil {
+		return a.err
+	}
+	a.pages = append(a.pages, zimPage{
+		url:   u,
+		path:  strings.TrimSuffix(filepath.ToSlash(name), filepath.Ext(name)) + ".html",
+		title: title,
+		blob:  zimBlob{offset: a.end, size: int64(len(content))},
+	})
+	a.end += int64(len(content))
+	return nil
+}
+
+// close writes the archive of the pages added, listed on its main page in the
+// order of urls, and removes the spool. created dates the archive.
+func (a *zimArchive) close(urls []string, created time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.spool != nil {
+		defer os.Remove(a.spool.Name())
+		defer a.spool.Close()
+	}
+	if a.err != nil {
+		return a.err
+	}
+
+	pages := a.orderedPages(urls)
+	paths := make(map[string]string, len(pages)) // Canonical URL to the page's path
+	taken := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		paths[canonicalURL(p.url)] = p.path
+		taken[p.path] = true
+	}
+
+	entries := make([]*zimEntry, 0, len(pages)+7)
+	for _, p := range pages {
+		content := make([]byte, p.blob.size)
+		if _, err := a.spool.ReadAt(content, p.blob.offset); err != nil {
+			return fmt.Errorf("failed to read spooled page %s: %w", p.url, err)
+		}
+		page, err := zimPageHTML(p, content, paths)
+		if err != nil {
+			return fmt.Errorf("failed to render %s for the archive: %w", p.url, err)
+		}
+		// Spooled again, so that only one page at a time is in memory
+		if _, err := a.spool.WriteAt(page, a.end); err != nil {
+			return fmt.Errorf("failed to spool page %s: %w", p.url, err)
+		}
+		entries = append(entries, &zimEntry{namespace: 'C', path: p.path, title: p.title, blob: zimBlob{offset: a.end, size: int64(len(page))}})
+		a.end += int64(len(page))
+	}
+
+	title := a.title
+	var hosts []string
+	for _, p := range pages {
+		if parsed, err := url.Parse(p.url); err == nil && parsed.Host != "" && !containsString(hosts, parsed.Host) {
+			hosts = append(hosts, parsed.Host)
+		}
+	}
+	if title == "" {
+		title = "Converted pages"
+		if len(hosts) == 1 {
+			title = hosts[0]
+		}
+	}
+
+	// The main page lists the pages; it takes a path no page has
+	mainPath := "index.html"
+	for n := 2; taken[mainPath]; n++ {
+		mainPath = fmt.Sprintf("index-%d.html", n)
+	}
+	index, err := zimIndexHTML(title, mainPath, pages)
+	if err != nil {
+		return err
+	}
+	entries = append(entries,
+		&zimEntry{namespace: 'C', path: mainPath, title: title, blob: zimBlob{data: index}},
+		&zimEntry{namespace: 'W', path: "mainPage", mime: zimRedirect, target: mainPath},
+	)
+	metadata := map[string]string{
+		"Title":       title,
+		"Description": "Pages converted with doc-converter",
+		"Creator":     strings.Join(hosts, ", "),
+		"Publisher":   "doc-converter",
+		"Date":        created.Format("2006-01-02"),
+	}
+	for name, value := range metadata {
+		entries = append(entries, &zimEntry{namespace: 'M', path: name, mime: 1, blob: zimBlob{data: []byte(value)}})
+	}
+	return writeZIM(a.w, entries, a.spool, 'C', mainPath)
+}
+
+// orderedPages returns the pages added in the order of their URLs in urls,
+// keeping only the last page added for a path, as for a URL converted twice.
+func (a *zimArchive) orderedPages(urls []string) []zimPage {
+	latest := make(map[string]int, len(a.pages))
+	for i, p := range a.pages {
+		latest[p.path] = i
+	}
+	var pages []zimPage
+	for i, p := range a.pages {
+		if latest[p.path] == i {
+			pages = append(pages, p)
+		}
+	}
+	position := make(map[string]int, len(urls))
+	for i, u := range urls {
+		if _, seen := position[u]; !seen {
+			position[u] = i
+		}
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		return position[pages[i].url] < position[pages[j].url]
+	})
+	return pages
+}
+
+// zimPageHTML returns the page p, with its extracted HTML content, as a
+// document of the archive. Links to the other pages of the archive point to
+// them; other relative links and images are resolved against the page's URL,
+// so that they lead to the web.
+func zimPageHTML(p zimPage, content []byte, paths map[string]string) ([]byte, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		ref, err := url.Parse(strings.TrimSpace(a.AttrOr("href", "")))
+		if err != nil || (ref.Scheme == "" && ref.Host == "" && ref.Path == "" && ref.RawQuery == "") {
+			return // Unparsable, or a fragment of the page itself
+		}
+		target := base.ResolveReference(ref)
+		if targetPath, ok := paths[canonicalURL(target.String())]; ok {
+			href := relativeZIMPath(p.path, targetPath)
+			if target.Fragment != "" {
+				href += "#" + target.EscapedFragment()
+			}
+			a.SetAttr("href", href)
+			return
+		}
+		a.SetAttr("href", target.String())
+	})
+	doc.Find("img[src]").Each(func(_ int, img *goquery.Selection) {
+		if ref, err := url.Parse(strings.TrimSpace(img.AttrOr("src", ""))); err == nil {
+			img.SetAttr("src", base.ResolveReference(ref).String())
+		}
+	})
+	body, err := doc.Find("body").Html()
+	if err != nil {
+		return nil, err
+	}
+	title := p.title
+	if title == "" {
+		title = p.path
+	}
+
+	var buf bytes.Buffer
+	err = zimPageTemplate.Execute(&buf, struct {
+		Title  string
+		Body   template.HTML
+		Source string
+	}{title, template.HTML(body), p.url})
+	return buf.Bytes(), err
+}
+
+// zimIndexHTML returns the main page of the archive, at mainPath, which links
+// every page by its title.
+func zimIndexHTML(title, mainPath string, pages []zimPage) ([]byte, error) {
+	entries := make([]indexEntry, len(pages))
+	for i, p := range pages {
+		entries[i] = indexEntry{Href: relativeZIMPath(mainPath, p.path), Title: p.title, Source: p.url}
+		if entries[i].Title == "" {
+			entries[i].Title = p.path
+		}
+	}
+	var buf bytes.Buffer
+	if err := zimIndexTemplate.Execute(&buf, struct {
+		Title   string
+		Entries []indexEntry
+	}{title, entries}); err != nil {
+		return nil, fmt.Errorf("failed to render the archive's main page: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// relativeZIMPath returns the relative URL of the archive path target from
+// the page at the archive path from.
+func relativeZIMPath(from, target string) string {
+	fromDir := strings.Split(path.Dir(from), "/")
+	if fromDir[0] == "." {
+		fromDir = nil
+	}
+	targetParts := strings.Split(target, "/")
+	common := 0
+	for common < len(fromDir) && common < len(targetParts)-1 && fromDir[common] == targetParts[common] {
+		common++
+	}
+	rel := strings.Repeat("../", len(fromDir)-common) + strings.Join(targetParts[common:], "/")
+	return strings.TrimPrefix(relativeHref(rel), "./")
+}
+
+// containsString reports whether values holds s.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeZIM writes entries as a ZIM archive to w, with the entry at mainPath
+// in mainNamespace as its main page. Blobs not held in memory are read from
+// spool.
+func writeZIM(w io.Writer, entries []*zimEntry, spool io.ReaderAt, mainNamespace byte, mainPath string) error {
+	// Entries are found by binary search, in path order and in title order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key() < entries[j].key() })
+	index := make(map[string]uint32, len(entries))
+	for i, e := range entries {
+		index[e.key()] = uint32(i)
+	}
+	titleOrder := make([]uint32, len(entries))
+	for i := range titleOrder {
+		titleOrder[i] = uint32(i)
+	}
+	sort.SliceStable(titleOrder, func(i, j int) bool {
+		return entries[titleOrder[i]].titleKey() < entries[titleOrder[j]].titleKey()
+	})
+
+	// Group the blobs into clusters, in path order
+	var clusters [][]*zimEntry
+	var clusterBytes int64
+	for _, e := range entries {
+		if e.mime == zimRedirect {
+			continue
+		}
+		if len(clusters) == 0 || clusterBytes+e.blob.length() > zimClusterSize && len(clusters[len(clusters)-1]) > 0 {
+			clusters = append(clusters, nil)
+			clusterBytes = 0
+		}
+		last := len(clusters) - 1
+		e.cluster, e.blobIndex = uint32(last), uint32(len(clusters[last]))
+		clusters[last] = append(clusters[last], e)
+		clusterBytes += e.blob.length()
+	}
+
+	// Lay out the file: header, MIME types, path and title pointers, entries,
+	// cluster pointers, clusters and the checksum
+	mimeListSize := int64(1)
+	for _, mime := range zimMimeTypes {
+		mimeListSize += int64(len(mime)) + 1
+	}
+	pathPtrPos := zimHeaderSize + mimeListSize
+	titlePtrPos := pathPtrPos + 8*int64(len(entries))
+	entryPos := titlePtrPos + 4*int64(len(entries))
+	entryOffsets := make([]int64, len(entries))
+	offset := entryPos
+	for i, e := range entries {
+		entryOffsets[i] = offset
+		offset += int64(len(e.dirent(index)))
+	}
+	clusterPtrPos := offset
+	clusterOffsets := make([]int64, len(clusters))
+	offset += 8 * int64(len(clusters))
+	for i, cluster := range clusters {
+		clusterOffsets[i] = offset
+		offset += 1 + 4*int64(len(cluster)+1)
+		for _, e := range cluster {
+			offset += e.blob.length()
+		}
+	}
+	checksumPos := offset
+
+	mainPage, ok := index[string(mainNamespace)+"/"+mainPath]
+	if !ok {
+		mainPage = zimNoPage
+	}
+	sum := md5.New()
+	out := bufio.NewWriter(io.MultiWriter(w, sum))
+	id := uuid.New()
+	var header []byte
+	header = binary.LittleEndian.AppendUint32(header, zimMagic)
+	header = binary.LittleEndian.AppendUint16(header, zimMajorVersion)
+	header = binary.LittleEndian.AppendUint16(header, zimMinorVersion)
+	header = append(header, id[:]...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(entries)))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(clusters)))
+	header = binary.LittleEndian.AppendUint64(header, uint64(pathPtrPos))
+	header = binary.LittleEndian.AppendUint64(header, uint64(titlePtrPos))
+	header = binary.LittleEndian.AppendUint64(header, uint64(clusterPtrPos))
+	header = binary.LittleEndian.AppendUint64(header, zimHeaderSize) // The MIME type list follows the header
+	header = binary.LittleEndian.AppendUint32(header, mainPage)
+	header = binary.LittleEndian.AppendUint32(header, zimNoPage) // No layout page
+	header = binary.LittleEndian.AppendUint64(header, uint64(checksumPos))
+	for _, mime := range zimMimeTypes {
+		header = append(append(header, mime...), 0)
+	}
+	header = append(header, 0)
+	for _, o := range entryOffsets {
+		header = binary.LittleEndian.AppendUint64(header, uint64(o))
+	}
+	for _, i := range titleOrder {
+		header = binary.LittleEndian.AppendUint32(header, i)
+	}
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := out.Write(e.dirent(index)); err != nil {
+			return err
+		}
+	}
+	var pointers []byte
+	for _, o := range clusterOffsets {
+		pointers = binary.LittleEndian.AppendUint64(pointers, uint64(o))
+	}
+	if _, err := out.Write(pointers); err != nil {
+		return err
+	}
+
+	for _, cluster := range clusters {
+		// The blob offsets count from the end of the compression byte, the
+		// first one past the offsets themselves
+		head := []byte{zimUncompressed}
+		blobOffset := uint32(4 * (len(cluster) + 1))
+		head = binary.LittleEndian.AppendUint32(head, blobOffset)
+		for _, e := range cluster {
+			blobOffset += uint32(e.blob.length())
+			head = binary.LittleEndian.AppendUint32(head, blobOffset)
+		}
+		if _, err := out.Write(head); err != nil {
+			return err
+		}
+		for _, e := range cluster {
+			if e.blob.data != nil {
+				if _, err := out.Write(e.blob.data); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := io.Copy(out, io.NewSectionReader(spool, e.blob.offset, e.blob.size)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(sum.Sum(nil))
+	return err
+}
+
+// length returns the size of the blob.
+func (b zimBlob) length() int64 {
+	if b.data != nil {
+		return int64(len(b.data))
+	}
+	return b.size
+}
+
+// dirent encodes the directory entry of e; index gives the position of each
+// entry in path order, which a redirect points to.
+func (e *zimEntry) dirent(index map[string]uint32) []byte {
+	var b []byte
+	b = binary.LittleEndian.AppendUint16(b, e.mime)
+	b = append(b, 0, e.namespace)              // No extra parameters
+	b = binary.LittleEndian.AppendUint32(b, 0) // Revision
+	if e.mime == zimRedirect {
+		b = binary.LittleEndian.AppendUint32(b, index["C/"+e.target])
+	} else {
+		b = binary.LittleEndian.AppendUint32(b, e.cluster)
+		b = binary.LittleEndian.AppendUint32(b, e.blobIndex)
+	}
+	title := e.title
+	if title == e.path {
+		title = "" // Readers default the title to the path
+	}
+	b = append(append(b, e.path...), 0)
+	return append(append(b, title...), 0)
+}
+
+// recordZIMPage adds the page at u, written to name, to the ZIM archive of
+// the run, if any.
+func (c *Converter) recordZIMPage(u, name, title, content string) error {
+	if c.zim == nil {
+		return nil
+	}
+	if err := c.zim.add(u, name, title, content); err != nil {
+		return newError(ErrWrite, u, fmt.Errorf("failed to add %s to the ZIM archive: %w", u, err))
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+//go:build integration
+// +build integration
+
+package server
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setDownloadID makes the conversions of a test use a fixed download ID.
+func setDownloadID(t *testing.T, id string) {
+	t.Helper()
+	original := newDownloadID
+	newDownloadID = func() string { return id }
+	t.Cleanup(func() {
+		newDownloadID = original
+		os.RemoveAll("tmp")
+	})
+}
+
+func TestConversionHandler_SubmitAndDownload(t *testing.T) {
+	setDownloadID(t, "fixed-id")
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Content of %s</p></main></body></html>", r.URL.Path[1:], r.URL.Path[1:])
+	}))
+	defer pages.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/convert-ws", conversionHandler)
+	mux.HandleFunc("/api/download/", downloadHandler)
+	api := httptest.NewServer(mux)
+	defer api.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(api.URL, "http")+"/api/convert-ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(ConversionRequest{URLs: []string{pages.URL + "/intro", pages.URL + "/guide", pages.URL + "/gone"}, Selector: "main"}))
+
+	var completion struct {
+		Type        string `json:"type"`
+		Level       string `json:"level"`
+		Message     string `json:"message"`
+		URL         string `json:"url"`
+		Status      string `json:"status"`
+		DownloadURL string `json:"download_url"`
+		Summary     struct {
+			Successful int    `json:"successful"`
+			DownloadID string `json:"downloadId"`
+		} `json:"summary"`
+	}
+	var logs []string
+	for completion.Status != "completed" {
+		completion.Type = ""
+		require.NoError(t, conn.ReadJSON(&completion))
+		if completion.Type == "log" {
+			logs = append(logs, completion.Level+" "+completion.URL+" "+completion.Message)
+		}
+	}
+	gone := pages.URL + "/gone"
+	assert.Equal(t, []string{"error " + gone + " Failed to process " + gone + ": failed to fetch URL " + gone + ": HTTP status 404"}, logs,
+		"the converter's log lines are relayed to the client")
+	assert.Equal(t, "fixed-id", completion.Summary.DownloadID)
+	assert.Equal(t, "/api/download/fixed-id", completion.DownloadURL)
+	assert.Equal(t, 2, completion.Summary.Successful)
+	assert.FileExists(t, filepath.Join("tmp", "downloads", "fixed-id", "page_intro.md"))
+
+	resp, err := http.Get(api.URL + completion.DownloadURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `attachment; filename="fixed-id.zip"`, resp.Header.Get("Content-Disposition"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.ElementsMatch(t, []string{"page_intro.md", "page_guide.md"}, names)
+}
+
+func TestConversionHandler_Ordered(t *testing.T) {
+	setDownloadID(t, "ordered-id")
+	// Each page answers later than the one after it, so unordered they complete in reverse
+	delays := map[string]time.Duration{"/one": 150 * time.Millisecond, "/two": 100 * time.Millisecond, "/three": 50 * time.Millisecond}
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(delays[r.URL.Path])
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Content of %s</p></main></body></html>", r.URL.Path[1:], r.URL.Path[1:])
+	}))
+	defer pages.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(conversionHandler))
+	defer api.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(api.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	urls := []string{pages.URL + "/one", pages.URL + "/two", pages.URL + "/three"}
+	require.NoError(t, conn.WriteJSON(ConversionRequest{URLs: urls, Selector: "main", Ordered: true}))
+
+	var received []string
+	for {
+		var msg struct {
+			Type   string `json:"type"`
+			URL    string `json:"url"`
+			Status string `json:"status"`
+		}
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg.Status == "completed" {
+			break
+		}
+		if msg.Type != "log" {
+			received = append(received, msg.URL)
+		}
+	}
+	assert.Equal(t, urls, received, "results follow the order of the request")
+	assert.Equal(t, 1, maxInFlight, "one page is fetched at a time")
+}
+
+func TestConvertStreamHandler(t *testing.T) {
+	setDownloadID(t, "stream-id")
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><main><p>Content of %s</p></main></body></html>", r.URL.Path[1:], r.URL.Path[1:])
+	}))
+	defer pages.Close()
+	api := httptest.NewServer(http.HandlerFunc(convertStreamHandler))
+	defer api.Close()
+
+	query := url.Values{"url": {pages.URL + "/intro", pages.URL + "/gone"}, "selector": {"main"}, "ordered": {"true"}}
+	resp, err := http.Get(api.URL + "/api/convert-stream?" + query.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), "each line is a JSON object: %s", scanner.Text())
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, lines, 4, "two results, the log line of the failure and the completion message")
+	assert.Equal(t, pages.URL+"/intro", lines[0]["url"])
+	assert.Equal(t, true, lines[0]["isSuccess"])
+	gone := pages.URL + "/gone"
+	assert.Equal(t, map[string]interface{}{"type": "log", "level": "error", "url": gone, "message": "Failed to process " + gone + ": failed to fetch URL " + gone + ": HTTP status 404"}, lines[1])
+	assert.Equal(t, gone, lines[2]["url"])
+	completion := lines[3]
+	assert.Equal(t, "completed", completion["status"])
+	assert.Equal(t, "/api/download/stream-id", completion["download_url"])
+	assert.FileExists(t, filepath.Join("tmp", "downloads", "stream-id", "page_intro.md"))
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultRetention is how long a download is kept when neither the job nor
+// DOC_CONVERTER_RETENTION says otherwise.
+const defaultRetention = 24 * time.Hour
+
+// defaultMaxRetention is the longest retention a job may ask for when
+// DOC_CONVERTER_MAX_RETENTION is unset.
+const defaultMaxRetention = 7 * 24 * time.Hour
+
+// janitorInterval is how often expired downloads are looked for.
+const janitorInterval = time.Minute
+
+// janitor deletes downloads once their retention has passed. The expiry of
+// each job is kept as the job completes; a download without one, such as a job
+// still running or one left by an earlier server, expires the default
+// retention after it was last modified.
+type janitor struct {
+	mu           sync.Mutex
+	dir          string
+	retention    time.Duration
+	maxRetention time.Duration
+	expiries     map[string]time.Time // By download ID
+}
+
+// downloads looks after the download directories of all conversions.
+var downloads = newJanitor(filepath.Join("tmp", "downloads"), defaultRetention, defaultMaxRetention)
+
+func newJanitor(dir string, retention, maxRetention time.Duration) *janitor {
+	return &janitor{dir: dir, retention: retention, maxRetention: maxRetention, expiries: make(map[string]time.Time)}
+}
+
+// retentionFor returns how long the download of a job asking for the given
+// retention, a duration such as "30m", is kept: the default when it is
+// empty, and at most the maximum retention.
+func (j *janitor) retentionFor(requested string) (time.Duration, error) {
+	if requested == "" {
+		return j.retention, nil
+	}
+	retention, err := time.ParseDuration(requested)
+	if err != nil || retention <= 0 {
+		return 0, fmt.Errorf("invalid retention %q: must be a positive duration such as 30m or 72h", requested)
+	}
+	if retention > j.maxRetention {
+		log.Printf("INFO: Capping requested retention %s at %s", retention, j.maxRetention)
+		retention = j.maxRetention
+	}
+	return retention, nil
+}
+
+// keep records that the download id expires at until.
+func (j *janitor) keep(id string, until time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.expiries[id] = until
+}
+
+// sweep deletes the downloads that have expired at now and returns their IDs.
+func (j *janitor) sweep(now time.Time) []string {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: Failed to list downloads in %s: %v", j.dir, err)
+		}
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var removed []string
+	for _, entry := range entries {
+		id := entry.Name()
+		expiry, ok := j.expiries[id]
+		if !ok {
+			info, err := entry.Info()
+			if err != nil {
+				continue // Removed since it was listed
+			}
+			expiry = info.ModTime().Add(j.retention)
+		}
+		if now.Before(expiry) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(j.dir, id)); err != nil {
+			log.Printf("ERROR: Failed to delete expired download %s: %v", id, err)
+			continue
+		}
+		delete(j.expiries, id)
+		log.Printf("INFO: Deleted download %s, expired at %s", id, expiry.Format(time.RFC3339))
+		removed = append(removed, id)
+	}
+	return removed
+}
+
+// run sweeps the downloads every interval, forever.
+func (j *janitor) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		j.sweep(now)
+	}
+}
+
+// newRetention reads the default and maximum retention of downloads from
+// DOC_CONVERTER_RETENTION and DOC_CONVERTER_MAX_RETENTION, durations such as "72h".
+func newRetention() (retention, maxRetention time.Duration, err error) {
+	retention, maxRetention = defaultRetention, defaultMaxRetention
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"DOC_CONVERTER_RETENTION", &retention},
+		{"DOC_CONVERTER_MAX_RETENTION", &maxRetention},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid %s %q: must be a positive duration such as 72h", v.name, raw)
+		}
+		*v.value = d
+	}
+	if retention > maxRetention {
+		return 0, 0, fmt.Errorf("DOC_CONVERTER_RETENTION %s exceeds DOC_CONVERTER_MAX_RETENTION %s", retention, maxRetention)
+	}
+	return retention, maxRetention, nil
+}
@@ -4,23 +4,67 @@ import (
 	"archive/zip"
 	"doc-converter/pkg/converter"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // ConversionRequest is the structure of the JSON request from the client
 type ConversionRequest struct {
-	URLs     []string `json:"urls"`
-	Selector string   `json:"selector"`
+	URLs      []string `json:"urls"`
+	Selector  string   `json:"selector"`
+	Retention string   `json:"retention,omitempty"` // How long the download is kept, e.g. "30m"; capped by the server
+	Ordered   bool     `json:"ordered,omitempty"`   // Convert the URLs one at a time, in the order given
 }
 
+// changeMonitor is shared by all conversions when change monitoring is enabled.
+var changeMonitor *converter.ChangeMonitor
+
+// defaultMaxDownloadSize is the largest total size of the files in a download
+// when DOC_CONVERTER_MAX_DOWNLOAD_SIZE is unset.
+const defaultMaxDownloadSize = 1 << 30 // 1GB
+
+// maxDownloadSize is the largest total size of the files zipped for a download.
+var maxDownloadSize int64 = defaultMaxDownloadSize
+
+// defaultMaxDownloads is the number of downloads zipped at once when
+// DOC_CONVERTER_MAX_DOWNLOADS is unset.
+const defaultMaxDownloads = 4
+
+// downloadSlots holds a token for each download in progress; requests beyond
+// its capacity are turned away with a 503 rather than queued.
+var downloadSlots = make(chan struct{}, defaultMaxDownloads)
+
+// downloadRetryAfter is the Retry-After sent with a 503, in seconds.
+const downloadRetryAfter = "5"
+
+// slowestURLs is the number of slowest pages named when a conversion completes.
+const slowestURLs = 5
+
+// maxJobLogLines is the number of log lines relayed to the client of one
+// conversion; later lines are only written to the server log.
+const maxJobLogLines = 500
+
+// verbose logs the time taken by each page of a conversion, at debug level.
+var verbose bool
+
+// newDownloadID returns the ID of a new conversion's download, a random UUID,
+// passed to converter.NewDownloadConverter. Tests replace it to know the
+// download path in advance.
+var newDownloadID = func() string { return uuid.New().String() }
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		// TODO: Restrict this to your frontend's origin in production
@@ -54,34 +98,241 @@ func conversionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.URLs) == 0 || req.Selector == "" {
-		log.Printf("ERROR: Missing URLs or selector in request")
-		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInvalidFramePayloadData, "URLs and selector are required"))
+	c, retention, refused := newJob(req)
+	if refused != nil {
+		log.Printf("ERROR: Refused conversion request: %v", refused.err)
+		code := websocket.CloseInvalidFramePayloadData
+		if refused.internal {
+			code = websocket.CloseInternalServerErr
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, refused.reason))
 		return
 	}
+	runJob(c, req, retention, conn)
+}
 
-	// Instantiate the converter. Passing an empty string for outputDir triggers
-	// the creation of a temporary directory for this conversion.
-	c, err := converter.NewConverter("")
-	if err != nil {
-		log.Printf("ERROR: Failed to create new converter: %v", err)
-		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "Failed to initialize converter"))
+// convertStreamHandler runs a conversion given by the query parameters of a
+// GET request (url, repeated, selector, retention and ordered), streaming its
+// results, log lines and completion message as JSON lines, for clients that
+// would rather read a response than speak WebSocket.
+func convertStreamHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("INFO: Received new streaming conversion request")
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	query := r.URL.Query()
+	req := ConversionRequest{URLs: query["url"], Selector: query.Get("selector"), Retention: query.Get("retention")}
+	if raw := query.Get("ordered"); raw != "" {
+		ordered, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid ordered %q: must be true or false", raw), http.StatusBadRequest)
+			return
+		}
+		req.Ordered = ordered
+	}
+	c, retention, refused := newJob(req)
+	if refused != nil {
+		log.Printf("ERROR: Refused conversion request: %v", refused.err)
+		status := http.StatusBadRequest
+		if refused.internal {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, refused.reason, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	stream := &ndjsonWriter{w: w, done: r.Context().Done()}
+	stream.flush()
+	runJob(c, req, retention, stream)
+}
+
+// jobError is a conversion request refused before it starts. reason is sent
+// to the client; internal marks a failure of the server rather than of the request.
+type jobError struct {
+	reason   string
+	internal bool
+	err      error // What is logged
+}
+
+// newJob checks req and creates the converter of its conversion, which writes
+// into a new temporary directory named after the download ID, and returns it
+// with the retention of the download.
+func newJob(req ConversionRequest) (*converter.Converter, time.Duration, *jobError) {
+	if len(req.URLs) == 0 {
+		return nil, 0, &jobError{reason: "URLs are required", err: errors.New("missing URLs in request")}
+	}
+	retention, err := downloads.retentionFor(req.Retention)
+	if err != nil {
+		return nil, 0, &jobError{reason: "Invalid retention", err: err}
+	}
+	c, err := converter.NewDownloadConverter(newDownloadID())
+	if err != nil {
+		return nil, 0, &jobError{reason: "Failed to initialize converter", internal: true, err: fmt.Errorf("failed to create new converter: %w", err)}
+	}
+	c.Changes = changeMonitor
+	if req.Ordered {
+		// One page at a time, so that results and logs follow the URL list
+		c.Concurrency = 1
+		log.Printf("INFO: Converting the %d URLs of the request one at a time, in order", len(req.URLs))
+	}
+	return c, retention, nil
+}
 
+// runJob converts the URLs of req with c, relaying each result and the log
+// lines of the conversion to conn, then its completion message. Once a send
+// to conn fails, as when the client has gone away, nothing more is sent; the
+// conversion still completes, and its download is kept for retention.
+func runJob(c *converter.Converter, req ConversionRequest, retention time.Duration, conn jsonWriter) {
+	job := &jobClient{conn: conn, maxLogs: maxJobLogLines}
+	c.OnLog = job.relayLog
+
+	// An empty selector converts the whole page
 	resultsChan, summaryChan := c.Convert(req.URLs, req.Selector)
 
 	// Stream results back to the client
 	// The converter is now handling the file writing. The server just relays the status.
+	var client jsonWriter = job
+	var timings []converter.Result // The pages read back when the conversion completes
 	for result := range resultsChan {
-		if err := conn.WriteJSON(result); err != nil {
-			log.Printf("ERROR: Failed to write result to WebSocket: %v", err)
-			break // Stop if we can't write to the client
+		if verbose {
+			log.Printf("DEBUG: %s took %s; the selector matched %d elements", result.URL, result.Duration.Round(time.Millisecond), result.MatchCount)
+		}
+		timings = append(timings, converter.Result{URL: result.URL, Duration: result.Duration})
+		if client == nil {
+			continue // Drain the results so the conversion can finish
+		}
+		if err := client.WriteJSON(result); err != nil {
+			log.Printf("ERROR: Failed to write result to the client: %v", err)
+			client = nil // Stop writing if we can't reach the client
 		}
 	}
 
 	// Send the final summary, which includes the DownloadID
 	summary := <-summaryChan
+	downloads.keep(summary.DownloadID, time.Now().Add(retention))
+	size, err := dirSize(c.OutputDir)
+	if err != nil {
+		log.Printf("WARNING: Failed to size the output of %s: %v", summary.DownloadID, err)
+	}
+	jobStats.record(summary, size)
+	log.Printf("INFO: %s", completionMessage(summary, timings))
+	if err := handleSummary(client, summary); err != nil {
+		log.Printf("ERROR: Failed to write summary to the client: %v", err)
+	}
+}
+
+// ndjsonWriter sends messages as JSON lines on an HTTP response, flushing
+// each so that it reaches the client at once. Sends fail once done is closed,
+// when the client has disconnected.
+type ndjsonWriter struct {
+	w    http.ResponseWriter
+	done <-chan struct{}
+}
+
+func (n *ndjsonWriter) WriteJSON(v interface{}) error {
+	select {
+	case <-n.done:
+		return errors.New("client disconnected")
+	default:
+	}
+	if err := json.NewEncoder(n.w).Encode(v); err != nil {
+		return err
+	}
+	n.flush()
+	return nil
+}
+
+// flush sends what was written to the client, when the response supports it.
+func (n *ndjsonWriter) flush() {
+	if flusher, ok := n.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// completionMessage describes a completed conversion, naming its slowest pages.
+func completionMessage(summary converter.Summary, results []converter.Result) string {
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Duration > results[j].Duration })
+	if len(results) > slowestURLs {
+		results = results[:slowestURLs]
+	}
+	slowest := make([]string, len(results))
+	for i, r := range results {
+		slowest[i] = fmt.Sprintf("%s (%s)", r.URL, r.Duration.Round(time.Millisecond))
+	}
+	msg := fmt.Sprintf("Conversion %s completed in %s: %d of %d URLs succeeded", summary.DownloadID, summary.ProcessingTime, summary.Successful, summary.TotalURLs)
+	if len(slowest) > 0 {
+		msg += "; slowest: " + strings.Join(slowest, ", ")
+	}
+	return msg
+}
+
+// jsonWriter is the side of a client connection that messages are sent on.
+type jsonWriter interface {
+	WriteJSON(v interface{}) error
+}
+
+// logMessage is a log line of a conversion sent to its client.
+type logMessage struct {
+	Type string `json:"type"` // Always "log"
+	converter.LogEntry
+}
+
+// jobClient is the connection to the client of one conversion. Results are
+// sent on it by the handler while the workers send log lines, so writes are
+// serialized; after a failed write, nothing more is sent.
+type jobClient struct {
+	mu      sync.Mutex
+	conn    jsonWriter
+	failed  bool
+	logs    int // Log lines sent
+	maxLogs int
+}
+
+func (j *jobClient) WriteJSON(v interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.write(v)
+}
+
+// write sends v unless an earlier write failed. The caller holds mu.
+func (j *jobClient) write(v interface{}) error {
+	if j.failed {
+		return errors.New("connection to the client failed")
+	}
+	if err := j.conn.WriteJSON(v); err != nil {
+		j.failed = true
+		return err
+	}
+	return nil
+}
+
+// relayLog sends a log line of the conversion to the client, up to maxLogs of
+// them; the client is told once when the rest are held back.
+func (j *jobClient) relayLog(entry converter.LogEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.logs > j.maxLogs {
+		return
+	}
+	j.logs++
+	if j.logs > j.maxLogs {
+		entry = converter.LogEntry{Level: converter.LogWarning, Message: fmt.Sprintf("Log limit of %d lines reached; later lines are not sent", j.maxLogs)}
+	}
+	j.write(logMessage{Type: "log", LogEntry: entry})
+}
+
+// handleSummary sends the completion message of a conversion to client. A nil
+// client has gone away; nothing is sent, but the download stays available.
+func handleSummary(client jsonWriter, summary converter.Summary) error {
+	if client == nil {
+		log.Printf("INFO: Client left before conversion %s completed", summary.DownloadID)
+		return nil
+	}
 
 	// Create a response map to include the full download URL
 	response := map[string]interface{}{
@@ -89,10 +340,7 @@ func conversionHandler(w http.ResponseWriter, r *http.Request) {
 		"summary":      summary,
 		"download_url": fmt.Sprintf("/api/download/%s", summary.DownloadID),
 	}
-
-	if err := conn.WriteJSON(response); err != nil {
-		log.Printf("ERROR: Failed to write summary to WebSocket: %v", err)
-	}
+	return client.WriteJSON(response)
 }
 
 func downloadHandler(w http.ResponseWriter, r *http.Request) {
@@ -111,15 +359,41 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Set headers
+	// 3. Limit the archives built at once, as each walks and compresses a directory
+	select {
+	case downloadSlots <- struct{}{}:
+		defer func() { <-downloadSlots }()
+	default:
+		log.Printf("WARNING: Turning away download %s: %d downloads already in progress", id, cap(downloadSlots))
+		w.Header().Set("Retry-After", downloadRetryAfter)
+		http.Error(w, "Too many downloads in progress, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+
+	// 4. Refuse archives too large to build and send in one request
+	total, err := dirSize(dirPath)
+	if err != nil {
+		log.Printf("ERROR: Failed to size download %s: %v", id, err)
+		http.Error(w, "Failed to create zip archive", http.StatusInternalServerError)
+		return
+	}
+	if total > maxDownloadSize {
+		log.Printf("ERROR: Download %s is %d bytes, over the %d byte limit", id, total, maxDownloadSize)
+		http.Error(w, fmt.Sprintf("Download is %d bytes, over the %d byte limit", total, maxDownloadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// 5. Set headers
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", id))
 
-	// 4. Create zip archive and stream it
+	// 6. Create zip archive and stream it, flushing after each file so large
+	// archives reach the client as they are built instead of at the end
 	zipWriter := zip.NewWriter(w)
 	defer zipWriter.Close()
+	flusher, _ := w.(http.Flusher)
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -146,8 +420,16 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 		defer fsFile.Close()
 
 		// Copy the file content to the zip archive
-		_, err = io.Copy(zipFile, fsFile)
-		return err
+		if _, err = io.Copy(zipFile, fsFile); err != nil {
+			return err
+		}
+		if err := zipWriter.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
 	})
 
 	if err != nil {
@@ -159,15 +441,121 @@ func downloadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// dirSize returns the total size of the files below dir.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// newMaxDownloadSize reads the download size limit from DOC_CONVERTER_MAX_DOWNLOAD_SIZE,
+// a size such as "500MB".
+func newMaxDownloadSize() (int64, error) {
+	raw := os.Getenv("DOC_CONVERTER_MAX_DOWNLOAD_SIZE")
+	if raw == "" {
+		return defaultMaxDownloadSize, nil
+	}
+	size, err := converter.ParseByteSize(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid DOC_CONVERTER_MAX_DOWNLOAD_SIZE %q: %w", raw, err)
+	}
+	return size, nil
+}
+
+// newMaxDownloads reads the number of downloads zipped at once from
+// DOC_CONVERTER_MAX_DOWNLOADS.
+func newMaxDownloads() (int, error) {
+	raw := os.Getenv("DOC_CONVERTER_MAX_DOWNLOADS")
+	if raw == "" {
+		return defaultMaxDownloads, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid DOC_CONVERTER_MAX_DOWNLOADS %q: must be a positive integer", raw)
+	}
+	return n, nil
+}
+
+// newVerbose reads from DOC_CONVERTER_VERBOSE whether the time taken by each
+// page is logged.
+func newVerbose() (bool, error) {
+	raw := os.Getenv("DOC_CONVERTER_VERBOSE")
+	if raw == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid DOC_CONVERTER_VERBOSE %q: must be true or false", raw)
+	}
+	return v, nil
+}
+
+// newChangeMonitor configures change monitoring from the environment. Monitoring is
+// opt-in: it is only enabled when DOC_CONVERTER_CHANGE_THRESHOLD is set.
+func newChangeMonitor() (*converter.ChangeMonitor, error) {
+	raw := os.Getenv("DOC_CONVERTER_CHANGE_THRESHOLD")
+	if raw == "" {
+		return nil, nil
+	}
+	threshold, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOC_CONVERTER_CHANGE_THRESHOLD %q: %w", raw, err)
+	}
+	dir := os.Getenv("DOC_CONVERTER_HISTORY_DIR")
+	if dir == "" {
+		dir = filepath.Join("tmp", "history")
+	}
+	return converter.NewChangeMonitor(dir, threshold, os.Getenv("DOC_CONVERTER_CHANGE_WEBHOOK"))
+}
+
 // Run starts the web server.
 func Run() {
+	monitor, err := newChangeMonitor()
+	if err != nil {
+		log.Fatalf("Error configuring change monitoring: %v", err)
+	}
+	if monitor != nil {
+		log.Printf("INFO: Change monitoring enabled (threshold %.1f%%, history in %s)", monitor.Threshold, monitor.Dir)
+	}
+	changeMonitor = monitor
+
+	if maxDownloadSize, err = newMaxDownloadSize(); err != nil {
+		log.Fatalf("Error configuring downloads: %v", err)
+	}
+	maxDownloads, err := newMaxDownloads()
+	if err != nil {
+		log.Fatalf("Error configuring downloads: %v", err)
+	}
+	downloadSlots = make(chan struct{}, maxDownloads)
+
+	retention, maxRetention, err := newRetention()
+	if err != nil {
+		log.Fatalf("Error configuring downloads: %v", err)
+	}
+	if verbose, err = newVerbose(); err != nil {
+		log.Fatalf("Error configuring logging: %v", err)
+	}
+
+	downloads = newJanitor(filepath.Join("tmp", "downloads"), retention, maxRetention)
+	go downloads.run(janitorInterval)
+
 	// Serve static files from the 'frontend' directory
 	fs := http.FileServer(http.Dir("./frontend"))
 	http.Handle("/", fs)
 
 	// Your existing API handlers
 	http.HandleFunc("/api/convert-ws", conversionHandler)
+	http.HandleFunc("/api/convert-stream", convertStreamHandler)
 	http.HandleFunc("/api/download/", downloadHandler)
+	http.HandleFunc("/api/stats", statsHandler)
 
 	log.Println("Starting server on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"doc-converter/pkg/converter"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDownload creates a download directory holding the given files and
+// returns its ID.
+func writeDownload(t *testing.T, files map[string]string) string {
+	t.Helper()
+	id := "test-" + filepath.Base(t.Name())
+	dir := filepath.Join("tmp", "downloads", id)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	t.Cleanup(func() { os.RemoveAll("tmp") })
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return id
+}
+
+// setMaxDownloadSize overrides the download size limit for a test.
+func setMaxDownloadSize(t *testing.T, size int64) {
+	t.Helper()
+	original := maxDownloadSize
+	maxDownloadSize = size
+	t.Cleanup(func() { maxDownloadSize = original })
+}
+
+func TestDownloadHandler_ZipsFiles(t *testing.T) {
+	id := writeDownload(t, map[string]string{"a.md": "alpha", "b.md": "beta"})
+
+	rec := httptest.NewRecorder()
+	downloadHandler(rec, httptest.NewRequest(http.MethodGet, "/api/download/"+id, nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	require.NoError(t, err)
+	contents := make(map[string]string)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		contents[f.Name] = string(data)
+	}
+	assert.Equal(t, map[string]string{"a.md": "alpha", "b.md": "beta"}, contents)
+}
+
+func TestDownloadHandler_TooLarge(t *testing.T) {
+	id := writeDownload(t, map[string]string{"a.md": "0123456789", "b.md": "0123456789"})
+	setMaxDownloadSize(t, 15)
+
+	rec := httptest.NewRecorder()
+	downloadHandler(rec, httptest.NewRequest(http.MethodGet, "/api/download/"+id, nil))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.NotEqual(t, "application/zip", rec.Header().Get("Content-Type"))
+}
+
+func TestNewMaxDownloadSize(t *testing.T) {
+	t.Setenv("DOC_CONVERTER_MAX_DOWNLOAD_SIZE", "")
+	size, err := newMaxDownloadSize()
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultMaxDownloadSize), size)
+
+	t.Setenv("DOC_CONVERTER_MAX_DOWNLOAD_SIZE", "200MB")
+	size, err = newMaxDownloadSize()
+	require.NoError(t, err)
+	assert.Equal(t, int64(200<<20), size)
+
+	t.Setenv("DOC_CONVERTER_MAX_DOWNLOAD_SIZE", "lots")
+	_, err = newMaxDownloadSize()
+	assert.Error(t, err)
+}
+
+// blockingWriter is a ResponseWriter whose writes wait until release is closed,
+// holding its download in progress.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestDownloadHandler_LimitsConcurrentDownloads(t *testing.T) {
+	id := writeDownload(t, map[string]string{"a.md": "alpha"})
+	original := downloadSlots
+	downloadSlots = make(chan struct{}, 1)
+	t.Cleanup(func() { downloadSlots = original })
+
+	slow := &blockingWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		downloadHandler(slow, httptest.NewRequest(http.MethodGet, "/api/download/"+id, nil))
+	}()
+	require.Eventually(t, func() bool { return len(downloadSlots) == 1 }, time.Second, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	downloadHandler(rec, httptest.NewRequest(http.MethodGet, "/api/download/"+id, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "a download beyond the limit should be turned away")
+	assert.Equal(t, downloadRetryAfter, rec.Header().Get("Retry-After"))
+
+	close(slow.release)
+	<-done
+	assert.Equal(t, http.StatusOK, slow.Code)
+
+	rec = httptest.NewRecorder()
+	downloadHandler(rec, httptest.NewRequest(http.MethodGet, "/api/download/"+id, nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "the slot is free again once the download completes")
+}
+
+func TestNewMaxDownloads(t *testing.T) {
+	t.Setenv("DOC_CONVERTER_MAX_DOWNLOADS", "")
+	n, err := newMaxDownloads()
+	require.NoError(t, err)
+	assert.Equal(t, defaultMaxDownloads, n)
+
+	t.Setenv("DOC_CONVERTER_MAX_DOWNLOADS", "2")
+	n, err = newMaxDownloads()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	t.Setenv("DOC_CONVERTER_MAX_DOWNLOADS", "0")
+	_, err = newMaxDownloads()
+	assert.Error(t, err)
+}
+
+// recordingClient collects the messages sent to it, or fails every send with err.
+type recordingClient struct {
+	messages []interface{}
+	err      error
+}
+
+func (c *recordingClient) WriteJSON(v interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.messages = append(c.messages, v)
+	return nil
+}
+
+func TestHandleSummary(t *testing.T) {
+	summary := converter.Summary{TotalURLs: 2, Successful: 1, Failed: 1, FailedURLs: []string{"https://example.com/gone"}, DownloadID: "abc-123"}
+
+	t.Run("client present", func(t *testing.T) {
+		client := &recordingClient{}
+		require.NoError(t, handleSummary(client, summary))
+		require.Len(t, client.messages, 1)
+		assert.Equal(t, map[string]interface{}{
+			"status":       "completed",
+			"summary":      summary,
+			"download_url": "/api/download/abc-123",
+		}, client.messages[0])
+	})
+
+	t.Run("client absent", func(t *testing.T) {
+		assert.NoError(t, handleSummary(nil, summary), "a client that left is not an error")
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		client := &recordingClient{err: errors.New("broken pipe")}
+		assert.EqualError(t, handleSummary(client, summary), "broken pipe")
+	})
+}
+
+func TestJobClient_RelayLog(t *testing.T) {
+	conn := &recordingClient{}
+	job := &jobClient{conn: conn, maxLogs: 2}
+	for i := 0; i < 5; i++ {
+		job.relayLog(converter.LogEntry{Level: converter.LogError, Message: fmt.Sprintf("line %d", i), URL: "https://example.com/a"})
+	}
+	require.NoError(t, job.WriteJSON("result"))
+
+	assert.Equal(t, []interface{}{
+		logMessage{Type: "log", LogEntry: converter.LogEntry{Level: converter.LogError, Message: "line 0", URL: "https://example.com/a"}},
+		logMessage{Type: "log", LogEntry: converter.LogEntry{Level: converter.LogError, Message: "line 1", URL: "https://example.com/a"}},
+		logMessage{Type: "log", LogEntry: converter.LogEntry{Level: converter.LogWarning, Message: "Log limit of 2 lines reached; later lines are not sent"}},
+		"result",
+	}, conn.messages, "lines past the limit are dropped after one notice; results still go through")
+
+	conn.err = errors.New("broken pipe")
+	assert.Error(t, job.WriteJSON("lost"))
+	conn.err = nil
+	assert.Error(t, job.WriteJSON("after"), "nothing is sent after a failed write")
+	assert.Len(t, conn.messages, 4)
+}
+
+func TestConvertStreamHandler_RefusesRequests(t *testing.T) {
+	testCases := []struct {
+		name, method, query string
+		status              int
+	}{
+		{"no URLs", http.MethodGet, "selector=main", http.StatusBadRequest},
+		{"invalid retention", http.MethodGet, "url=https://example.com/a&retention=soon", http.StatusBadRequest},
+		{"invalid ordered", http.MethodGet, "url=https://example.com/a&ordered=maybe", http.StatusBadRequest},
+		{"not a GET", http.MethodPost, "url=https://example.com/a", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			convertStreamHandler(rec, httptest.NewRequest(tc.method, "/api/convert-stream?"+tc.query, nil))
+			assert.Equal(t, tc.status, rec.Code)
+			assert.NotEqual(t, "application/x-ndjson", rec.Header().Get("Content-Type"), "no stream is started")
+		})
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	stream := &ndjsonWriter{w: rec, done: done}
+	require.NoError(t, stream.WriteJSON(map[string]string{"url": "https://example.com/a"}))
+	require.NoError(t, stream.WriteJSON(logMessage{Type: "log", LogEntry: converter.LogEntry{Level: converter.LogInfo, Message: "hello"}}))
+	assert.Equal(t, "{\"url\":\"https://example.com/a\"}\n{\"type\":\"log\",\"level\":\"info\",\"message\":\"hello\"}\n", rec.Body.String())
+	assert.True(t, rec.Flushed, "each line is flushed")
+
+	close(done)
+	assert.Error(t, stream.WriteJSON("lost"), "nothing is sent once the client disconnected")
+	assert.NotContains(t, rec.Body.String(), "lost")
+}
+
+func TestCompletionMessage(t *testing.T) {
+	summary := converter.Summary{TotalURLs: 7, Successful: 6, Failed: 1, ProcessingTime: "12.5s", DownloadID: "abc-123"}
+	var results []converter.Result
+	for i, ms := range []int{400, 9000, 120, 3000, 2500, 9000, 50} {
+		results = append(results, converter.Result{URL: fmt.Sprintf("https://example.com/%d", i), Duration: time.Duration(ms)*time.Millisecond + 300*time.Microsecond})
+	}
+
+	assert.Equal(t, "Conversion abc-123 completed in 12.5s: 6 of 7 URLs succeeded; slowest: "+
+		"https://example.com/1 (9s), https://example.com/5 (9s), https://example.com/3 (3s), https://example.com/4 (2.5s), https://example.com/0 (400ms)",
+		completionMessage(summary, results))
+	assert.Equal(t, "Conversion abc-123 completed in 12.5s: 6 of 7 URLs succeeded", completionMessage(summary, nil))
+}
+
+func TestStatsHandler(t *testing.T) {
+	original := jobStats
+	jobStats = newStatsCounter()
+	t.Cleanup(func() { jobStats = original })
+
+	jobStats.record(converter.Summary{TotalURLs: 3, Successful: 2, Failed: 1}, 1024)
+	jobStats.record(converter.Summary{TotalURLs: 1, Successful: 1}, 512)
+
+	get := func(method string) Stats {
+		rec := httptest.NewRecorder()
+		statsHandler(rec, httptest.NewRequest(method, "/api/stats", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var stats Stats
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		return stats
+	}
+
+	stats := get(http.MethodGet)
+	assert.Equal(t, Stats{Jobs: 2, URLs: 4, Successful: 3, Failed: 1, Bytes: 1536, Since: stats.Since}, stats)
+	assert.Equal(t, stats, get(http.MethodDelete), "a reset returns the totals it clears")
+	after := get(http.MethodGet)
+	assert.Zero(t, after.Jobs)
+	assert.False(t, after.Since.Before(stats.Since))
+
+	rec := httptest.NewRecorder()
+	statsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/stats", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestJanitor_PerJobRetention(t *testing.T) {
+	dir := t.TempDir()
+	j := newJanitor(dir, time.Hour, 48*time.Hour)
+	for _, id := range []string{"short", "long", "unknown"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, id), 0755))
+	}
+	now := time.Now()
+	short, err := j.retentionFor("10m")
+	require.NoError(t, err)
+	long, err := j.retentionFor("24h")
+	require.NoError(t, err)
+	j.keep("short", now.Add(short))
+	j.keep("long", now.Add(long))
+
+	assert.Empty(t, j.sweep(now.Add(5*time.Minute)))
+	assert.Equal(t, []string{"short"}, j.sweep(now.Add(15*time.Minute)), "the short-retention job goes first")
+	assert.DirExists(t, filepath.Join(dir, "long"))
+	assert.Equal(t, []string{"unknown"}, j.sweep(now.Add(2*time.Hour)), "an unrecorded download gets the default retention")
+	assert.Equal(t, []string{"long"}, j.sweep(now.Add(25*time.Hour)))
+}
+
+func TestJanitor_RetentionFor(t *testing.T) {
+	j := newJanitor(t.TempDir(), time.Hour, 48*time.Hour)
+	for requested, want := range map[string]time.Duration{"": time.Hour, "30m": 30 * time.Minute, "720h": 48 * time.Hour} {
+		got, err := j.retentionFor(requested)
+		require.NoError(t, err, requested)
+		assert.Equal(t, want, got, requested)
+	}
+	for _, requested := range []string{"forever", "0s", "-1h"} {
+		_, err := j.retentionFor(requested)
+		assert.Error(t, err, requested)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"doc-converter/pkg/converter"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Stats are the totals of the conversions completed since the server started
+// or the stats were last reset.
+type Stats struct {
+	Jobs       int       `json:"jobs"`
+	URLs       int       `json:"urls"`
+	Successful int       `json:"successful"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"` // Size of the converted files
+	Since      time.Time `json:"since"`
+}
+
+// statsCounter accumulates Stats as conversions complete.
+type statsCounter struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// jobStats counts every conversion run by the server.
+var jobStats = newStatsCounter()
+
+func newStatsCounter() *statsCounter {
+	return &statsCounter{stats: Stats{Since: time.Now()}}
+}
+
+// record adds a completed conversion whose files take bytes.
+func (s *statsCounter) record(summary converter.Summary, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Jobs++
+	s.stats.URLs += summary.TotalURLs
+	s.stats.Successful += summary.Successful
+	s.stats.Failed += summary.Failed
+	s.stats.Bytes += bytes
+}
+
+// snapshot returns the current totals, starting them over when reset is set.
+func (s *statsCounter) snapshot(reset bool) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	if reset {
+		s.stats = Stats{Since: time.Now()}
+	}
+	return stats
+}
+
+// statsHandler serves the conversion totals with GET. DELETE returns them too,
+// and starts them over.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	var stats Stats
+	switch r.Method {
+	case http.MethodGet:
+		stats = jobStats.snapshot(false)
+	case http.MethodDelete:
+		stats = jobStats.snapshot(true)
+		log.Printf("INFO: Conversion stats reset")
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("ERROR: Failed to write stats: %v", err)
+	}
+}